@@ -20,6 +20,9 @@ type Buffer struct {
 	pins     int
 	txnum    int
 	lsn      int
+	index    int  // position in the manager's pool
+	fetched  bool // read ahead and not pinned since
+	imaged   bool // its page image is logged since the block was read or checkpointed
 }
 
 func NewBuffer(fm *file.Manager, lm *log.Manager) *Buffer {
@@ -49,6 +52,15 @@ func (b *Buffer) SetModified(txnum int, lsn int) {
 	}
 }
 
+func (b *Buffer) Imaged() bool {
+	return b.imaged
+}
+
+// records that the page as it is now has been logged, before its first change
+func (b *Buffer) SetImaged() {
+	b.imaged = true
+}
+
 func (b *Buffer) IsPinned() bool {
 	return b.pins > 0
 }
@@ -57,23 +69,55 @@ func (b *Buffer) ModifyingTxn() int {
 	return b.txnum
 }
 
-func (b *Buffer) AssignToBlock(blockId file.BlockID) {
+// If the old contents cannot be flushed the buffer keeps its old block
+// If the new block cannot be read the buffer is left unassigned
+func (b *Buffer) AssignToBlock(blockId file.BlockID) error {
 	// flush current contents
-	b.flush()
+	if err := b.flush(); err != nil {
+		return err
+	}
 	// Read the new block into the page
 	b.blockId = blockId
-	b.fm.Read(b.blockId, b.contents)
 	b.pins = 0
+	b.fetched = false
+	b.imaged = false
+	if err := b.fm.Read(b.blockId, b.contents); err != nil {
+		b.blockId = file.NewBlockID("", -1)
+		return err
+	}
+	return nil
 }
 
-func (b *Buffer) flush() {
+func (b *Buffer) flush() error {
 	if b.txnum >= 0 {
 		// Flush the log page with this lsn
-		b.lm.Flush(b.lsn)
+		if err := b.lm.Flush(b.lsn); err != nil {
+			return err
+		}
 		// Write the buffer to its disk block if it is dirty
-		b.fm.Write(b.blockId, b.contents)
+		if err := b.fm.Write(b.blockId, b.contents); err != nil {
+			return err
+		}
 		b.txnum = -1
 	}
+	return nil
+}
+
+// forgets the assigned block without writing the contents back
+func (b *Buffer) discard() {
+	b.blockId = file.NewBlockID("", -1)
+	b.fetched = false
+	b.imaged = false
+	b.txnum = -1
+	b.lsn = -1
+}
+
+// takes the contents of the block read ahead, the buffer must be clean and unpinned
+func (b *Buffer) load(blockId file.BlockID, page *file.Page) {
+	copy(b.contents.Contents(), page.Contents())
+	b.blockId = blockId
+	b.fetched = true
+	b.imaged = false
 }
 
 func (b *Buffer) Pin() {
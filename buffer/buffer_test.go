@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"errors"
 	"os"
 	"path"
 	"testing"
@@ -18,13 +19,13 @@ func TestBuffer(t *testing.T) {
 
 	t.Cleanup(func() {
 		p1 := path.Join(dbFolder, blockFile)
-		p2 := path.Join(dbFolder, logFile)
-		os.Remove(p1)
-		os.Remove(p2)
-		os.Remove(path.Dir(p1))
+		os.RemoveAll(path.Dir(p1))
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := NewBufferManager(fm, lm, bufferPoolSize)
 
@@ -75,3 +76,34 @@ func TestBuffer(t *testing.T) {
 
 	t.Logf("offset %d contains %d", pos, p2.GetInt(pos))
 }
+
+func TestBufferPinCorruptBlock(t *testing.T) {
+	const blockFile = "testfile"
+	const logFile = "logfile"
+	const blockSize = 400
+	const bufferPoolSize = 3
+
+	storage := file.NewMemStorage()
+	fm, err := file.NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, logFile)
+	bm := NewBufferManager(fm, lm, bufferPoolSize)
+
+	blockId, _ := fm.Append(blockFile)
+	page := file.NewPageWithSize(blockSize)
+	page.SetInt(0, 42)
+	fm.Write(blockId, page)
+
+	// damage the block on the storage
+	device, _ := storage.Open(blockFile)
+	device.WriteAt([]byte{0xff}, 100)
+
+	if _, err := bm.Pin(blockId); !errors.Is(err, file.ErrCorruptBlock) {
+		t.Fatalf("expected %v, got %v", file.ErrCorruptBlock, err)
+	}
+	if got := bm.Available(); got != bufferPoolSize {
+		t.Fatalf("expected %d available buffers after failed pin, got %d", bufferPoolSize, got)
+	}
+}
@@ -18,13 +18,13 @@ func TestBufferFile(t *testing.T) {
 
 	t.Cleanup(func() {
 		p1 := path.Join(dbFolder, blockFile)
-		p2 := path.Join(dbFolder, logFile)
-		os.Remove(p1)
-		os.Remove(p2)
-		os.Remove(path.Dir(p1))
+		os.RemoveAll(path.Dir(p1))
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := NewBufferManager(fm, lm, bufferPoolSize)
 
@@ -3,3 +3,5 @@ package buffer
 import "errors"
 
 var ErrBufferAbort = errors.New("client has timed out while waiting for buffers to be assigned")
+
+var ErrPoolSize = errors.New("the buffer pool needs at least one buffer")
@@ -1,6 +1,10 @@
 package buffer
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -9,26 +13,67 @@ import (
 )
 
 // Manages the pinning and unpinning of buffers to blocks
+// the page table and the free list keep pinning cheap however large the pool is
 
 const MAX_TIME = 10 * time.Second // 10s
 
 type Manager struct {
+	fm           *file.Manager
+	lm           *log.Manager
 	bufferPool   []*Buffer
+	pageTable    map[file.BlockID]*Buffer // buffers holding a block
+	freeList     []*Buffer                // buffers holding no block, all unpinned
 	numAvailable int
+	policy       ReplacementPolicy
+	waiters      *list.List // clients waiting for a buffer, longest waiting first
+	stats        Stats
+	loading      map[file.BlockID]chan struct{} // blocks being read ahead, closed once done
+	diskVersion  int                            // changes whenever a block on disk may change
+	retiring     int                            // buffers still to retire once unpinned, see resize.go
+	pinReports   io.Writer                      // nil unless pin tracking is on, see pinTracking.go
+	tracked      map[*Buffer][]trackedPin
+	pinSeq       int
+	prefetches   sync.WaitGroup
 	mu           sync.Mutex
 }
 
-func NewBufferManager(fm *file.Manager, lm *log.Manager, numBuffs int) *Manager {
+// a client waiting in Pin, woken through ready when it may be able to pin
+type waiter struct {
+	ready   chan struct{}
+	element *list.Element
+}
+
+func NewBufferManager(fm *file.Manager, lm *log.Manager, numBuffs int, opts ...Option) *Manager {
 	bp := make([]*Buffer, 0)
 	for i := 0; i < numBuffs; i++ {
-		bp = append(bp, NewBuffer(fm, lm))
+		buf := NewBuffer(fm, lm)
+		buf.index = i
+		bp = append(bp, buf)
+	}
+
+	// the free list is used from its end, so buffers are handed out in pool order
+	freeList := make([]*Buffer, numBuffs)
+	for i, buf := range bp {
+		freeList[numBuffs-1-i] = buf
 	}
 
-	return &Manager{
+	bm := &Manager{
+		fm:           fm,
+		lm:           lm,
 		bufferPool:   bp,
+		pageTable:    make(map[file.BlockID]*Buffer, numBuffs),
+		freeList:     freeList,
 		numAvailable: numBuffs,
+		policy:       NewNaivePolicy(),
+		waiters:      list.New(),
+		loading:      make(map[file.BlockID]chan struct{}),
 		mu:           sync.Mutex{},
 	}
+	for _, opt := range opts {
+		opt(bm)
+	}
+	bm.policy.Init(numBuffs)
+	return bm
 }
 
 func (bm *Manager) Available() int {
@@ -38,95 +83,307 @@ func (bm *Manager) Available() int {
 	return bm.numAvailable
 }
 
+func (bm *Manager) Size() int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	return len(bm.bufferPool)
+}
+
+// Returns how many times the block is pinned, 0 if no buffer holds it
+func (bm *Manager) PinCount(blockId file.BlockID) int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if buf := bm.pageTable[blockId]; buf != nil {
+		return buf.pins
+	}
+	return 0
+}
+
 // flushes the dirty buffers modified by the specified txns
-func (bm *Manager) FlushAll(txnum int) {
+func (bm *Manager) FlushAll(txnum int) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for _, buf := range bm.bufferPool {
+		if buf.ModifyingTxn() == txnum && txnum >= 0 {
+			if err := buf.flush(); err != nil {
+				return err
+			}
+			bm.flushed()
+		}
+	}
+	return nil
+}
+
+// flushes every modified buffer, used by checkpoints while no txn is running
+// the next change to each page logs its image again
+func (bm *Manager) FlushDirty() error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for _, buf := range bm.bufferPool {
+		buf.imaged = false
+		if buf.ModifyingTxn() >= 0 {
+			if err := buf.flush(); err != nil {
+				return err
+			}
+			bm.flushed()
+		}
+	}
+	return nil
+}
+
+/*
+Writes up to max unpinned modified buffers whose log records are already durable, returns how many
+*/
+func (bm *Manager) WriteDirty(max int) (int, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	written := 0
+	for _, buf := range bm.bufferPool {
+		if written == max {
+			break
+		}
+		if buf.IsPinned() || buf.ModifyingTxn() < 0 || buf.lsn > buf.lm.DurableLSN() {
+			continue
+		}
+		if err := buf.flush(); err != nil {
+			return written, err
+		}
+		bm.flushed()
+		written++
+	}
+	return written, nil
+}
+
+/*
+Truncates the file to numBlocks blocks, but never past a pinned block, and drops the buffers cut off
+Returns the number of blocks the file keeps
+*/
+func (bm *Manager) Truncate(filename string, numBlocks int) (int, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for _, buf := range bm.bufferPool {
+		blk := buf.Block()
+		if buf.IsPinned() && blk.FileName() == filename && blk.BlockNumber() >= numBlocks {
+			numBlocks = blk.BlockNumber() + 1
+		}
+	}
+	bm.dropBlocks(filename, numBlocks)
+	bm.diskVersion++
+	return numBlocks, bm.fm.Truncate(filename, numBlocks)
+}
+
+// Writes the page over the block, which may be torn, and into the buffer holding it
+func (bm *Manager) Restore(blockId file.BlockID, page *file.Page) error {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
+	bm.diskVersion++
+	if err := bm.fm.Write(blockId, page); err != nil {
+		return err
+	}
+	if buf := bm.pageTable[blockId]; buf != nil {
+		copy(buf.contents.Contents(), page.Contents())
+	}
+	return nil
+}
+
+// none of the blocks may be pinned
+func (bm *Manager) dropBlocks(filename string, fromBlock int) {
 	for _, buf := range bm.bufferPool {
-		if buf.ModifyingTxn() == txnum {
-			buf.flush()
+		blk := buf.Block()
+		if blk.FileName() == filename && blk.BlockNumber() >= fromBlock {
+			buf.discard()
+			delete(bm.pageTable, blk)
+			bm.freeList = append(bm.freeList, buf)
 		}
 	}
 }
 
+// Unpins a pin that was not taken for a txn
 func (bm *Manager) UnPin(buff *Buffer) {
+	bm.UnPinFor(buff, -1)
+}
+
+// Unpins a pin taken for the txn, see WithPinOwner
+func (bm *Manager) UnPinFor(buff *Buffer, txnum int) {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
+	bm.untrack(buff, txnum)
 	buff.UnPin()
 	if !buff.IsPinned() {
 		bm.numAvailable++
+		bm.policy.Unpinned(buff.index)
+		// a shrinking pool may take the buffer, a failed write leaves it for later
+		bm.retire()
+		bm.wakeNext()
 	}
 }
 
 // tries to pin a buffer to the given block
 // if no buffer is available, clients will be put on wait until timeout
 // if timeout is over, an ErrAbortException is returned to client
+// an error flushing the victim buffer or reading the block is returned as is
 func (bm *Manager) Pin(blockId file.BlockID) (*Buffer, error) {
-	// Try immediately first before waiting
+	ctx, cancel := context.WithTimeout(context.Background(), MAX_TIME)
+	defer cancel()
+	return bm.PinContext(ctx, blockId)
+}
+
+/*
+Pins a buffer to the given block, waiting in line for one to be unpinned for as long as the context allows
+If the context ends first the error matches both ErrBufferAbort and the context's error
+*/
+func (bm *Manager) PinContext(ctx context.Context, blockId file.BlockID) (*Buffer, error) {
 	bm.mu.Lock()
-	buff := bm.TryToPin(blockId)
+	defer bm.mu.Unlock()
+
+	buff, err := bm.pinContext(ctx, blockId)
 	if buff != nil {
-		bm.mu.Unlock()
-		return buff, nil
+		bm.track(ctx, buff)
 	}
-	bm.mu.Unlock()
+	return buff, err
+}
 
-	timeoutCh := time.After(MAX_TIME)
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+func (bm *Manager) pinContext(ctx context.Context, blockId file.BlockID) (*Buffer, error) {
+	if err := bm.waitForLoad(ctx, blockId); err != nil {
+		return nil, err
+	}
+	// Try immediately first before waiting
+	if existing := bm.FindExistingBuffer(blockId); bm.waiters.Len() == 0 || (existing != nil && existing.IsPinned()) {
+		buff, err := bm.TryToPin(blockId)
+		if buff != nil || err != nil {
+			return buff, err
+		}
+	}
 
+	w := &waiter{ready: make(chan struct{}, 1)}
+	w.element = bm.waiters.PushBack(w)
+	bm.stats.PinWaits++
+	start := time.Now()
+	defer func() {
+		bm.waiters.Remove(w.element)
+		bm.stats.PinWaitTime += time.Since(start)
+		bm.wakeNext()
+	}()
 	for {
+		bm.mu.Unlock()
 		select {
-		// waits for the time to elapse, then send current time on this channel
-		case <-timeoutCh:
-			return nil, ErrBufferAbort
-		case <-ticker.C:
+		case <-ctx.Done():
+			bm.mu.Lock()
+			bm.stats.Timeouts++
+			bm.reportTimeout(blockId)
+			return nil, fmt.Errorf("%w: %w", ErrBufferAbort, ctx.Err())
+		case <-w.ready:
 			bm.mu.Lock()
-			buff := bm.TryToPin(blockId)
-			bm.mu.Unlock()
-
-			if buff != nil {
-				return buff, nil
-			}
+		}
+		if bm.waiters.Front() != w.element {
+			continue
+		}
+		buff, err := bm.TryToPin(blockId)
+		if buff != nil || err != nil {
+			return buff, err
 		}
 	}
 }
 
-func (bm *Manager) TryToPin(blockId file.BlockID) *Buffer {
-	buff := bm.FindExistingBuffer(blockId)
+// wakes the longest waiting client if a buffer is available
+func (bm *Manager) wakeNext() {
+	if bm.numAvailable == 0 || bm.waiters.Len() == 0 {
+		return
+	}
+	w := bm.waiters.Front().Value.(*waiter)
+	select {
+	case w.ready <- struct{}{}:
+	default:
+		// already woken
+	}
+}
+
+// returns nil with no error if every buffer is pinned
+func (bm *Manager) TryToPin(blockId file.BlockID) (*Buffer, error) {
+	if buff := bm.FindExistingBuffer(blockId); buff != nil {
+		bm.pin(buff, false)
+		return buff, nil
+	}
+	buff := bm.ChooseUnpinnedBuffer()
 	if buff == nil {
-		buff = bm.ChooseUnpinnedBuffer()
-		if buff == nil {
-			return nil
-		}
-		buff.AssignToBlock(blockId)
+		return nil, nil
+	}
+	if err := bm.assign(buff, blockId); err != nil {
+		return nil, err
 	}
+	bm.pin(buff, true)
+	return buff, nil
+}
+
+// pins the buffer, assigned reports whether it was just given its block
+func (bm *Manager) pin(buff *Buffer, assigned bool) {
+	prefetched := !assigned && buff.fetched
 	if !buff.IsPinned() {
 		bm.numAvailable--
 	}
 	buff.Pin()
-	return buff
+	// the policy learns of a block read ahead when it is first used
+	bm.policy.Pinned(buff.index, assigned || prefetched)
+	buff.fetched = false
+	if assigned {
+		bm.stats.Misses++
+	} else {
+		bm.stats.Hits++
+	}
+	if prefetched {
+		bm.stats.PrefetchHits++
+	}
 }
 
 // tries to find if a buffer exists which is already assigned this block, else nil
 func (bm *Manager) FindExistingBuffer(blockId file.BlockID) *Buffer {
-	for _, buf := range bm.bufferPool {
-		if buf.Block().Equals(blockId) {
-			return buf
-		}
+	return bm.pageTable[blockId]
+}
+
+// assigns the buffer to the block and keeps the page table and free list in step
+func (bm *Manager) assign(buff *Buffer, blockId file.BlockID) error {
+	old := buff.Block()
+	dirty := buff.ModifyingTxn() >= 0
+	err := buff.AssignToBlock(blockId)
+	if dirty && buff.ModifyingTxn() < 0 {
+		bm.flushed()
+	}
+	if buff.Block() == old {
+		// the old contents could not be flushed, nothing changed
+		return err
 	}
+	if old.FileName() == "" {
+		// free buffers are taken from the end of the list
+		bm.freeList = bm.freeList[:len(bm.freeList)-1]
+	} else {
+		delete(bm.pageTable, old)
+		bm.stats.Evictions++
+	}
+	if err != nil {
+		// the block could not be read, the buffer holds none
+		bm.freeList = append(bm.freeList, buff)
+		return err
+	}
+	bm.pageTable[blockId] = buff
 	return nil
 }
 
-// chooses for the 1st unpinned buffer in the buffer pool, returns nil if no buffer is available
-// Improve with Algo's like LRU-K
+// picks a buffer holding no block, else the replacement policy's victim, nil if none is available
 func (bm *Manager) ChooseUnpinnedBuffer() *Buffer {
-	for _, buf := range bm.bufferPool {
-		if !buf.IsPinned() {
-			return buf
-		}
+	if len(bm.freeList) > 0 {
+		return bm.freeList[len(bm.freeList)-1]
 	}
-	return nil
+	i := bm.policy.Victim(bm.bufferPool)
+	if i < 0 {
+		return nil
+	}
+	return bm.bufferPool[i]
 }
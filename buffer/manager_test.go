@@ -1,9 +1,15 @@
 package buffer
 
 import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nitishsharma2825/simpleDB/file"
 	"github.com/nitishsharma2825/simpleDB/log"
@@ -22,6 +28,9 @@ func TestBufferPoolManager(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := NewBufferManager(fm, lm, bufferPoolSize)
 
@@ -76,3 +85,569 @@ func TestBufferPoolManager(t *testing.T) {
 		}
 	}
 }
+
+// the page table and free list stay in step with the blocks the buffers hold
+func checkPageTable(t *testing.T, bm *Manager) {
+	assigned := 0
+	for _, buf := range bm.bufferPool {
+		if buf.Block().FileName() == "" {
+			continue
+		}
+		assigned++
+		if bm.FindExistingBuffer(buf.Block()) != buf {
+			t.Fatalf("expected the page table to map %v to its buffer", buf.Block())
+		}
+	}
+	if len(bm.pageTable) != assigned {
+		t.Fatalf("expected %d page table entries, got %d", assigned, len(bm.pageTable))
+	}
+	if len(bm.freeList) != len(bm.bufferPool)-assigned {
+		t.Fatalf("expected %d free buffers, got %d", len(bm.bufferPool)-assigned, len(bm.freeList))
+	}
+}
+
+func TestBufferPageTable(t *testing.T) {
+	const bufferPoolSize = 20000
+	const blockFile = "testfile"
+
+	storage := file.NewMemStorage()
+	fm, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	t.Cleanup(func() {
+		fm.Close()
+	})
+	lm := log.NewLogManager(fm, "logfile")
+	bm := NewBufferManager(fm, lm, bufferPoolSize, WithReplacementPolicy(NewLRUPolicy()))
+
+	// fill the pool, then replace half of it
+	for i := range bufferPoolSize * 3 / 2 {
+		buff, err := bm.Pin(file.NewBlockID(blockFile, i))
+		if err != nil {
+			t.Fatalf("failed to pin block %d: %v", i, err)
+		}
+		bm.UnPin(buff)
+	}
+	checkPageTable(t, bm)
+	if bm.FindExistingBuffer(file.NewBlockID(blockFile, 0)) != nil {
+		t.Fatalf("expected block 0 to be replaced")
+	}
+
+	// truncated blocks free their buffers, a pinned block is kept
+	pinned, _ := bm.Pin(file.NewBlockID(blockFile, bufferPoolSize+1))
+	if kept, err := bm.Truncate(blockFile, bufferPoolSize); err != nil || kept != bufferPoolSize+2 {
+		t.Fatalf("expected the file to keep %d blocks, got %d: %v", bufferPoolSize+2, kept, err)
+	}
+	bm.UnPin(pinned)
+	if kept, _ := bm.Truncate(blockFile, bufferPoolSize); kept != bufferPoolSize {
+		t.Fatalf("expected the file to keep %d blocks, got %d", bufferPoolSize, kept)
+	}
+	checkPageTable(t, bm)
+	if len(bm.freeList) != bufferPoolSize/2 {
+		t.Fatalf("expected %d free buffers, got %d", bufferPoolSize/2, len(bm.freeList))
+	}
+
+	// a block that cannot be read leaves its buffer free
+	blockId, _ := fm.Append("damaged")
+	page := file.NewPageWithSize(400)
+	fm.Write(blockId, page)
+	device, _ := storage.Open("damaged")
+	device.WriteAt([]byte{0xff}, 100)
+	if _, err := bm.Pin(blockId); !errors.Is(err, file.ErrCorruptBlock) {
+		t.Fatalf("expected %v, got %v", file.ErrCorruptBlock, err)
+	}
+	checkPageTable(t, bm)
+}
+
+func newWaitTestManager(t *testing.T, numBuffs int) *Manager {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	t.Cleanup(func() {
+		fm.Close()
+	})
+	return NewBufferManager(fm, log.NewLogManager(fm, "logfile"), numBuffs)
+}
+
+// waits until the number of clients waiting for a buffer is n
+func waitForWaiters(t *testing.T, bm *Manager, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bm.mu.Lock()
+		waiting := bm.waiters.Len()
+		bm.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiting clients, got %d", n, waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPinWaitersFIFO(t *testing.T) {
+	bm := newWaitTestManager(t, 1)
+	held, err := bm.Pin(file.NewBlockID("testfile", 0))
+	if err != nil {
+		t.Fatalf("failed to pin block 0: %v", err)
+	}
+
+	pinned := make(chan int, 3)
+	for i := 1; i <= 3; i++ {
+		go func() {
+			buff, err := bm.Pin(file.NewBlockID("testfile", i))
+			if err != nil {
+				t.Errorf("failed to pin block %d: %v", i, err)
+				pinned <- -1
+				return
+			}
+			pinned <- i
+			bm.UnPin(buff)
+		}()
+		waitForWaiters(t, bm, i)
+	}
+
+	// every unpin wakes the longest waiting client, without polling
+	start := time.Now()
+	bm.UnPin(held)
+	for i := 1; i <= 3; i++ {
+		if got := <-pinned; got != i {
+			t.Fatalf("expected block %d pinned next, got %d", i, got)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the waiting clients to be woken at once, took %v", elapsed)
+	}
+}
+
+func TestPinContext(t *testing.T) {
+	bm := newWaitTestManager(t, 1)
+	held, err := bm.Pin(file.NewBlockID("testfile", 0))
+	if err != nil {
+		t.Fatalf("failed to pin block 0: %v", err)
+	}
+
+	// a block already pinned goes ahead of the waiting clients
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := bm.PinContext(ctx, file.NewBlockID("testfile", 1))
+		done <- err
+	}()
+	waitForWaiters(t, bm, 1)
+	again, err := bm.PinContext(context.Background(), file.NewBlockID("testfile", 0))
+	if err != nil || again != held {
+		t.Fatalf("expected block 0 pinned again, got %v", err)
+	}
+	bm.UnPin(again)
+
+	cancel()
+	if err := <-done; !errors.Is(err, ErrBufferAbort) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v and %v, got %v", ErrBufferAbort, context.Canceled, err)
+	}
+	waitForWaiters(t, bm, 0)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := bm.PinContext(ctx, file.NewBlockID("testfile", 2)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// the buffer goes to the next client once unpinned
+	bm.UnPin(held)
+	if _, err := bm.PinContext(context.Background(), file.NewBlockID("testfile", 2)); err != nil {
+		t.Fatalf("failed to pin block 2: %v", err)
+	}
+}
+
+func TestBufferStats(t *testing.T) {
+	bm := newWaitTestManager(t, 2)
+	blk := func(n int) file.BlockID { return file.NewBlockID("testfile", n) }
+
+	b0, _ := bm.Pin(blk(0))
+	b1, _ := bm.Pin(blk(1))
+	b0.SetModified(1, -1)
+	again, _ := bm.Pin(blk(0))
+	bm.UnPin(again)
+	bm.UnPin(b0)
+
+	// replaces the dirty block 0
+	b2, err := bm.Pin(blk(2))
+	if err != nil {
+		t.Fatalf("failed to pin block 2: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := bm.PinContext(ctx, blk(3)); !errors.Is(err, ErrBufferAbort) {
+		t.Fatalf("expected %v, got %v", ErrBufferAbort, err)
+	}
+
+	expected := Stats{Hits: 1, Misses: 3, Evictions: 1, DirtyFlushes: 1, PinWaits: 1, Timeouts: 1}
+	stats := bm.Stats()
+	if stats.PinWaitTime < 20*time.Millisecond {
+		t.Fatalf("expected at least %v waiting, got %v", 20*time.Millisecond, stats.PinWaitTime)
+	}
+	stats.PinWaitTime = 0
+	if stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+
+	frames := bm.Frames()
+	for _, frame := range frames {
+		if frame.Pins != 1 || frame.Dirty || frame.ModifyingTxn != -1 {
+			t.Fatalf("expected a clean frame pinned once, got %+v", frame)
+		}
+	}
+	if frames[0].Block != b2.Block() || frames[1].Block != b1.Block() {
+		t.Fatalf("expected blocks 2 and 1, got %v and %v", frames[0].Block, frames[1].Block)
+	}
+}
+
+func TestWriteDirty(t *testing.T) {
+	bm := newWaitTestManager(t, 3)
+	blk := func(n int) file.BlockID { return file.NewBlockID("testfile", n) }
+	lm := bm.bufferPool[0].lm
+	lsn, err := lm.Append([]byte("record"))
+	if err != nil {
+		t.Fatalf("failed to append log record: %v", err)
+	}
+
+	// block 0 is durable, block 1 is still pinned, block 2's log record is not durable yet
+	buffs := make([]*Buffer, 3)
+	for i := range 3 {
+		buffs[i], _ = bm.Pin(blk(i))
+		buffs[i].SetModified(1, -1)
+	}
+	buffs[2].SetModified(1, lsn)
+	bm.UnPin(buffs[0])
+	bm.UnPin(buffs[2])
+
+	written, err := bm.WriteDirty(10)
+	if err != nil || written != 1 {
+		t.Fatalf("expected 1 buffer written, got %d: %v", written, err)
+	}
+	if buffs[0].ModifyingTxn() != -1 || buffs[1].ModifyingTxn() != 1 || buffs[2].ModifyingTxn() != 1 {
+		t.Fatalf("expected only block 0 written")
+	}
+
+	// the writer never flushes the log itself
+	if err := lm.Flush(lsn); err != nil {
+		t.Fatalf("failed to flush log: %v", err)
+	}
+	bm.UnPin(buffs[1])
+	if written, _ := bm.WriteDirty(1); written != 1 {
+		t.Fatalf("expected at most %d buffer written, got %d", 1, written)
+	}
+	if written, _ := bm.WriteDirty(10); written != 1 {
+		t.Fatalf("expected the last dirty buffer written, got %d", written)
+	}
+	if stats := bm.Stats(); stats.DirtyFlushes != 3 {
+		t.Fatalf("expected %d dirty flushes, got %d", 3, stats.DirtyFlushes)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	bm := newWaitTestManager(t, 8)
+	blk := func(n int) file.BlockID { return file.NewBlockID("testfile", n) }
+	for range 10 {
+		if _, err := bm.fm.Append("testfile"); err != nil {
+			t.Fatalf("failed to append block: %v", err)
+		}
+	}
+
+	// a hint uses at most half the unpinned buffers
+	bm.Prefetch("testfile", 0, 6)
+	bm.prefetches.Wait()
+	if stats := bm.Stats(); stats.Prefetched != 4 || stats.Misses != 0 {
+		t.Fatalf("expected %d blocks read ahead and no misses, got %+v", 4, stats)
+	}
+	checkPageTable(t, bm)
+	for i := range 4 {
+		buff, err := bm.Pin(blk(i))
+		if err != nil {
+			t.Fatalf("failed to pin block %d: %v", i, err)
+		}
+		bm.UnPin(buff)
+	}
+	if stats := bm.Stats(); stats.Hits != 4 || stats.PrefetchHits != 4 || stats.Misses != 0 {
+		t.Fatalf("expected the pins to hit the blocks read ahead, got %+v", stats)
+	}
+
+	// blocks past the end of the file are never read
+	bm.Prefetch("testfile", 9, 4)
+	bm.prefetches.Wait()
+	if stats := bm.Stats(); stats.Prefetched != 5 {
+		t.Fatalf("expected %d blocks read ahead, got %d", 5, stats.Prefetched)
+	}
+
+	// a hint never writes a modified buffer out
+	for i := range 7 {
+		buff, _ := bm.Pin(blk(i))
+		buff.SetModified(1, -1)
+		bm.UnPin(buff)
+	}
+	buff, _ := bm.Pin(blk(9))
+	buff.SetModified(1, -1)
+	bm.UnPin(buff)
+	before := bm.Stats()
+	bm.Prefetch("testfile", 7, 2)
+	bm.prefetches.Wait()
+	if stats := bm.Stats(); stats != before {
+		t.Fatalf("expected no modified buffer replaced, got %+v", stats)
+	}
+	if _, err := bm.PinContext(context.Background(), blk(7)); err != nil {
+		t.Fatalf("failed to pin block 7: %v", err)
+	}
+	checkPageTable(t, bm)
+}
+
+func TestRing(t *testing.T) {
+	bm := newWaitTestManager(t, 8)
+	blk := func(n int) file.BlockID { return file.NewBlockID("testfile", n) }
+	for i := range 4 {
+		buff, _ := bm.Pin(blk(i))
+		bm.UnPin(buff)
+	}
+
+	// a scan through a ring of 2 leaves the hot blocks and 2 free buffers alone
+	ring := NewRing(2)
+	for i := 100; i < 120; i++ {
+		buff, err := bm.PinRing(ring, blk(i))
+		if err != nil {
+			t.Fatalf("failed to pin block %d: %v", i, err)
+		}
+		bm.UnPin(buff)
+	}
+	for i := range 4 {
+		if bm.FindExistingBuffer(blk(i)) == nil {
+			t.Fatalf("expected block %d to stay in the pool", i)
+		}
+	}
+	if stats := bm.Stats(); stats.RingReuses != 18 || stats.Evictions != 18 || len(bm.freeList) != 2 {
+		t.Fatalf("expected %d buffers recycled and 2 free, got %+v with %d free", 18, stats, len(bm.freeList))
+	}
+
+	// a ring buffer still pinned is replaced by one from the pool
+	held, _ := bm.PinRing(ring, blk(200))
+	next, _ := bm.PinRing(ring, blk(201))
+	again, _ := bm.PinRing(ring, blk(202))
+	if again == held || again == next {
+		t.Fatalf("expected a pinned ring buffer to be kept")
+	}
+	checkPageTable(t, bm)
+}
+
+func TestResize(t *testing.T) {
+	bm := newWaitTestManager(t, 4)
+	blk := func(n int) file.BlockID { return file.NewBlockID("testfile", n) }
+	pinned := make([]*Buffer, 0)
+	for i := range 4 {
+		buff, _ := bm.Pin(blk(i))
+		pinned = append(pinned, buff)
+	}
+	pinned[1].SetModified(1, -1)
+	bm.UnPin(pinned[0])
+	bm.UnPin(pinned[1])
+
+	// growing adds buffers at once
+	if err := bm.Resize(6); err != nil {
+		t.Fatalf("failed to grow: %v", err)
+	}
+	if bm.Size() != 6 || bm.Available() != 4 {
+		t.Fatalf("expected 6 buffers, 4 available, got %d and %d", bm.Size(), bm.Available())
+	}
+	for i := 4; i < 6; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		buff, err := bm.PinContext(ctx, blk(i))
+		cancel()
+		if err != nil {
+			t.Fatalf("failed to pin block %d: %v", i, err)
+		}
+		pinned = append(pinned, buff)
+	}
+	checkPageTable(t, bm)
+
+	// shrinking retires the unpinned buffers now, writing the modified one out, the pinned ones later
+	if err := bm.Resize(2); err != nil {
+		t.Fatalf("failed to shrink: %v", err)
+	}
+	if bm.Size() != 4 || bm.Available() != 0 || bm.Stats().DirtyFlushes != 1 {
+		t.Fatalf("expected 4 pinned buffers left, got %d with %d available", bm.Size(), bm.Available())
+	}
+	bm.UnPin(pinned[2])
+	bm.UnPin(pinned[4])
+	if bm.Size() != 2 || bm.Available() != 0 {
+		t.Fatalf("expected 2 pinned buffers left, got %d with %d available", bm.Size(), bm.Available())
+	}
+	if bm.FindExistingBuffer(blk(3)) != pinned[3] || bm.FindExistingBuffer(blk(5)) != pinned[5] {
+		t.Fatalf("expected the pinned blocks to stay")
+	}
+	checkPageTable(t, bm)
+
+	// growing again cancels nothing left to retire, and the buffers are reused
+	bm.UnPin(pinned[3])
+	if err := bm.Resize(3); err != nil {
+		t.Fatalf("failed to grow: %v", err)
+	}
+	if bm.Size() != 3 || bm.Available() != 2 {
+		t.Fatalf("expected 3 buffers, 2 available, got %d and %d", bm.Size(), bm.Available())
+	}
+	checkPageTable(t, bm)
+
+	if err := bm.Resize(0); !errors.Is(err, ErrPoolSize) {
+		t.Fatalf("expected %v, got %v", ErrPoolSize, err)
+	}
+}
+
+func TestResizeKeepsPolicyHistory(t *testing.T) {
+	for _, policy := range []ReplacementPolicy{NewLRUPolicy(), NewLRUKPolicy(2)} {
+		fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+		if err != nil {
+			t.Fatalf("failed to create file manager: %v", err)
+		}
+		bm := NewBufferManager(fm, log.NewLogManager(fm, "logfile"), 3, WithReplacementPolicy(policy))
+		blk := func(n int) file.BlockID { return file.NewBlockID("testfile", n) }
+		use := func(n int) {
+			buff, err := bm.Pin(blk(n))
+			if err != nil {
+				t.Fatalf("%T: failed to pin block %d: %v", policy, n, err)
+			}
+			bm.UnPin(buff)
+		}
+		// block 0 is used again, after the others
+		for _, n := range []int{0, 1, 2, 0} {
+			use(n)
+		}
+		if err := bm.Resize(4); err != nil {
+			t.Fatalf("%T: failed to grow: %v", policy, err)
+		}
+		for _, n := range []int{3, 4, 5} {
+			use(n)
+		}
+		if bm.FindExistingBuffer(blk(0)) == nil {
+			t.Fatalf("%T: expected block 0 to outlive blocks 1 and 2 across the resize", policy)
+		}
+		fm.Close()
+	}
+}
+
+func TestResizeConcurrent(t *testing.T) {
+	const clients = 8
+	for _, policy := range []ReplacementPolicy{NewNaivePolicy(), NewLRUPolicy(), NewClockPolicy(), NewLRUKPolicy(2)} {
+		fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+		if err != nil {
+			t.Fatalf("failed to create file manager: %v", err)
+		}
+		bm := NewBufferManager(fm, log.NewLogManager(fm, "logfile"), 16, WithReplacementPolicy(policy))
+
+		// every client holds one pin at most, so a pool of clients buffers never runs out
+		done := make(chan struct{})
+		errs := make(chan error, clients)
+		for c := range clients {
+			go func() {
+				rnd := rand.New(rand.NewSource(int64(c)))
+				for {
+					select {
+					case <-done:
+						errs <- nil
+						return
+					default:
+					}
+					// blocks of its own, as its locks would make sure of
+					buff, err := bm.Pin(file.NewBlockID("testfile", c*100+rnd.Intn(50)))
+					if err != nil {
+						errs <- err
+						return
+					}
+					if rnd.Intn(4) == 0 {
+						buff.SetModified(1, -1)
+					}
+					bm.UnPin(buff)
+				}
+			}()
+		}
+		for _, size := range []int{8, 24, 10, 32, clients, 16} {
+			if err := bm.Resize(size); err != nil {
+				t.Fatalf("%T: failed to resize to %d: %v", policy, size, err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		close(done)
+		for range clients {
+			if err := <-errs; err != nil {
+				t.Fatalf("%T: %v", policy, err)
+			}
+		}
+
+		if bm.Size() != 16 || bm.Available() != 16 {
+			t.Fatalf("%T: expected 16 unpinned buffers, got %d with %d available", policy, bm.Size(), bm.Available())
+		}
+		checkPageTable(t, bm)
+		fm.Close()
+	}
+}
+
+func TestPinTracking(t *testing.T) {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	t.Cleanup(func() {
+		fm.Close()
+	})
+	var reports strings.Builder
+	bm := NewBufferManager(fm, log.NewLogManager(fm, "logfile"), 1, WithPinTracking(&reports))
+
+	held, err := bm.PinContext(WithPinOwner(context.Background(), 7), file.NewBlockID("testfile", 0))
+	if err != nil {
+		t.Fatalf("failed to pin block 0: %v", err)
+	}
+	pins := bm.OutstandingPins()
+	if len(pins) != 1 || pins[0].TxNum != 7 || !strings.Contains(pins[0].Stack, "TestPinTracking") {
+		t.Fatalf("expected the pin of txn 7 taken by the test, got %+v", pins)
+	}
+
+	// giving up reports who holds the pool
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := bm.PinContext(ctx, file.NewBlockID("testfile", 1)); !errors.Is(err, ErrBufferAbort) {
+		t.Fatalf("expected %v, got %v", ErrBufferAbort, err)
+	}
+	report := reports.String()
+	if !strings.Contains(report, "1 pins held") || !strings.Contains(report, "pinned by txn 7") || !strings.Contains(report, "TestPinTracking") {
+		t.Fatalf("expected a report of the pin held, got %q", report)
+	}
+
+	bm.UnPin(held)
+	if pins := bm.OutstandingPins(); len(pins) != 0 {
+		t.Fatalf("expected no pins held, got %+v", pins)
+	}
+}
+
+// unpinning a block pinned by two txns drops the pin of the txn unpinning it
+func TestPinTrackingOwners(t *testing.T) {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	t.Cleanup(func() {
+		fm.Close()
+	})
+	bm := NewBufferManager(fm, log.NewLogManager(fm, "logfile"), 2, WithPinTracking(io.Discard))
+
+	blockId := file.NewBlockID("testfile", 0)
+	buff, err := bm.PinContext(WithPinOwner(context.Background(), 1), blockId)
+	if err != nil {
+		t.Fatalf("failed to pin block 0: %v", err)
+	}
+	if _, err := bm.PinContext(WithPinOwner(context.Background(), 2), blockId); err != nil {
+		t.Fatalf("failed to pin block 0: %v", err)
+	}
+	bm.UnPinFor(buff, 1)
+	if pins := bm.OutstandingPins(); len(pins) != 1 || pins[0].TxNum != 2 {
+		t.Fatalf("expected the pin of txn 2 left, got %+v", pins)
+	}
+}
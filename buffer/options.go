@@ -0,0 +1,11 @@
+package buffer
+
+// Option configures a buffer manager when it is created
+type Option func(*Manager)
+
+// Chooses the buffers to replace with the policy, NaivePolicy unless given, every manager needs its own
+func WithReplacementPolicy(policy ReplacementPolicy) Option {
+	return func(bm *Manager) {
+		bm.policy = policy
+	}
+}
@@ -0,0 +1,151 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+/*
+Pin tracking, a debug mode for finding the pins nobody releases
+Every pin records its call stack and txn, the pins held are reported when a pin times out or a txn ends
+*/
+
+// A pin recorded while pin tracking is on
+type PinRecord struct {
+	Block file.BlockID
+	TxNum int    // -1 unless taken for a txn
+	Stack string // the calls that took the pin, innermost first
+}
+
+type pinOwnerKey struct{}
+
+// Returns a context naming the txn the pins taken with it are for
+func WithPinOwner(ctx context.Context, txnum int) context.Context {
+	return context.WithValue(ctx, pinOwnerKey{}, txnum)
+}
+
+// Turns pin tracking on, reports are written to w
+func WithPinTracking(w io.Writer) Option {
+	return func(bm *Manager) {
+		bm.pinReports = w
+		bm.tracked = make(map[*Buffer][]trackedPin)
+	}
+}
+
+// a pin record and when it was taken
+type trackedPin struct {
+	PinRecord
+	seq int
+}
+
+func (bm *Manager) PinTracking() bool {
+	return bm.pinReports != nil
+}
+
+// Returns the pins held, oldest first, nil unless pin tracking is on
+func (bm *Manager) OutstandingPins() []PinRecord {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	return bm.outstandingPins()
+}
+
+// Writes a report about the pins, if pin tracking is on
+func (bm *Manager) ReportPins(title string, pins []PinRecord) {
+	if !bm.PinTracking() {
+		return
+	}
+	var report strings.Builder
+	fmt.Fprintf(&report, "%s\n", title)
+	for _, pin := range pins {
+		fmt.Fprintf(&report, "  %v pinned by txn %d at\n", pin.Block, pin.TxNum)
+		for _, line := range strings.Split(strings.TrimSuffix(pin.Stack, "\n"), "\n") {
+			fmt.Fprintf(&report, "    %s\n", line)
+		}
+	}
+	io.WriteString(bm.pinReports, report.String())
+}
+
+// records the pin taken with the context
+func (bm *Manager) track(ctx context.Context, buff *Buffer) {
+	if !bm.PinTracking() {
+		return
+	}
+	txnum, ok := ctx.Value(pinOwnerKey{}).(int)
+	if !ok {
+		txnum = -1
+	}
+	bm.pinSeq++
+	record := PinRecord{Block: buff.Block(), TxNum: txnum, Stack: callers(1)}
+	bm.tracked[buff] = append(bm.tracked[buff], trackedPin{PinRecord: record, seq: bm.pinSeq})
+}
+
+// drops the latest record of the buffer's pins taken for the txn, or its latest record if the txn took none
+func (bm *Manager) untrack(buff *Buffer, txnum int) {
+	if !bm.PinTracking() {
+		return
+	}
+	records := bm.tracked[buff]
+	i := len(records) - 1
+	for j := i; j >= 0; j-- {
+		if records[j].TxNum == txnum {
+			i = j
+			break
+		}
+	}
+	if len(records) <= 1 {
+		delete(bm.tracked, buff)
+		return
+	}
+	bm.tracked[buff] = append(records[:i], records[i+1:]...)
+}
+
+func (bm *Manager) outstandingPins() []PinRecord {
+	if !bm.PinTracking() {
+		return nil
+	}
+	tracked := make([]trackedPin, 0)
+	for _, records := range bm.tracked {
+		tracked = append(tracked, records...)
+	}
+	sort.Slice(tracked, func(i, j int) bool { return tracked[i].seq < tracked[j].seq })
+	pins := make([]PinRecord, len(tracked))
+	for i, pin := range tracked {
+		pins[i] = pin.PinRecord
+	}
+	return pins
+}
+
+// reports the pins held when a client gives up waiting
+func (bm *Manager) reportTimeout(blockId file.BlockID) {
+	if !bm.PinTracking() {
+		return
+	}
+	pins := bm.outstandingPins()
+	bm.ReportPins(fmt.Sprintf("gave up waiting to pin %v, %d pins held:", blockId, len(pins)), pins)
+}
+
+// the stack of the caller's caller and up, skip more frames if given
+func callers(skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack strings.Builder
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, "runtime.") || strings.HasPrefix(frame.Function, "testing.") {
+			break
+		}
+		fmt.Fprintf(&stack, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return stack.String()
+}
@@ -0,0 +1,157 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+/*
+Read-ahead
+A scan reading a file in order hints the blocks it wants next, they are read in the background
+into free or clean unpinned buffers, a block whose buffer cannot be spared is not read ahead
+*/
+
+/*
+Reads up to n blocks of the file from startBlock onwards into the pool in the background
+using no more than half the unpinned buffers
+*/
+func (bm *Manager) Prefetch(filename string, startBlock int, n int) {
+	bm.startPrefetch(nil, filename, startBlock, n)
+}
+
+// the ring's buffers are used if it is not nil, the pool's otherwise
+func (bm *Manager) startPrefetch(ring *Ring, filename string, startBlock int, n int) {
+	size, err := bm.fm.Length(filename)
+	if err != nil {
+		// the pins will report it
+		return
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	n = min(n, bm.numAvailable/2, size-startBlock)
+	blocks := make([]file.BlockID, 0, max(n, 0))
+	for i := startBlock; i < startBlock+n; i++ {
+		blockId := file.NewBlockID(filename, i)
+		if bm.pageTable[blockId] != nil || bm.loading[blockId] != nil {
+			continue
+		}
+		bm.loading[blockId] = make(chan struct{})
+		blocks = append(blocks, blockId)
+	}
+	if len(blocks) == 0 {
+		return
+	}
+	bm.prefetches.Add(1)
+	go bm.prefetch(ring, blocks, bm.diskVersion)
+}
+
+/*
+Reads the blocks in turn, giving up at the first that cannot be placed in the pool
+the buffers filled are kept from the policy until the last block is in
+*/
+func (bm *Manager) prefetch(ring *Ring, blocks []file.BlockID, version int) {
+	defer bm.prefetches.Done()
+
+	installed := make([]*Buffer, 0, len(blocks))
+	defer func() {
+		bm.mu.Lock()
+		defer bm.mu.Unlock()
+
+		for _, buff := range installed {
+			// unless pinned, replaced or dropped meanwhile
+			if buff.fetched {
+				bm.policy.Unpinned(buff.index)
+			}
+		}
+		bm.wakeNext()
+	}()
+
+	page := file.NewPageWithSize(bm.fm.BlockSize())
+	for i, blockId := range blocks {
+		// read without the lock, pins of other blocks go on meanwhile
+		err := bm.fm.Read(blockId, page)
+
+		bm.mu.Lock()
+		var buff *Buffer
+		if err == nil {
+			buff = bm.install(ring, blockId, page, version)
+		}
+		if buff == nil {
+			for _, rest := range blocks[i:] {
+				bm.loaded(rest)
+			}
+			bm.mu.Unlock()
+			return
+		}
+		installed = append(installed, buff)
+		bm.loaded(blockId)
+		bm.mu.Unlock()
+	}
+}
+
+/*
+Places the block read ahead in a buffer, nil if it could not or the read is stale
+The policy sees the buffer pinned until the caller tells it otherwise
+*/
+func (bm *Manager) install(ring *Ring, blockId file.BlockID, page *file.Page, version int) *Buffer {
+	if bm.diskVersion != version || bm.pageTable[blockId] != nil {
+		// the block was pinned through TryToPin meanwhile if it is in the pool
+		return nil
+	}
+	var buff *Buffer
+	if ring != nil {
+		buff = bm.ringBuffer(ring, true)
+	} else if buff = bm.ChooseUnpinnedBuffer(); buff != nil && buff.ModifyingTxn() >= 0 {
+		// never write a buffer out for a hint
+		buff = nil
+	}
+	if buff == nil {
+		return nil
+	}
+	old := buff.Block()
+	if old.FileName() == "" {
+		bm.freeList = bm.freeList[:len(bm.freeList)-1]
+	} else {
+		delete(bm.pageTable, old)
+		bm.stats.Evictions++
+	}
+	buff.load(blockId, page)
+	bm.pageTable[blockId] = buff
+	bm.policy.Pinned(buff.index, true)
+	bm.stats.Prefetched++
+	return buff
+}
+
+// wakes the pins waiting for the block to be read ahead
+func (bm *Manager) loaded(blockId file.BlockID) {
+	close(bm.loading[blockId])
+	delete(bm.loading, blockId)
+}
+
+// waits while the block is being read ahead
+func (bm *Manager) waitForLoad(ctx context.Context, blockId file.BlockID) error {
+	for bm.loading[blockId] != nil {
+		done := bm.loading[blockId]
+		bm.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			bm.mu.Lock()
+			bm.stats.Timeouts++
+			bm.reportTimeout(blockId)
+			return fmt.Errorf("%w: %w", ErrBufferAbort, ctx.Err())
+		case <-done:
+			bm.mu.Lock()
+		}
+	}
+	return nil
+}
+
+// written a buffer to disk
+func (bm *Manager) flushed() {
+	bm.stats.DirtyFlushes++
+	bm.diskVersion++
+}
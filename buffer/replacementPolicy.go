@@ -0,0 +1,334 @@
+package buffer
+
+import (
+	"container/heap"
+	"container/list"
+	"math"
+)
+
+// Decides which unpinned buffer is given to a block that is not in the pool
+// buffers are identified by their index in the pool
+
+type ReplacementPolicy interface {
+	// called by the manager before anything else, with the size of the pool
+	Init(numBuffs int)
+	// the pool was resized, the buffer now at i was at from[i], -1 if it was added
+	Remap(from []int)
+	// the buffer was pinned, assigned reports whether it was just given a new block
+	Pinned(buffer int, assigned bool)
+	// the last pin of the buffer was released, may come again for a buffer already unpinned
+	Unpinned(buffer int)
+	// chooses the unpinned buffer to replace, -1 if every buffer is pinned
+	Victim(pool []*Buffer) int
+}
+
+// Chooses the first unpinned buffer in pool order
+// Cheap, but the buffers at the front of the pool are replaced over and over, hot or not
+type NaivePolicy struct {
+	unpinned *victimHeap
+}
+
+func NewNaivePolicy() *NaivePolicy {
+	return &NaivePolicy{}
+}
+
+func (p *NaivePolicy) Init(numBuffs int) {
+	p.unpinned = newVictimHeap(numBuffs, func(a int, b int) bool { return a < b })
+}
+
+func (p *NaivePolicy) Remap(from []int) {
+	old := p.unpinned
+	p.Init(len(from))
+	for i, j := range from {
+		if j >= 0 && old.index[j] < 0 {
+			p.unpinned.remove(i)
+		}
+	}
+}
+
+func (p *NaivePolicy) Pinned(buffer int, assigned bool) {
+	p.unpinned.remove(buffer)
+}
+
+func (p *NaivePolicy) Unpinned(buffer int) {
+	p.unpinned.add(buffer)
+}
+
+func (p *NaivePolicy) Victim(pool []*Buffer) int {
+	return p.unpinned.head()
+}
+
+// Chooses the unpinned buffer least recently used, i.e. unpinned the longest time ago
+type LRUPolicy struct {
+	unpinned *list.List      // least recently unpinned first
+	elements []*list.Element // element of every unpinned buffer, nil while pinned
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{}
+}
+
+func (p *LRUPolicy) Init(numBuffs int) {
+	p.unpinned = list.New()
+	p.elements = make([]*list.Element, numBuffs)
+	for i := range numBuffs {
+		p.elements[i] = p.unpinned.PushBack(i)
+	}
+}
+
+func (p *LRUPolicy) Remap(from []int) {
+	to := make([]int, len(p.elements))
+	for i := range to {
+		to[i] = -1
+	}
+	for i, j := range from {
+		if j >= 0 {
+			to[j] = i
+		}
+	}
+	unpinned := p.unpinned
+	p.unpinned = list.New()
+	p.elements = make([]*list.Element, len(from))
+	// added buffers hold no block, they go first
+	for i, j := range from {
+		if j < 0 {
+			p.elements[i] = p.unpinned.PushBack(i)
+		}
+	}
+	for e := unpinned.Front(); e != nil; e = e.Next() {
+		if i := to[e.Value.(int)]; i >= 0 {
+			p.elements[i] = p.unpinned.PushBack(i)
+		}
+	}
+}
+
+func (p *LRUPolicy) Pinned(buffer int, assigned bool) {
+	if p.elements[buffer] != nil {
+		p.unpinned.Remove(p.elements[buffer])
+		p.elements[buffer] = nil
+	}
+}
+
+func (p *LRUPolicy) Unpinned(buffer int) {
+	if p.elements[buffer] == nil {
+		p.elements[buffer] = p.unpinned.PushBack(buffer)
+	}
+}
+
+func (p *LRUPolicy) Victim(pool []*Buffer) int {
+	if p.unpinned.Len() == 0 {
+		return -1
+	}
+	return p.unpinned.Front().Value.(int)
+}
+
+/*
+Approximates LRU with one reference bit per buffer
+A hand sweeps the pool, clearing set bits, and replaces the first unpinned buffer without one
+*/
+type ClockPolicy struct {
+	hand       int
+	referenced []bool
+	pinned     []bool // as the manager reported, a buffer being read ahead counts as pinned
+}
+
+func NewClockPolicy() *ClockPolicy {
+	return &ClockPolicy{}
+}
+
+func (p *ClockPolicy) Init(numBuffs int) {
+	p.hand = 0
+	p.referenced = make([]bool, numBuffs)
+	p.pinned = make([]bool, numBuffs)
+}
+
+func (p *ClockPolicy) Remap(from []int) {
+	referenced, pinned := p.referenced, p.pinned
+	p.Init(len(from))
+	for i, j := range from {
+		if j >= 0 {
+			p.referenced[i] = referenced[j]
+			p.pinned[i] = pinned[j]
+		}
+	}
+}
+
+func (p *ClockPolicy) Pinned(buffer int, assigned bool) {
+	p.referenced[buffer] = true
+	p.pinned[buffer] = true
+}
+
+func (p *ClockPolicy) Unpinned(buffer int) {
+	p.referenced[buffer] = true
+	p.pinned[buffer] = false
+}
+
+func (p *ClockPolicy) Victim(pool []*Buffer) int {
+	// after one turn every bit of an unpinned buffer is clear, a second turn finds one
+	for range 2 * len(p.pinned) {
+		i := p.hand
+		p.hand = (p.hand + 1) % len(p.pinned)
+		if p.pinned[i] {
+			continue
+		}
+		if p.referenced[i] {
+			p.referenced[i] = false
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+/*
+Chooses the unpinned buffer whose k-th most recent pin is the oldest
+blocks pinned fewer than k times, like those of a scan, go first, ties go by the most recent pin
+*/
+type LRUKPolicy struct {
+	k        int
+	clock    int
+	history  [][]int // clock values of the last k pins of the buffer's block, most recent first
+	unpinned *victimHeap
+}
+
+// k of 2 is the usual choice, k of 1 is plain LRU on pins
+func NewLRUKPolicy(k int) *LRUKPolicy {
+	return &LRUKPolicy{k: max(k, 1)}
+}
+
+func (p *LRUKPolicy) Init(numBuffs int) {
+	p.clock = 0
+	p.history = make([][]int, numBuffs)
+	p.unpinned = newVictimHeap(numBuffs, p.before)
+}
+
+func (p *LRUKPolicy) Remap(from []int) {
+	history, unpinned := p.history, p.unpinned
+	p.history = make([][]int, len(from))
+	for i, j := range from {
+		if j >= 0 {
+			p.history[i] = history[j]
+		}
+	}
+	p.unpinned = newVictimHeap(len(from), p.before)
+	for i, j := range from {
+		if j >= 0 && unpinned.index[j] < 0 {
+			p.unpinned.remove(i)
+		}
+	}
+}
+
+func (p *LRUKPolicy) Pinned(buffer int, assigned bool) {
+	p.unpinned.remove(buffer)
+	p.clock++
+	if assigned {
+		// the history belonged to the block replaced
+		p.history[buffer] = p.history[buffer][:0]
+	}
+	if len(p.history[buffer]) < p.k {
+		p.history[buffer] = append(p.history[buffer], 0)
+	}
+	copy(p.history[buffer][1:], p.history[buffer])
+	p.history[buffer][0] = p.clock
+}
+
+func (p *LRUKPolicy) Unpinned(buffer int) {
+	p.unpinned.add(buffer)
+}
+
+func (p *LRUKPolicy) Victim(pool []*Buffer) int {
+	return p.unpinned.head()
+}
+
+// reports whether buffer a should be replaced before buffer b
+func (p *LRUKPolicy) before(a int, b int) bool {
+	if ka, kb := p.kthPin(a), p.kthPin(b); ka != kb {
+		return ka < kb
+	}
+	if la, lb := p.lastPin(a), p.lastPin(b); la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// clock value of the k-th most recent pin, -inf if there were fewer
+func (p *LRUKPolicy) kthPin(buffer int) int {
+	if len(p.history[buffer]) < p.k {
+		return math.MinInt
+	}
+	return p.history[buffer][p.k-1]
+}
+
+// clock value of the most recent pin, 0 if never pinned
+func (p *LRUKPolicy) lastPin(buffer int) int {
+	if len(p.history[buffer]) == 0 {
+		return 0
+	}
+	return p.history[buffer][0]
+}
+
+// The unpinned buffers of the pool, ordered so the head is the one to replace first
+// A buffer's order may only change while it is out of the heap, i.e. pinned
+type victimHeap struct {
+	buffers []int
+	index   []int // position of every buffer in buffers, -1 while it is pinned
+	less    func(a int, b int) bool
+}
+
+// starts with every buffer unpinned
+func newVictimHeap(numBuffs int, less func(a int, b int) bool) *victimHeap {
+	h := &victimHeap{
+		buffers: make([]int, numBuffs),
+		index:   make([]int, numBuffs),
+		less:    less,
+	}
+	for i := range numBuffs {
+		h.buffers[i] = i
+		h.index[i] = i
+	}
+	heap.Init(h)
+	return h
+}
+
+func (h *victimHeap) add(buffer int) {
+	if h.index[buffer] < 0 {
+		heap.Push(h, buffer)
+	}
+}
+
+func (h *victimHeap) remove(buffer int) {
+	if h.index[buffer] >= 0 {
+		heap.Remove(h, h.index[buffer])
+	}
+}
+
+// the buffer to replace first, -1 if every buffer is pinned
+func (h *victimHeap) head() int {
+	if len(h.buffers) == 0 {
+		return -1
+	}
+	return h.buffers[0]
+}
+
+// heap.Interface, use add and remove instead
+
+func (h *victimHeap) Len() int           { return len(h.buffers) }
+func (h *victimHeap) Less(i, j int) bool { return h.less(h.buffers[i], h.buffers[j]) }
+
+func (h *victimHeap) Swap(i, j int) {
+	h.buffers[i], h.buffers[j] = h.buffers[j], h.buffers[i]
+	h.index[h.buffers[i]] = i
+	h.index[h.buffers[j]] = j
+}
+
+func (h *victimHeap) Push(x any) {
+	h.index[x.(int)] = len(h.buffers)
+	h.buffers = append(h.buffers, x.(int))
+}
+
+func (h *victimHeap) Pop() any {
+	last := h.buffers[len(h.buffers)-1]
+	h.buffers = h.buffers[:len(h.buffers)-1]
+	h.index[last] = -1
+	return last
+}
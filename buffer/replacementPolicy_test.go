@@ -0,0 +1,145 @@
+package buffer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+)
+
+const (
+	policyPoolSize = 10
+	hotBlocks      = 6
+	coldBlocks     = 200
+)
+
+// pins and unpins the blocks one at a time, returns how many were already in the pool
+func runWorkload(t *testing.T, policy ReplacementPolicy, blocks []file.BlockID) int {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+	if err != nil {
+		t.Fatalf("failed to open file manager: %v", err)
+	}
+	t.Cleanup(func() {
+		fm.Close()
+	})
+	lm := log.NewLogManager(fm, "logfile")
+	bm := NewBufferManager(fm, lm, policyPoolSize, WithReplacementPolicy(policy))
+	for range hotBlocks + coldBlocks {
+		if _, err := fm.Append("testfile"); err != nil {
+			t.Fatalf("failed to append block: %v", err)
+		}
+	}
+
+	hits := 0
+	for _, blk := range blocks {
+		if bm.FindExistingBuffer(blk) != nil {
+			hits++
+		}
+		buff, err := bm.Pin(blk)
+		if err != nil {
+			t.Fatalf("failed to pin %v: %v", blk, err)
+		}
+		bm.UnPin(buff)
+	}
+	return hits
+}
+
+// hot blocks get most of the pins, a scan over the cold blocks runs through them
+// the scan is already running when the hot blocks are first pinned
+func skewedWorkload() []file.BlockID {
+	rnd := rand.New(rand.NewSource(1))
+	blocks := make([]file.BlockID, 0)
+	for i := range policyPoolSize {
+		blocks = append(blocks, file.NewBlockID("testfile", hotBlocks+i))
+	}
+	scan := policyPoolSize
+	for range 5000 {
+		if rnd.Intn(100) < 70 {
+			blocks = append(blocks, file.NewBlockID("testfile", rnd.Intn(hotBlocks)))
+		} else {
+			blocks = append(blocks, file.NewBlockID("testfile", hotBlocks+scan))
+			scan = (scan + 1) % coldBlocks
+		}
+	}
+	return blocks
+}
+
+func TestReplacementPolicyHitRates(t *testing.T) {
+	blocks := skewedWorkload()
+	naive := runWorkload(t, NewNaivePolicy(), blocks)
+	lru := runWorkload(t, NewLRUPolicy(), blocks)
+	clock := runWorkload(t, NewClockPolicy(), blocks)
+	lruK := runWorkload(t, NewLRUKPolicy(2), blocks)
+	t.Logf("hits out of %d pins: naive %d, lru %d, clock %d, lru-2 %d", len(blocks), naive, lru, clock, lruK)
+
+	if lru <= naive {
+		t.Fatalf("expected lru to hit more than naive's %d, got %d", naive, lru)
+	}
+	if clock <= naive {
+		t.Fatalf("expected clock to hit more than naive's %d, got %d", naive, clock)
+	}
+	// the scan pushes hot blocks out of lru, not out of lru-2
+	if lruK <= lru {
+		t.Fatalf("expected lru-2 to hit more than lru's %d, got %d", lru, lruK)
+	}
+}
+
+func TestReplacementPolicyPinnedBuffers(t *testing.T) {
+	for _, policy := range []ReplacementPolicy{NewNaivePolicy(), NewLRUPolicy(), NewClockPolicy(), NewLRUKPolicy(2)} {
+		fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+		if err != nil {
+			t.Fatalf("failed to open file manager: %v", err)
+		}
+		lm := log.NewLogManager(fm, "logfile")
+		bm := NewBufferManager(fm, lm, 3, WithReplacementPolicy(policy))
+
+		pinned := make([]*Buffer, 0)
+		for i := range 3 {
+			buff, err := bm.Pin(file.NewBlockID("testfile", i))
+			if err != nil {
+				t.Fatalf("failed to pin block %d: %v", i, err)
+			}
+			pinned = append(pinned, buff)
+		}
+		if buff := bm.ChooseUnpinnedBuffer(); buff != nil {
+			t.Fatalf("%T: expected no buffer while all are pinned, got %v", policy, buff.Block())
+		}
+		// the only unpinned buffer is the victim
+		bm.UnPin(pinned[1])
+		if buff := bm.ChooseUnpinnedBuffer(); buff != pinned[1] {
+			t.Fatalf("%T: expected the buffer of block 1", policy)
+		}
+		fm.Close()
+	}
+}
+
+// a buffer reported pinned is never the victim, even while nobody holds a pin on it
+// as is the case for a buffer being read ahead
+func TestReplacementPolicyReportedPins(t *testing.T) {
+	for _, policy := range []ReplacementPolicy{NewNaivePolicy(), NewLRUPolicy(), NewClockPolicy(), NewLRUKPolicy(2)} {
+		fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+		if err != nil {
+			t.Fatalf("failed to open file manager: %v", err)
+		}
+		lm := log.NewLogManager(fm, "logfile")
+		pool := make([]*Buffer, 3)
+		for i := range pool {
+			pool[i] = NewBuffer(fm, lm)
+		}
+
+		policy.Init(len(pool))
+		policy.Pinned(0, true)
+		policy.Pinned(1, true)
+		for range 2 * len(pool) {
+			if victim := policy.Victim(pool); victim != 2 {
+				t.Fatalf("%T: expected buffer %d as the victim, got %d", policy, 2, victim)
+			}
+		}
+		policy.Pinned(2, true)
+		if victim := policy.Victim(pool); victim != -1 {
+			t.Fatalf("%T: expected no victim while all are pinned, got %d", policy, victim)
+		}
+		fm.Close()
+	}
+}
@@ -0,0 +1,111 @@
+package buffer
+
+import "fmt"
+
+/*
+Resizing the pool while it is in use
+Growing adds buffers at once, shrinking retires unpinned buffers now and pinned ones as they are unpinned
+*/
+
+/*
+Changes the number of buffers in the pool to n
+Returns the error writing out a retired buffer, the pool keeps the buffers not retired yet
+*/
+func (bm *Manager) Resize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("%w: resize to %d", ErrPoolSize, n)
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if n >= len(bm.bufferPool) {
+		bm.retiring = 0
+		bm.grow(n - len(bm.bufferPool))
+		return nil
+	}
+	bm.retiring = len(bm.bufferPool) - n
+	return bm.retire()
+}
+
+func (bm *Manager) grow(count int) {
+	if count == 0 {
+		return
+	}
+	for range count {
+		buf := NewBuffer(bm.fm, bm.lm)
+		buf.index = -1
+		bm.bufferPool = append(bm.bufferPool, buf)
+		bm.freeList = append(bm.freeList, buf)
+		bm.numAvailable++
+	}
+	bm.renumber()
+	bm.wakeNext()
+}
+
+// retires unpinned buffers until no more are due
+func (bm *Manager) retire() error {
+	if bm.retiring == 0 {
+		return nil
+	}
+	retired := make(map[*Buffer]bool)
+	var err error
+	// cheapest first: no block, then a clean block, then a modified one
+passes:
+	for pass := range 3 {
+		for i := len(bm.bufferPool) - 1; i >= 0 && len(retired) < bm.retiring; i-- {
+			buf := bm.bufferPool[i]
+			if retired[buf] || buf.IsPinned() {
+				continue
+			}
+			free := buf.Block().FileName() == ""
+			dirty := buf.ModifyingTxn() >= 0
+			if (pass == 0 && !free) || (pass == 1 && (free || dirty)) {
+				continue
+			}
+			if dirty {
+				if err = buf.flush(); err != nil {
+					break passes
+				}
+				bm.flushed()
+			}
+			retired[buf] = true
+		}
+	}
+	if len(retired) == 0 {
+		return err
+	}
+
+	pool := make([]*Buffer, 0, len(bm.bufferPool)-len(retired))
+	for _, buf := range bm.bufferPool {
+		if !retired[buf] {
+			pool = append(pool, buf)
+			continue
+		}
+		if blk := buf.Block(); blk.FileName() != "" {
+			delete(bm.pageTable, blk)
+		}
+		buf.discard()
+		buf.index = -1
+		bm.numAvailable--
+	}
+	bm.bufferPool = pool
+	bm.retiring -= len(retired)
+	bm.renumber()
+	return err
+}
+
+// numbers the buffers in pool order, rebuilds the free list and tells the policy where each buffer was
+func (bm *Manager) renumber() {
+	from := make([]int, len(bm.bufferPool))
+	bm.freeList = bm.freeList[:0]
+	for i := len(bm.bufferPool) - 1; i >= 0; i-- {
+		buf := bm.bufferPool[i]
+		from[i] = buf.index
+		buf.index = i
+		if buf.Block().FileName() == "" {
+			bm.freeList = append(bm.freeList, buf)
+		}
+	}
+	bm.policy.Remap(from)
+}
@@ -0,0 +1,111 @@
+package buffer
+
+import (
+	"context"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+/*
+A ring of buffers recycled by a large sequential scan
+The scan's misses reuse the ring's buffers in turn, so the hot blocks of the pool stay in
+*/
+type Ring struct {
+	buffers []*Buffer // nil until the ring is full
+	next    int       // position of the buffer to recycle next
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{buffers: make([]*Buffer, max(size, 1))}
+}
+
+func (r *Ring) Size() int {
+	return len(r.buffers)
+}
+
+/*
+Pins a buffer to the block like Pin, recycling the ring's next buffer if the block is not in the pool
+If that buffer is still pinned a buffer of the pool takes its place in the ring
+*/
+func (bm *Manager) PinRing(ring *Ring, blockId file.BlockID) (*Buffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), MAX_TIME)
+	defer cancel()
+	return bm.PinRingContext(ctx, ring, blockId)
+}
+
+// Pins like PinRing, waiting for a buffer for as long as the context allows, see PinContext
+func (bm *Manager) PinRingContext(ctx context.Context, ring *Ring, blockId file.BlockID) (*Buffer, error) {
+	buff, err := bm.tryToPinRing(ctx, ring, blockId)
+	if buff != nil || err != nil {
+		return buff, err
+	}
+	// every buffer is pinned or other clients are waiting for one
+	return bm.PinContext(ctx, blockId)
+}
+
+func (bm *Manager) tryToPinRing(ctx context.Context, ring *Ring, blockId file.BlockID) (*Buffer, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if err := bm.waitForLoad(ctx, blockId); err != nil {
+		return nil, err
+	}
+	if buff := bm.FindExistingBuffer(blockId); buff != nil {
+		bm.pin(buff, false)
+		bm.track(ctx, buff)
+		return buff, nil
+	}
+	buff := bm.ringBuffer(ring, false)
+	if buff == nil {
+		return nil, nil
+	}
+	if err := bm.assign(buff, blockId); err != nil {
+		return nil, err
+	}
+	bm.pin(buff, true)
+	bm.track(ctx, buff)
+	return buff, nil
+}
+
+/*
+Reads ahead like Prefetch, into the ring's buffers
+Stops at a ring buffer that is pinned, modified or holding a block read ahead and not used yet
+*/
+func (bm *Manager) PrefetchRing(ring *Ring, filename string, startBlock int, n int) {
+	bm.startPrefetch(ring, filename, startBlock, min(n, ring.Size()-1))
+}
+
+/*
+Takes the ring's next buffer for a block, nil if there is none to spare
+A buffer still in use is replaced in the ring by one from the pool, unless for a hint or clients are waiting
+*/
+func (bm *Manager) ringBuffer(ring *Ring, hint bool) *Buffer {
+	slot := ring.next
+	buff := ring.buffers[slot]
+	if buff != nil && bm.recyclable(buff, hint) {
+		bm.stats.RingReuses++
+	} else {
+		if buff != nil && hint {
+			return nil
+		}
+		if !hint && bm.waiters.Len() > 0 {
+			return nil
+		}
+		buff = bm.ChooseUnpinnedBuffer()
+		if buff == nil || (hint && buff.ModifyingTxn() >= 0) {
+			return nil
+		}
+		ring.buffers[slot] = buff
+	}
+	ring.next = (slot + 1) % len(ring.buffers)
+	return buff
+}
+
+// reports whether the ring may give its buffer another block
+func (bm *Manager) recyclable(buff *Buffer, hint bool) bool {
+	if buff.IsPinned() || buff.fetched || buff.Block().FileName() == "" || buff.index < 0 {
+		return false
+	}
+	// never write a buffer out for a hint
+	return !hint || buff.ModifyingTxn() < 0
+}
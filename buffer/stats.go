@@ -0,0 +1,55 @@
+package buffer
+
+import (
+	"time"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+// Counters of the buffer manager since it was created, to size the pool by
+type Stats struct {
+	Hits         int // pins finding their block in the pool
+	Misses       int // pins reading their block into a buffer
+	Evictions    int // blocks replaced by another block
+	DirtyFlushes int // modified buffers written to disk
+	PinWaits     int // pins that had to wait for a buffer
+	PinWaitTime  time.Duration
+	Timeouts     int // pins giving up waiting
+	Prefetched   int // blocks read ahead of their pins
+	PrefetchHits int // pins finding their block read ahead, counted as hits too
+	RingReuses   int // buffers a ring gave another block
+}
+
+// What a buffer of the pool holds
+type FrameInfo struct {
+	Index        int          // position in the pool
+	Block        file.BlockID // block number -1 if the buffer holds no block
+	Pins         int
+	Dirty        bool
+	ModifyingTxn int // -1 unless dirty
+}
+
+func (bm *Manager) Stats() Stats {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	return bm.stats
+}
+
+// Returns what every buffer of the pool holds, in pool order
+func (bm *Manager) Frames() []FrameInfo {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	frames := make([]FrameInfo, len(bm.bufferPool))
+	for i, buf := range bm.bufferPool {
+		frames[i] = FrameInfo{
+			Index:        i,
+			Block:        buf.Block(),
+			Pins:         buf.pins,
+			Dirty:        buf.txnum >= 0,
+			ModifyingTxn: buf.txnum,
+		}
+	}
+	return frames
+}
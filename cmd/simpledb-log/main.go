@@ -0,0 +1,343 @@
+/*
+Simpledb-log lists the records of a database's write-ahead log, oldest first
+
+	simpledb-log [flags] dbdir
+
+The database is opened read-only and without taking its lock, so it can be inspected while it is in use,
+and a torn log tail is skipped without being repaired.
+Every record is shown with its lsn, type and transaction,
+updates also with the block, offset and the values before and after, replaced bytes in hex,
+page images with the block and the offset of the slice.
+
+	-tx 7               only the records of transaction 7
+	-type commit,rollback
+	                    only records of these types
+	-block emp.tbl:3    only updates of block 3 of emp.tbl, -block emp.tbl for any block of it
+	-summary            one line per transaction with its outcome instead of the records
+	-json               one JSON object per line
+
+The block size is read from the database's superblock, -blocksize overrides it.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+	"github.com/nitishsharma2825/simpleDB/record"
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+// outcomes of a transaction in the summary
+const (
+	COMMITTED   = "committed"
+	ROLLED_BACK = "rolled back"
+	INCOMPLETE  = "incomplete" // recovery undoes it
+)
+
+// a log record as it is listed
+type entry struct {
+	LSN    int    `json:"lsn"`
+	Type   string `json:"type"`
+	TxNum  int    `json:"txnum"`
+	File   string `json:"file,omitempty"`
+	Block  *int   `json:"block,omitempty"`
+	Offset *int   `json:"offset,omitempty"`
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// what the log says about a transaction
+type txnSummary struct {
+	TxNum    int    `json:"txnum"`
+	Outcome  string `json:"outcome"`
+	FirstLSN int    `json:"first_lsn"`
+	LastLSN  int    `json:"last_lsn"`
+	Updates  int    `json:"updates"`
+	listed   bool   // one of its records passed the filters
+}
+
+type filters struct {
+	txnum     int // -1 for every transaction
+	ops       map[int]bool
+	blockFile string
+	blockNum  int // -1 for every block of the file
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "simpledb-log:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("simpledb-log", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: simpledb-log [flags] dbdir")
+		flags.PrintDefaults()
+	}
+	blockSize := flags.Int("blocksize", 0, "block size the database was created with, read from its superblock unless given")
+	logFile := flags.String("log", record.LOG_FILE, "name of the log file")
+	key := flags.String("key", "", "encryption key of the database, in hex")
+	txnum := flags.Int("tx", -1, "only list the records of this transaction")
+	types := flags.String("type", "", "only list records of these types, comma separated, e.g. setint,commit")
+	block := flags.String("block", "", "only list updates of this block, file:block or file for any block of it")
+	summary := flags.Bool("summary", false, "summarize the outcome of every transaction instead of listing records")
+	asJSON := flags.Bool("json", false, "write one JSON object per line")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	f, err := parseFilters(*txnum, *types, *block)
+	if err != nil {
+		return err
+	}
+	opts := []file.Option{file.WithoutLock()}
+	if *key != "" {
+		keyBytes, err := hex.DecodeString(*key)
+		if err != nil {
+			return fmt.Errorf("-key: %w", err)
+		}
+		opts = append(opts, file.WithEncryptionKey(keyBytes))
+	}
+
+	dir := flags.Arg(0)
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	storage, err := file.NewOSStorage(dir)
+	if err != nil {
+		return err
+	}
+	if *blockSize == 0 {
+		sb, err := file.ReadSuperblock(storage)
+		if err != nil {
+			return err
+		}
+		*blockSize = sb.BlockSize
+	}
+	fm, err := file.NewFileManagerWithStorage(storage, *blockSize, opts...)
+	if err != nil {
+		return err
+	}
+	defer fm.Close()
+	lm, err := log.OpenLogManager(fm, *logFile)
+	if err != nil {
+		return err
+	}
+
+	entries, summaries, err := readLog(lm, f)
+	// list what was read before the error, it is most likely what is being looked for
+	var werr error
+	if *summary {
+		werr = writeSummaries(stdout, summaries, *asJSON)
+	} else {
+		werr = writeEntries(stdout, entries, *asJSON)
+	}
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+func parseFilters(txnum int, types string, block string) (*filters, error) {
+	f := &filters{txnum: txnum, blockNum: -1}
+	if types != "" {
+		f.ops = make(map[int]bool)
+		for _, name := range strings.Split(types, ",") {
+			op, ok := tx.ParseOp(strings.TrimSpace(name))
+			if !ok {
+				return nil, fmt.Errorf("-type: unknown log record type %q", name)
+			}
+			f.ops[op] = true
+		}
+	}
+	if block != "" {
+		f.blockFile = block
+		if filename, num, ok := strings.Cut(block, ":"); ok {
+			blockNum, err := strconv.Atoi(num)
+			if err != nil || blockNum < 0 {
+				return nil, fmt.Errorf("-block: bad block number %q", num)
+			}
+			f.blockFile, f.blockNum = filename, blockNum
+		}
+	}
+	return f, nil
+}
+
+func (f *filters) match(e *entry) bool {
+	if f.txnum >= 0 && e.TxNum != f.txnum {
+		return false
+	}
+	if f.ops != nil {
+		if op, _ := tx.ParseOp(e.Type); !f.ops[op] {
+			return false
+		}
+	}
+	if f.blockFile != "" {
+		if e.File != f.blockFile || (f.blockNum >= 0 && *e.Block != f.blockNum) {
+			return false
+		}
+	}
+	return true
+}
+
+// reads the whole log, returns the records passing the filters
+// and the summaries of the transactions they belong to, by transaction number
+func readLog(lm *log.Manager, f *filters) ([]entry, []*txnSummary, error) {
+	entries := make([]entry, 0)
+	txns := make(map[int]*txnSummary)
+
+	reader, err := lm.Reader()
+	if err == nil {
+		for reader.HasNext() {
+			var buf []byte
+			buf, err = reader.Next()
+			if err != nil {
+				break
+			}
+			var logRecord tx.LogRecord
+			logRecord, err = tx.CreateLogRecord(buf)
+			if err != nil {
+				err = fmt.Errorf("log record %d: %w", reader.LSN(), err)
+				break
+			}
+			e := newEntry(reader.LSN(), logRecord)
+
+			txn := txns[e.TxNum]
+			if logRecord.Op() != tx.CHECKPOINT && txn == nil {
+				txn = &txnSummary{TxNum: e.TxNum, Outcome: INCOMPLETE, FirstLSN: e.LSN}
+				txns[e.TxNum] = txn
+			}
+			if txn != nil {
+				txn.LastLSN = e.LSN
+				switch logRecord.Op() {
+				case tx.COMMIT:
+					txn.Outcome = COMMITTED
+				case tx.ROLLBACK:
+					txn.Outcome = ROLLED_BACK
+				case tx.SETINT, tx.SETSTRING, tx.SETBYTES:
+					txn.Updates++
+				}
+			}
+			if f.match(&e) {
+				entries = append(entries, e)
+				if txn != nil {
+					txn.listed = true
+				}
+			}
+		}
+	}
+
+	summaries := make([]*txnSummary, 0)
+	for _, txn := range txns {
+		if txn.listed {
+			summaries = append(summaries, txn)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].TxNum < summaries[j].TxNum })
+	return entries, summaries, err
+}
+
+func newEntry(lsn int, logRecord tx.LogRecord) entry {
+	e := entry{LSN: lsn, Type: tx.OpName(logRecord.Op()), TxNum: logRecord.TxNumber()}
+	if update, ok := logRecord.(tx.UpdateRecord); ok {
+		blockNum, offset := update.Block().BlockNumber(), update.Offset()
+		e.File = update.Block().FileName()
+		e.Block = &blockNum
+		e.Offset = &offset
+		e.Old = update.OldValue()
+		e.New = update.NewValue()
+	} else if image, ok := logRecord.(*tx.PageImageRecord); ok {
+		blockNum, offset := image.Block().BlockNumber(), image.Offset()
+		e.File = image.Block().FileName()
+		e.Block = &blockNum
+		e.Offset = &offset
+	}
+	return e
+}
+
+func writeEntries(w io.Writer, entries []entry, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LSN\tTYPE\tTX\tBLOCK\tOFFSET\tOLD\tNEW")
+	for _, e := range entries {
+		txnum := strconv.Itoa(e.TxNum)
+		if e.TxNum < 0 {
+			txnum = "-"
+		}
+		if e.Block == nil {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t\t\t\t\n", e.LSN, e.Type, txnum)
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s:%d\t%d\t%s\t%s\n", e.LSN, e.Type, txnum, e.File, *e.Block, *e.Offset, formatValue(e.Old), formatValue(e.New))
+	}
+	return tw.Flush()
+}
+
+func writeSummaries(w io.Writer, summaries []*txnSummary, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		for _, txn := range summaries {
+			if err := encoder.Encode(txn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TX\tOUTCOME\tFIRST LSN\tLAST LSN\tUPDATES")
+	for _, txn := range summaries {
+		counts[txn.Outcome]++
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\n", txn.TxNum, txn.Outcome, txn.FirstLSN, txn.LastLSN, txn.Updates)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d transactions: %d %s, %d %s, %d %s\n",
+		len(summaries), counts[COMMITTED], COMMITTED, counts[ROLLED_BACK], ROLLED_BACK, counts[INCOMPLETE], INCOMPLETE)
+	return err
+}
+
+// strings are quoted so an empty one still shows
+func formatValue(value any) string {
+	if value == nil {
+		return "" // page images carry no values
+	}
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	if b, ok := value.([]byte); ok {
+		return hex.EncodeToString(b)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/record"
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+// a database with one committed, one rolled back and one incomplete transaction
+func setupLogDB(t *testing.T) (string, [3]int) {
+	dir := path.Join(t.TempDir(), "db")
+	db := record.NewSimpleDB(dir)
+	planner := db.Planner()
+
+	tx := db.NewTx()
+	planner.ExecuteUpdate("create table emp(id int, name varchar(10))", tx)
+	tx.Commit()
+
+	committed := db.NewTx()
+	planner.ExecuteUpdate("insert into emp(id, name) values (1, 'ann')", committed)
+	committed.Commit()
+
+	rolledBack := db.NewTx()
+	planner.ExecuteUpdate("insert into emp(id, name) values (2, 'bob')", rolledBack)
+	rolledBack.Rollback()
+
+	incomplete := db.NewTx()
+	planner.ExecuteUpdate("insert into emp(id, name) values (3, 'cid')", incomplete)
+	if err := db.LogMgr().Flush(db.LogMgr().LatestLSN()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// the copy is what a crash would leave behind
+	crashed := path.Join(t.TempDir(), "crashed")
+	if err := os.CopyFS(crashed, os.DirFS(dir)); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	incomplete.Rollback()
+	db.Close()
+	dir = crashed
+	return dir, [3]int{committed.TxNum(), rolledBack.TxNum(), incomplete.TxNum()}
+}
+
+func TestListRecords(t *testing.T) {
+	dir, txnums := setupLogDB(t)
+
+	var out, errOut bytes.Buffer
+	if err := run([]string{"-json", "-tx", strconv.Itoa(txnums[0]), dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	lastLSN := 0
+	updates := 0
+	images := 0
+	for _, line := range lines {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if e.TxNum != txnums[0] {
+			t.Fatalf("expected tx %d, got %s", txnums[0], line)
+		}
+		if e.LSN <= lastLSN {
+			t.Fatalf("expected lsns in increasing order, got %d after %d", e.LSN, lastLSN)
+		}
+		lastLSN = e.LSN
+		if e.Type == "SETSTRING" && e.File == "emp.tbl" && e.New == "ann" {
+			updates++
+		}
+		if e.Type == "PAGEIMAGE" && e.File == "emp.tbl" && *e.Block == 0 {
+			images++
+		}
+	}
+	if first, last := lines[0], lines[len(lines)-1]; !strings.Contains(first, `"START"`) || !strings.Contains(last, `"COMMIT"`) {
+		t.Fatalf("expected START to COMMIT, got %s to %s", first, last)
+	}
+	if updates != 1 {
+		t.Fatalf("expected %d update writing ann, got %d", 1, updates)
+	}
+	// the new block is logged before it is first changed
+	if images != tx.PAGE_IMAGE_SLICES {
+		t.Fatalf("expected %d page image slices of emp.tbl:0, got %d", tx.PAGE_IMAGE_SLICES, images)
+	}
+
+	out.Reset()
+	if err := run([]string{"-type", "commit,rollback", "-block", "emp.tbl:0", dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	// only the header, commits and rollbacks touch no block
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 {
+		t.Fatalf("expected %d line, got %d: %s", 1, len(lines), out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"-type", "rollback", dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "ROLLBACK") {
+		t.Fatalf("expected the header and %d ROLLBACK, got %s", 1, out.String())
+	}
+}
+
+func TestSummary(t *testing.T) {
+	dir, txnums := setupLogDB(t)
+
+	var out, errOut bytes.Buffer
+	if err := run([]string{"-summary", "-json", "-block", "emp.tbl", dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	outcomes := make(map[int]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var txn txnSummary
+		if err := json.Unmarshal([]byte(line), &txn); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		outcomes[txn.TxNum] = txn.Outcome
+	}
+	// the txn creating the table only wrote the catalog
+	if len(outcomes) != 3 {
+		t.Fatalf("expected %d transactions, got %d: %s", 3, len(outcomes), out.String())
+	}
+	for i, outcome := range []string{COMMITTED, ROLLED_BACK, INCOMPLETE} {
+		if outcomes[txnums[i]] != outcome {
+			t.Fatalf("expected tx %d %s, got %s", txnums[i], outcome, outcomes[txnums[i]])
+		}
+	}
+
+	out.Reset()
+	if err := run([]string{"-summary", dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 rolled back, 1 incomplete") {
+		t.Fatalf("expected the outcome counts, got %s", out.String())
+	}
+}
+
+func TestBadFlags(t *testing.T) {
+	dir, _ := setupLogDB(t)
+
+	var out, errOut bytes.Buffer
+	for _, args := range [][]string{
+		{"-type", "update", dir},
+		{"-block", "emp.tbl:x", dir},
+		{"-blocksize", "512", dir},
+		{dir + "/missing"},
+		{},
+	} {
+		if err := run(args, &out, &errOut); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestOpenDatabase(t *testing.T) {
+	dir := path.Join(t.TempDir(), "db")
+	db := record.NewSimpleDB(dir)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	db.Planner().ExecuteUpdate("create table emp(id int, name varchar(10))", tx)
+	tx.Commit()
+
+	// the database keeps its lock while the log is listed
+	var out, errOut bytes.Buffer
+	if err := run([]string{"-summary", "-tx", strconv.Itoa(tx.TxNum()), dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(out.String(), COMMITTED) {
+		t.Fatalf("expected txn %d to be listed as committed, got %q", tx.TxNum(), out.String())
+	}
+}
+
+// listing a directory that is not a database leaves it untouched
+func TestNotADatabase(t *testing.T) {
+	dir := t.TempDir()
+	var out, errOut bytes.Buffer
+	if err := run([]string{dir}, &out, &errOut); !errors.Is(err, file.ErrSuperblock) {
+		t.Fatalf("expected %v, got %v", file.ErrSuperblock, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the directory to stay empty, got %v", entries)
+	}
+}
+
+// the block size comes from the superblock, -blocksize overrides it
+func TestBlockSizeFromSuperblock(t *testing.T) {
+	dir := path.Join(t.TempDir(), "db")
+	db := record.NewSimpleDBWithBlockSize(dir, 512, 8)
+	tx := db.NewTx()
+	tx.Commit()
+	db.Close()
+
+	var out, errOut bytes.Buffer
+	if err := run([]string{"-summary", dir}, &out, &errOut); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(out.String(), COMMITTED) {
+		t.Fatalf("expected txn %d to be listed as committed, got %q", tx.TxNum(), out.String())
+	}
+	if err := run([]string{"-blocksize", "400", dir}, &out, &errOut); !errors.Is(err, file.ErrSuperblock) {
+		t.Fatalf("expected %v, got %v", file.ErrSuperblock, err)
+	}
+}
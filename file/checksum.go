@@ -0,0 +1,48 @@
+package file
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// A block on disk: [crc32c 4][key id 4][nonce 12][page contents][auth tag 16]
+// key id, nonce and tag are zero without encryption, an all zero block is valid and empty
+
+const (
+	checksumPos = 0
+	keyIDPos    = checksumPos + 4
+	noncePos    = keyIDPos + 4
+	nonceSize   = 12
+	tagSize     = 16
+
+	blockHeaderSize  = noncePos + nonceSize
+	blockTrailerSize = tagSize
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// fills the checksum of the on-disk block from the bytes that follow it
+func sealBlock(block []byte) {
+	binary.BigEndian.PutUint32(block[checksumPos:], crc32.Checksum(block[keyIDPos:], crcTable))
+}
+
+// checks the checksum of an on-disk block against its contents
+// returns the stored and computed checksums and whether they agree
+func verifyBlock(block []byte) (uint32, uint32, bool) {
+	stored := binary.BigEndian.Uint32(block[checksumPos:])
+	computed := crc32.Checksum(block[keyIDPos:], crcTable)
+	return stored, computed, stored == computed
+}
+
+func blockKeyID(block []byte) uint32 {
+	return binary.BigEndian.Uint32(block[keyIDPos:])
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package file
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChecksumDetectsCorruption(t *testing.T) {
+	const blockFile = "testfile"
+	const blockSize = 400
+
+	storage := NewMemStorage()
+	fileManager, _ := NewFileManagerWithStorage(storage, blockSize)
+
+	page := NewPageWithSize(blockSize)
+	for i := 0; i < 3; i++ {
+		blockID, _ := fileManager.Append(blockFile)
+		page.SetString(0, "block contents")
+		page.SetInt(100, i)
+		fileManager.Write(blockID, page)
+	}
+
+	// flip a byte in the middle of block 1, behind the file manager's back
+	device, _ := storage.Open(blockFile)
+	corruptAt := fileManager.offset(1) + blockHeaderSize + 100
+	b := make([]byte, 1)
+	device.ReadAt(b, corruptAt)
+	b[0] ^= 0xff
+	device.WriteAt(b, corruptAt)
+
+	// simulate a torn write of block 2: only the tail of a newer version reached the disk
+	half := (blockHeaderSize + blockSize) / 2
+	torn := make([]byte, half)
+	for i := range torn {
+		torn[i] = 0x55
+	}
+	device.WriteAt(torn, fileManager.offset(2)+int64(half))
+
+	err := fileManager.Read(NewBlockID(blockFile, 1), page)
+	var cbe *CorruptBlockError
+	if !errors.As(err, &cbe) || !errors.Is(err, ErrCorruptBlock) {
+		t.Fatalf("expected a corrupt block error, got %v", err)
+	}
+	if !cbe.BlockID.Equals(NewBlockID(blockFile, 1)) {
+		t.Fatalf("expected error to name block 1, got %v", cbe.BlockID)
+	}
+
+	if err := fileManager.Read(NewBlockID(blockFile, 0), page); err != nil {
+		t.Fatalf("expected block 0 to be intact, got %v", err)
+	}
+
+	bad, err := fileManager.CheckFile(blockFile)
+	if err != nil {
+		t.Fatalf("unexpected error checking file: %v", err)
+	}
+	if len(bad) != 2 || bad[0].BlockID.BlockNumber() != 1 || bad[1].BlockID.BlockNumber() != 2 {
+		t.Fatalf("expected blocks 1 and 2 to be reported, got %v", bad)
+	}
+	for _, cbe := range bad {
+		t.Log(cbe.Error())
+	}
+}
+
+func TestChecksumAcceptsUnwrittenBlocks(t *testing.T) {
+	const blockFile = "testfile"
+	const blockSize = 400
+
+	fileManager, _ := NewFileManagerWithStorage(NewMemStorage(), blockSize)
+	page := NewPageWithSize(blockSize)
+
+	// writing block 3 of an empty file leaves blocks 0-2 as zero filled holes
+	page.SetInt(0, 3)
+	fileManager.Write(NewBlockID(blockFile, 3), page)
+
+	bad, err := fileManager.CheckFile(blockFile)
+	if err != nil || len(bad) != 0 {
+		t.Fatalf("expected no bad blocks, got %v (%v)", bad, err)
+	}
+	if err := fileManager.Read(NewBlockID(blockFile, 1), page); err != nil {
+		t.Fatalf("expected hole to read as empty block, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package file
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Encrypts the page contents of every block with AES-GCM, authenticating the block's name and number
+// The key id in every header detects a wrong key before any decryption
+
+type blockCipher struct {
+	aead  cipher.AEAD
+	keyID uint32
+}
+
+// key must be 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256
+func newBlockCipher(key []byte) (*blockCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, nonceSize)
+	if err != nil {
+		return nil, err
+	}
+	return &blockCipher{aead: aead, keyID: KeyID(key)}, nil
+}
+
+// Returns the id recorded on disk for blocks encrypted with the key
+// id 0 is reserved for unencrypted blocks
+func KeyID(key []byte) uint32 {
+	sum := sha256.Sum256(key)
+	id := binary.BigEndian.Uint32(sum[:4])
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// encrypts the page into the payload and trailer of the on-disk block
+func (bc *blockCipher) seal(blockID BlockID, block []byte, contents []byte) error {
+	binary.BigEndian.PutUint32(block[keyIDPos:], bc.keyID)
+	nonce := block[noncePos : noncePos+nonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	bc.aead.Seal(block[blockHeaderSize:blockHeaderSize], nonce, contents, additionalData(blockID))
+	return nil
+}
+
+// decrypts the payload of the on-disk block into the page
+func (bc *blockCipher) open(blockID BlockID, block []byte, contents []byte) error {
+	nonce := block[noncePos : noncePos+nonceSize]
+	if _, err := bc.aead.Open(contents[:0], nonce, block[blockHeaderSize:], additionalData(blockID)); err != nil {
+		return &CorruptBlockError{BlockID: blockID, Reason: "authentication failed"}
+	}
+	return nil
+}
+
+func additionalData(blockID BlockID) []byte {
+	return []byte(blockID.String())
+}
@@ -0,0 +1,70 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncryptedBlocks(t *testing.T) {
+	const blockFile = "testfile"
+	const blockSize = 400
+	const secret = "customer data"
+
+	key := bytes.Repeat([]byte{7}, 32)
+	storage := NewMemStorage()
+
+	fileManager, err := NewFileManagerWithStorage(storage, blockSize, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	blockID, _ := fileManager.Append(blockFile)
+	page := NewPageWithSize(blockSize)
+	page.SetString(0, secret)
+	if err := fileManager.Write(blockID, page); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+
+	device, _ := storage.Open(blockFile)
+	raw := make([]byte, fileManager.offset(1))
+	device.ReadAt(raw, 0)
+	if bytes.Contains(raw, []byte(secret)) {
+		t.Fatalf("found plaintext %q on the storage", secret)
+	}
+
+	// same key reads the block back
+	reopened, err := NewFileManagerWithStorage(storage, blockSize, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatalf("failed to reopen with the right key: %v", err)
+	}
+	result := NewPageWithSize(blockSize)
+	if err := reopened.Read(blockID, result); err != nil {
+		t.Fatalf("failed to read block: %v", err)
+	}
+	if got := result.GetString(0); got != secret {
+		t.Fatalf("expected %q, got %q", secret, got)
+	}
+
+	// a wrong key, or no key at all, is rejected when opening
+	wrongKey := bytes.Repeat([]byte{8}, 32)
+	if _, err := NewFileManagerWithStorage(storage, blockSize, WithEncryptionKey(wrongKey)); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected %v with the wrong key, got %v", ErrKeyMismatch, err)
+	}
+	if _, err := NewFileManagerWithStorage(storage, blockSize); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected %v without a key, got %v", ErrKeyMismatch, err)
+	}
+
+	// tampering with the ciphertext is caught by authentication even if the checksum is fixed up
+	raw[blockHeaderSize+10] ^= 0xff
+	sealBlock(raw)
+	device.WriteAt(raw, 0)
+	if err := reopened.Read(blockID, result); !errors.Is(err, ErrCorruptBlock) {
+		t.Fatalf("expected %v after tampering, got %v", ErrCorruptBlock, err)
+	}
+}
+
+func TestEncryptionKeySize(t *testing.T) {
+	if _, err := NewFileManagerWithStorage(NewMemStorage(), 400, WithEncryptionKey([]byte("short"))); err == nil {
+		t.Fatalf("expected an error for a 5 byte key")
+	}
+}
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCorruptBlock = errors.New("block failed checksum verification")
+var ErrPageOutOfBounds = errors.New("write extends past the end of the page")
+var ErrKeyMismatch = errors.New("block was written with a different encryption key")
+var ErrDatabaseLocked = errors.New("database is already in use by another process or SimpleDB instance")
+var ErrReadOnly = errors.New("database was opened read-only")
+
+// Returned when a block fails its checksum or authentication, e.g. after a torn write
+type CorruptBlockError struct {
+	BlockID BlockID
+	Reason  string
+}
+
+func (e *CorruptBlockError) Error() string {
+	return fmt.Sprintf("%s %v: %s", ErrCorruptBlock.Error(), e.BlockID, e.Reason)
+}
+
+func (e *CorruptBlockError) Unwrap() error {
+	return ErrCorruptBlock
+}
+
+// Returned when a block's key id differs from the key the manager was opened with
+// A key id of 0 means the block is not encrypted
+type KeyMismatchError struct {
+	BlockID  BlockID
+	Expected uint32
+	Found    uint32
+}
+
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("%s %v: expected key id %08x, found %08x", ErrKeyMismatch.Error(), e.BlockID, e.Expected, e.Found)
+}
+
+func (e *KeyMismatchError) Unwrap() error {
+	return ErrKeyMismatch
+}
+
+var ErrSuperblock = errors.New("database superblock does not match")
+
+// Returned when the database cannot be opened with the requested settings
+type SuperblockError struct {
+	Reason string
+}
+
+func (e *SuperblockError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrSuperblock.Error(), e.Reason)
+}
+
+func (e *SuperblockError) Unwrap() error {
+	return ErrSuperblock
+}
@@ -0,0 +1,289 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Storage for crash testing, writes only survive a crash once their file is synced
+// A crash drops, partly keeps or tears the unsynced writes, everything then fails with ErrSimulatedCrash
+
+var ErrSimulatedCrash = errors.New("simulated crash")
+
+type CrashMode int
+
+const (
+	// every write since the last sync is lost
+	DROP_UNSYNCED CrashMode = iota
+	// each write since the last sync survives whole or is lost
+	APPLY_SOME_UNSYNCED
+	// like APPLY_SOME_UNSYNCED, but a surviving write may keep only a prefix of its bytes
+	TEAR_UNSYNCED
+)
+
+type FaultStorage struct {
+	mu         sync.Mutex
+	files      map[string]*faultFile
+	rand       *rand.Rand
+	generation int
+	crashed    bool
+	syncs      int
+	crashAt    int
+	crashMode  CrashMode
+}
+
+// contents of one file, as reads see them and as they would survive a crash
+type faultFile struct {
+	current []byte
+	durable []byte
+	pending []faultWrite
+}
+
+// a write or, with truncate set, a truncate to off bytes
+type faultWrite struct {
+	off      int64
+	data     []byte
+	truncate bool
+}
+
+// the seed drives which unsynced writes survive a crash, so failures can be replayed
+func NewFaultStorage(seed int64) *FaultStorage {
+	return &FaultStorage{
+		files: make(map[string]*faultFile),
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// returns how many syncs have completed, or been cut short by a crash
+func (s *FaultStorage) Syncs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.syncs
+}
+
+// scripts a crash at the nth sync counted since the storage was created
+// that sync fails and does not make anything durable
+func (s *FaultStorage) CrashAtSync(n int, mode CrashMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crashAt = n
+	s.crashMode = mode
+}
+
+// crashes right away, unless the storage already crashed
+func (s *FaultStorage) Crash(mode CrashMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.crashed {
+		s.crash(mode)
+	}
+}
+
+// reports whether the storage is down after a crash
+func (s *FaultStorage) Crashed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.crashed
+}
+
+// brings the storage back up with whatever survived the crash
+// devices opened before keep failing, the files must be opened again
+func (s *FaultStorage) Restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crashed = false
+	s.crashAt = 0
+	s.generation++
+}
+
+func (s *FaultStorage) Open(filename string) (BlockDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return nil, ErrSimulatedCrash
+	}
+	if _, ok := s.files[filename]; !ok {
+		s.files[filename] = &faultFile{}
+	}
+	return &faultDevice{storage: s, filename: filename, generation: s.generation}, nil
+}
+
+// removing a file is durable right away, like a rename or unlink followed by a directory sync
+func (s *FaultStorage) Remove(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return ErrSimulatedCrash
+	}
+	delete(s.files, filename)
+	return nil
+}
+
+func (s *FaultStorage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return nil, ErrSimulatedCrash
+	}
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// a FaultStorage is new until some file has been created in it
+func (s *FaultStorage) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.files) == 0
+}
+
+// decides what survives of every file
+func (s *FaultStorage) crash(mode CrashMode) {
+	for _, f := range s.files {
+		contents := f.durable
+		for _, w := range f.pending {
+			if mode == DROP_UNSYNCED || s.rand.Intn(2) == 0 {
+				continue
+			}
+			if mode == TEAR_UNSYNCED && !w.truncate && len(w.data) > 1 && s.rand.Intn(2) == 0 {
+				w.data = w.data[:1+s.rand.Intn(len(w.data)-1)]
+			}
+			contents = w.apply(contents)
+		}
+		f.current = contents
+		f.durable = contents
+		f.pending = nil
+	}
+	s.crashed = true
+}
+
+// returns the contents with the write applied, never changing the slice it was given
+func (w faultWrite) apply(contents []byte) []byte {
+	if w.truncate {
+		if w.off < int64(len(contents)) {
+			return contents[:w.off:w.off]
+		}
+		return contents
+	}
+	end := w.off + int64(len(w.data))
+	result := make([]byte, max(end, int64(len(contents))))
+	copy(result, contents)
+	copy(result[w.off:], w.data)
+	return result
+}
+
+// BlockDevice over one file of a FaultStorage
+type faultDevice struct {
+	storage    *FaultStorage
+	filename   string
+	generation int
+}
+
+// returns the file if the device is still alive
+func (d *faultDevice) file() (*faultFile, error) {
+	if d.storage.crashed || d.generation != d.storage.generation {
+		return nil, ErrSimulatedCrash
+	}
+	f, ok := d.storage.files[d.filename]
+	if !ok {
+		// the file was removed while open, start it over
+		f = &faultFile{}
+		d.storage.files[d.filename] = f
+	}
+	return f, nil
+}
+
+func (d *faultDevice) ReadAt(p []byte, off int64) (int, error) {
+	d.storage.mu.Lock()
+	defer d.storage.mu.Unlock()
+
+	f, err := d.file()
+	if err != nil {
+		return 0, err
+	}
+	if off >= int64(len(f.current)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.current[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *faultDevice) WriteAt(p []byte, off int64) (int, error) {
+	d.storage.mu.Lock()
+	defer d.storage.mu.Unlock()
+
+	f, err := d.file()
+	if err != nil {
+		return 0, err
+	}
+	w := faultWrite{off: off, data: append([]byte(nil), p...)}
+	f.current = w.apply(f.current)
+	f.pending = append(f.pending, w)
+	return len(p), nil
+}
+
+func (d *faultDevice) Size() (int64, error) {
+	d.storage.mu.Lock()
+	defer d.storage.mu.Unlock()
+
+	f, err := d.file()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(f.current)), nil
+}
+
+func (d *faultDevice) Truncate(size int64) error {
+	d.storage.mu.Lock()
+	defer d.storage.mu.Unlock()
+
+	f, err := d.file()
+	if err != nil {
+		return err
+	}
+	w := faultWrite{off: size, truncate: true}
+	f.current = w.apply(f.current)
+	f.pending = append(f.pending, w)
+	return nil
+}
+
+// makes the writes of this file durable, or crashes if this is the scripted sync
+func (d *faultDevice) Sync() error {
+	d.storage.mu.Lock()
+	defer d.storage.mu.Unlock()
+
+	f, err := d.file()
+	if err != nil {
+		return err
+	}
+	d.storage.syncs++
+	if d.storage.syncs == d.storage.crashAt {
+		d.storage.crash(d.storage.crashMode)
+		return ErrSimulatedCrash
+	}
+	f.durable = f.current
+	f.pending = nil
+	return nil
+}
+
+func (d *faultDevice) Close() error {
+	return nil
+}
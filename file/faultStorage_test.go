@@ -0,0 +1,93 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFaultStorageDropsUnsyncedWrites(t *testing.T) {
+	storage := NewFaultStorage(1)
+	dev, _ := storage.Open("testfile")
+	dev.WriteAt([]byte("synced"), 0)
+	dev.Sync()
+	dev.WriteAt([]byte("lost"), 6)
+
+	// reads see the unsynced write until the crash
+	buf := make([]byte, 10)
+	if n, _ := dev.ReadAt(buf, 0); n != 10 || string(buf) != "syncedlost" {
+		t.Fatalf("expected %q before the crash, got %q", "syncedlost", buf[:n])
+	}
+
+	storage.Crash(DROP_UNSYNCED)
+	if _, err := dev.ReadAt(buf, 0); !errors.Is(err, ErrSimulatedCrash) {
+		t.Fatalf("expected %v after the crash, got %v", ErrSimulatedCrash, err)
+	}
+	if _, err := storage.Open("testfile"); !errors.Is(err, ErrSimulatedCrash) {
+		t.Fatalf("expected %v opening a file before restart, got %v", ErrSimulatedCrash, err)
+	}
+
+	storage.Restart()
+	if _, err := dev.ReadAt(buf, 0); !errors.Is(err, ErrSimulatedCrash) {
+		t.Fatalf("expected a device opened before the crash to stay dead, got %v", err)
+	}
+	dev, _ = storage.Open("testfile")
+	if size, _ := dev.Size(); size != 6 {
+		t.Fatalf("expected size %d after the crash, got %d", 6, size)
+	}
+}
+
+func TestFaultStorageCrashAtSync(t *testing.T) {
+	storage := NewFaultStorage(1)
+	storage.CrashAtSync(2, DROP_UNSYNCED)
+	dev, _ := storage.Open("testfile")
+
+	dev.WriteAt([]byte{1}, 0)
+	if err := dev.Sync(); err != nil {
+		t.Fatalf("expected the first sync to succeed, got %v", err)
+	}
+	dev.WriteAt([]byte{2}, 1)
+	if err := dev.Sync(); !errors.Is(err, ErrSimulatedCrash) {
+		t.Fatalf("expected the second sync to crash, got %v", err)
+	}
+	if !storage.Crashed() || storage.Syncs() != 2 {
+		t.Fatalf("expected a crash at sync %d, got crashed=%v at sync %d", 2, storage.Crashed(), storage.Syncs())
+	}
+
+	storage.Restart()
+	dev, _ = storage.Open("testfile")
+	if size, _ := dev.Size(); size != 1 {
+		t.Fatalf("expected size %d after the crash, got %d", 1, size)
+	}
+}
+
+func TestFaultStorageTearsWrites(t *testing.T) {
+	// over many crashes a torn write must leave a prefix of the new bytes over the old ones
+	oldBytes := bytes.Repeat([]byte{0xAA}, 64)
+	newBytes := bytes.Repeat([]byte{0x55}, 64)
+	sawTorn := false
+	for seed := range int64(50) {
+		storage := NewFaultStorage(seed)
+		dev, _ := storage.Open("testfile")
+		dev.WriteAt(oldBytes, 0)
+		dev.Sync()
+		dev.WriteAt(newBytes, 0)
+		storage.Crash(TEAR_UNSYNCED)
+		storage.Restart()
+
+		dev, _ = storage.Open("testfile")
+		buf := make([]byte, 64)
+		dev.ReadAt(buf, 0)
+		cut := bytes.IndexByte(buf, 0xAA)
+		if cut < 0 {
+			cut = len(buf)
+		}
+		if !bytes.Equal(buf[:cut], newBytes[:cut]) || !bytes.Equal(buf[cut:], oldBytes[cut:]) {
+			t.Fatalf("seed %d: expected new bytes followed by old bytes, got %x", seed, buf)
+		}
+		sawTorn = sawTorn || (cut > 0 && cut < len(buf))
+	}
+	if !sawTorn {
+		t.Fatalf("expected at least one torn write")
+	}
+}
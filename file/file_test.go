@@ -17,6 +17,9 @@ func TestFile(t *testing.T) {
 	})
 
 	fileManager := NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fileManager.Close()
+	})
 	blockID := NewBlockID(blockFile, 2)
 	page1 := NewPageWithSize(fileManager.blockSize)
 	page2 := NewPageWithSize(fileManager.blockSize)
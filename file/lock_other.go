@@ -0,0 +1,11 @@
+//go:build !unix
+
+package file
+
+import "os"
+
+// there is no advisory locking here, the lock file is opened but excludes nothing
+// two managers can open the same directory and corrupt it, the caller must make sure a directory is opened once
+func lockFile(f *os.File, shared bool) error {
+	return nil
+}
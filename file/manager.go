@@ -1,93 +1,284 @@
 package file
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"os"
-	"path"
+	"io/fs"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Only one manager in simpleDB
 // methods reads, writes, append need to be synchronized
-// Part of database engine which talks to OS to read/write pages to disks
+// Part of database engine which talks to the storage to read/write pages
 // Always reads/writes block sized number of bytes from a file, always at a block boundary
-// ensures that each call to read/write/append will incur exactly one disk access
+// ensures that each call to read/write/append will incur exactly one storage access
+// Each block on the storage carries a checksum header in front of the page contents (see checksum.go)
+// and is encrypted when the manager is created WithEncryptionKey (see cipher.go)
+// The superblock records the settings the database was created with and is validated on open (see superblock.go)
+// A storage implementing Locker is locked for as long as the manager is open,
+// so two managers can never write the same database, as far as the storage can lock
+// A read-only manager creates no files, a missing file reads as empty
+// Writes are not durable until the file is synced, the log decides when that is needed
 
 type Manager struct {
 	mu sync.Mutex
 
-	directory string
+	storage   Storage
 	blockSize int
 	isNew     bool
+	readOnly  bool
+	unlocked  bool // no directory lock is taken
+	lock      io.Closer
+	block     []byte // scratch space holding one on-disk block: header + page contents + trailer
+	cipher    *blockCipher
 
-	openFiles map[string]*os.File // filename -> open file, files opend in RWS mode [Direct I/O]
-}
-
-func NewFileManager(dirPath string, blockSize int) *Manager {
-	_, err := os.Stat(dirPath)
-	isNew := os.IsNotExist(err)
+	superblock Superblock
+	nextTxNum  int // next transaction number to hand out, below superblock.NextTxNum
 
-	if isNew {
-		// give all permissions and not allow non-owner to delete
-		os.MkdirAll(dirPath, os.ModeSticky|os.ModePerm)
-	}
+	openFiles map[string]BlockDevice // filename -> open file
+}
 
-	if !isNew && err != nil {
+// panics if the directory cannot be opened, NewFileManagerWithStorage returns the error instead
+func NewFileManager(dirPath string, blockSize int, opts ...Option) *Manager {
+	storage, err := NewOSStorage(dirPath)
+	if err != nil {
 		panic(err)
 	}
-
-	// clear all tmp files in the folder
-	entries, err := os.ReadDir(dirPath)
+	fm, err := NewFileManagerWithStorage(storage, blockSize, opts...)
 	if err != nil {
 		panic(err)
 	}
+	return fm
+}
 
-	for _, v := range entries {
-		if strings.HasPrefix(v.Name(), "tmp") {
-			os.Remove(v.Name())
+// returns ErrDatabaseLocked if the storage is open elsewhere, a *SuperblockError or a *KeyMismatchError
+// if the database was created with another block size, format version or encryption key
+func NewFileManagerWithStorage(storage Storage, blockSize int, opts ...Option) (*Manager, error) {
+	manager := &Manager{
+		storage:   storage,
+		blockSize: blockSize,
+		isNew:     storage.IsNew(),
+		block:     make([]byte, blockHeaderSize+blockSize+blockTrailerSize),
+		openFiles: make(map[string]BlockDevice),
+	}
+	for _, opt := range opts {
+		if err := opt(manager); err != nil {
+			return nil, err
 		}
 	}
 
-	return &Manager{
-		directory: dirPath,
-		blockSize: blockSize,
-		isNew:     isNew,
-		openFiles: make(map[string]*os.File),
+	if locker, ok := storage.(Locker); ok && !manager.unlocked {
+		lock, err := locker.Lock(manager.readOnly)
+		if err != nil {
+			return nil, err
+		}
+		manager.lock = lock
+	}
+
+	if err := manager.open(); err != nil {
+		manager.Close()
+		return nil, err
 	}
+	return manager, nil
 }
 
-func (manager *Manager) Read(blockID BlockID, page *Page) {
+// Reads the block into the page and verifies its checksum
+// returns a *CorruptBlockError if the block is torn or damaged
+// and a *KeyMismatchError if it was written with a different encryption key
+func (manager *Manager) Read(blockID BlockID, page *Page) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	file := manager.getFile(blockID.FileName())
-	if _, err := file.ReadAt(page.Contents(), int64(blockID.BlockNumber())*int64(manager.blockSize)); err != io.EOF && err != nil {
-		panic(err)
+	return manager.readBlock(blockID, page.Contents())
+}
+
+// Reads the block into the page without verifying its checksum, for contents with checksums of their own like the log
+// a torn encrypted block still fails with a *CorruptBlockError
+func (manager *Manager) ReadUnverified(blockID BlockID, page *Page) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if err := manager.readRaw(blockID); err != nil {
+		return err
 	}
+	if manager.cipher != nil {
+		return manager.decodeBlock(blockID, page.Contents())
+	}
+	copy(page.Contents(), manager.block[blockHeaderSize:])
+	return nil
 }
 
-func (manager *Manager) Write(blockID BlockID, page *Page) {
+func (manager *Manager) Write(blockID BlockID, page *Page) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	file := manager.getFile(blockID.FileName())
-	file.WriteAt(page.Contents(), int64(blockID.BlockNumber())*int64(manager.blockSize))
+	if manager.readOnly {
+		return ErrReadOnly
+	}
+
+	if manager.cipher != nil {
+		if err := manager.cipher.seal(blockID, manager.block, page.Contents()); err != nil {
+			return err
+		}
+	} else {
+		clear(manager.block[keyIDPos:blockHeaderSize])
+		copy(manager.block[blockHeaderSize:], page.Contents())
+		clear(manager.block[blockHeaderSize+manager.blockSize:])
+	}
+	sealBlock(manager.block)
+	return manager.writeBlock(blockID)
 }
 
-// Seeks to the end of the file and writes an empty array of bytes to the file
-// is this needed in go?
-func (manager *Manager) Append(filename string) BlockID {
+// Seeks to the end of the file and writes an empty block to the file
+func (manager *Manager) Append(filename string) (BlockID, error) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	newBlockNum := manager.Length(filename)
+	if manager.readOnly {
+		return BlockID{}, ErrReadOnly
+	}
+
+	newBlockNum, err := manager.length(filename)
+	if err != nil {
+		return BlockID{}, err
+	}
 	blockID := NewBlockID(filename, newBlockNum)
-	buf := make([]byte, manager.blockSize)
+	// an all zero block reads back as an empty page, with or without encryption
+	clear(manager.block)
+
+	if err := manager.writeBlock(blockID); err != nil {
+		return BlockID{}, err
+	}
+	return blockID, nil
+}
+
+// Cuts the file down to its first numBlocks blocks
+// The caller must make sure no buffer still holds one of the removed blocks
+func (manager *Manager) Truncate(filename string, numBlocks int) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.readOnly {
+		return ErrReadOnly
+	}
+	file, err := manager.getFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(manager.offset(numBlocks)); err != nil {
+		return fmt.Errorf("truncate %s: %w", filename, err)
+	}
+	return nil
+}
+
+// Deletes the file, closing it if it is open
+// The caller must make sure no buffer still holds one of its blocks
+func (manager *Manager) Remove(filename string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.readOnly {
+		return ErrReadOnly
+	}
+	if file, ok := manager.openFiles[filename]; ok {
+		delete(manager.openFiles, filename)
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("close %s: %w", filename, err)
+		}
+	}
+	if err := manager.storage.Remove(filename); err != nil {
+		return fmt.Errorf("remove %s: %w", filename, err)
+	}
+	return nil
+}
+
+// Makes every write to the file durable, reads and writes go on while it syncs
+func (manager *Manager) Sync(filename string) error {
+	manager.mu.Lock()
+	file, ok := manager.openFiles[filename]
+	manager.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", filename, err)
+	}
+	return nil
+}
+
+// syncs every file written through the manager
+func (manager *Manager) SyncAll() error {
+	manager.mu.Lock()
+	files := make([]string, 0, len(manager.openFiles))
+	for filename := range manager.openFiles {
+		files = append(files, filename)
+	}
+	manager.mu.Unlock()
+
+	for _, filename := range files {
+		if err := manager.Sync(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the total blocks in file
+func (manager *Manager) Length(filename string) (int, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.length(filename)
+}
+
+// Reads every block of the file and reports the ones failing checksum verification
+func (manager *Manager) CheckFile(filename string) ([]*CorruptBlockError, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	corrupt := make([]*CorruptBlockError, 0)
+	numBlocks, err := manager.length(filename)
+	if err != nil {
+		return corrupt, err
+	}
+	contents := make([]byte, manager.blockSize)
+	for i := 0; i < numBlocks; i++ {
+		err := manager.readBlock(NewBlockID(filename, i), contents)
+		if err == nil {
+			continue
+		}
+		if cbe, ok := err.(*CorruptBlockError); ok {
+			corrupt = append(corrupt, cbe)
+			continue
+		}
+		return corrupt, err
+	}
+	return corrupt, nil
+}
 
-	file := manager.getFile(filename)
-	file.WriteAt(buf, int64(blockID.BlockNumber())*int64(manager.blockSize))
-	return blockID
+// closes every open file and releases the storage lock
+// the manager must not be used afterwards
+func (manager *Manager) Close() error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	var firstErr error
+	for filename, file := range manager.openFiles {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(manager.openFiles, filename)
+	}
+	if manager.lock != nil {
+		if err := manager.lock.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		manager.lock = nil
+	}
+	return firstErr
 }
 
 // Getters and Setters
@@ -100,31 +291,318 @@ func (manager *Manager) IsNew() bool {
 	return manager.isNew
 }
 
+func (manager *Manager) IsReadOnly() bool {
+	return manager.readOnly
+}
+
+func (manager *Manager) Storage() Storage {
+	return manager.storage
+}
+
+func (manager *Manager) Superblock() Superblock {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.superblock
+}
+
+// Hands out the next transaction number, reserved in batches through the superblock so numbers keep increasing across restarts
+func (manager *Manager) NextTxNum() (int, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	// a read-only database never writes, so its numbers need no reservation
+	if manager.nextTxNum >= manager.superblock.NextTxNum && !manager.readOnly {
+		if err := manager.reserveTxNums(manager.nextTxNum + TXNUM_BATCH); err != nil {
+			return 0, err
+		}
+	}
+	txnum := manager.nextTxNum
+	manager.nextTxNum++
+	return txnum, nil
+}
+
 // Helper functions
 
-func (manager *Manager) getFile(filename string) *os.File {
+/*
+Moves the next transaction number up to at least next
+Used when a copy of a database is made, so the copy never reuses a number found in its log
+*/
+func (manager *Manager) AdvanceTxNum(next int) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.readOnly {
+		return ErrReadOnly
+	}
+	if next <= manager.nextTxNum {
+		return nil
+	}
+	manager.nextTxNum = next
+	if next >= manager.superblock.NextTxNum {
+		return manager.reserveTxNums(next + TXNUM_BATCH)
+	}
+	return nil
+}
+
+// returns the names of the files holding blocks
+// the superblock, the lock file and temp files are left out
+func (manager *Manager) Files() ([]string, error) {
+	names, err := manager.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == SUPERBLOCK_FILE || name == LOCK_FILE || strings.HasPrefix(name, "tmp") {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+func (manager *Manager) getFile(filename string) (BlockDevice, error) {
 	file, ok := manager.openFiles[filename]
 	if !ok {
-		filePath := path.Join(manager.directory, filename)
-		newFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_SYNC, 0755)
+		newFile, err := manager.openFile(filename)
+		if errors.Is(err, fs.ErrNotExist) && manager.readOnly {
+			// not kept open, the file may be created later
+			return missingDevice{}, nil
+		}
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("open %s: %w", filename, err)
 		}
 		manager.openFiles[filename] = newFile
-		return newFile
+		return newFile, nil
 	}
 
-	return file
+	return file, nil
 }
 
-// returns the total blocks in file
-func (manager *Manager) Length(filename string) int {
-	file := manager.getFile(filename)
+func (manager *Manager) openFile(filename string) (BlockDevice, error) {
+	if opener, ok := manager.storage.(ReadOnlyOpener); ok && manager.readOnly {
+		return opener.OpenReadOnly(filename)
+	}
+	return manager.storage.Open(filename)
+}
 
-	fileInfo, err := file.Stat()
+func (manager *Manager) length(filename string) (int, error) {
+	file, err := manager.getFile(filename)
 	if err != nil {
-		panic(err)
+		return 0, err
+	}
+
+	size, err := file.Size()
+	if err != nil {
+		return 0, fmt.Errorf("size of %s: %w", filename, err)
+	}
+
+	return int(size / int64(len(manager.block))), nil
+}
+
+// reads the on-disk block, verifies it and places its page contents into contents
+func (manager *Manager) readBlock(blockID BlockID, contents []byte) error {
+	if err := manager.readRaw(blockID); err != nil {
+		return err
+	}
+	return manager.decodeBlock(blockID, contents)
+}
+
+// verifies the block in the scratch space and places its page contents into contents
+func (manager *Manager) decodeBlock(blockID BlockID, contents []byte) error {
+	if isZero(manager.block) {
+		clear(contents)
+		return nil
+	}
+
+	if stored, computed, ok := verifyBlock(manager.block); !ok {
+		return &CorruptBlockError{
+			BlockID: blockID,
+			Reason:  fmt.Sprintf("stored checksum %08x, computed %08x", stored, computed),
+		}
+	}
+	if found := blockKeyID(manager.block); found != manager.keyID() {
+		return &KeyMismatchError{BlockID: blockID, Expected: manager.keyID(), Found: found}
+	}
+
+	if manager.cipher != nil {
+		return manager.cipher.open(blockID, manager.block, contents)
+	}
+	copy(contents, manager.block[blockHeaderSize:])
+	return nil
+}
+
+// reads the on-disk block into the scratch space without verifying it
+func (manager *Manager) readRaw(blockID BlockID) error {
+	file, err := manager.getFile(blockID.FileName())
+	if err != nil {
+		return err
+	}
+	n, err := file.ReadAt(manager.block, manager.offset(blockID.BlockNumber()))
+	if err != io.EOF && err != nil {
+		return fmt.Errorf("read %v: %w", blockID, err)
 	}
+	// the block lies (partly) past the end of the file, its missing bytes are zeros
+	clear(manager.block[n:])
+	return nil
+}
+
+// key id of the blocks this manager writes, 0 if it does not encrypt
+func (manager *Manager) keyID() uint32 {
+	if manager.cipher == nil {
+		return 0
+	}
+	return manager.cipher.keyID
+}
+
+// persists the end of the reserved transaction numbers in the superblock
+func (manager *Manager) reserveTxNums(bound int) error {
+	sb := manager.superblock
+	sb.NextTxNum = bound
+	sb.sequence++
+
+	dev, err := manager.getFile(SUPERBLOCK_FILE)
+	if err != nil {
+		return err
+	}
+	if err := writeSuperblock(dev, sb); err != nil {
+		return err
+	}
+	manager.superblock = sb
+	return nil
+}
+
+// clears leftover temp files and validates the superblock
+func (manager *Manager) open() error {
+	if !manager.readOnly {
+		names, err := manager.storage.List()
+		if err != nil {
+			return err
+		}
+
+		// clear all tmp files in the storage
+		for _, name := range names {
+			if strings.HasPrefix(name, "tmp") {
+				if err := manager.storage.Remove(name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return manager.openSuperblock()
+}
+
+// reads and validates the superblock, or creates it for a new database
+func (manager *Manager) openSuperblock() error {
+	dev, err := manager.getFile(SUPERBLOCK_FILE)
+	if err != nil {
+		return err
+	}
+	sb, ok, err := readSuperblock(dev)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		hasData, err := manager.hasData()
+		if err != nil {
+			return err
+		}
+		if hasData || manager.readOnly {
+			return &SuperblockError{Reason: fmt.Sprintf("%s is missing or damaged, the directory is not a simpleDB database or was written by an older version", SUPERBLOCK_FILE)}
+		}
+		sb = Superblock{
+			FormatVersion: FORMAT_VERSION,
+			BlockSize:     manager.blockSize,
+			KeyID:         manager.keyID(),
+			CreatedAt:     time.Now(),
+			NextTxNum:     1,
+		}
+		if err := writeSuperblock(dev, sb); err != nil {
+			return err
+		}
+	}
+
+	if sb.FormatVersion != FORMAT_VERSION {
+		return &SuperblockError{Reason: fmt.Sprintf("database has format version %d, this build supports version %d", sb.FormatVersion, FORMAT_VERSION)}
+	}
+	if sb.BlockSize != manager.blockSize {
+		return &SuperblockError{Reason: fmt.Sprintf("database was created with block size %d, opened with block size %d", sb.BlockSize, manager.blockSize)}
+	}
+	if sb.KeyID != manager.keyID() {
+		return &KeyMismatchError{BlockID: NewBlockID(SUPERBLOCK_FILE, 0), Expected: manager.keyID(), Found: sb.KeyID}
+	}
+	manager.superblock = sb
+	manager.nextTxNum = sb.NextTxNum
+	return nil
+}
+
+// reports whether any file other than the superblock holds bytes
+func (manager *Manager) hasData() (bool, error) {
+	names, err := manager.storage.List()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if name == SUPERBLOCK_FILE {
+			continue
+		}
+		dev, err := manager.getFile(name)
+		if err != nil {
+			return false, err
+		}
+		size, err := dev.Size()
+		if err != nil {
+			return false, err
+		}
+		if size > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writes the scratch space to the on-disk block
+func (manager *Manager) writeBlock(blockID BlockID) error {
+	file, err := manager.getFile(blockID.FileName())
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(manager.block, manager.offset(blockID.BlockNumber())); err != nil {
+		return fmt.Errorf("write %v: %w", blockID, err)
+	}
+	return nil
+}
+
+// byte offset of the block in its file
+func (manager *Manager) offset(blockNum int) int64 {
+	return int64(blockNum) * int64(len(manager.block))
+}
+
+// a file a read-only manager did not find
+type missingDevice struct{}
+
+func (missingDevice) ReadAt(p []byte, off int64) (int, error) {
+	return 0, io.EOF
+}
+
+func (missingDevice) WriteAt(p []byte, off int64) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (missingDevice) Size() (int64, error) {
+	return 0, nil
+}
+
+func (missingDevice) Truncate(size int64) error {
+	return ErrReadOnly
+}
+
+func (missingDevice) Sync() error {
+	return nil
+}
 
-	return int(fileInfo.Size() / int64(manager.blockSize))
+func (missingDevice) Close() error {
+	return nil
 }
@@ -0,0 +1,129 @@
+package file
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// Storage that keeps every file in memory, for tests and embeddings that need no durability
+type MemStorage struct {
+	mu    sync.Mutex
+	files map[string]*memDevice
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		files: make(map[string]*memDevice),
+	}
+}
+
+func (s *MemStorage) Open(filename string) (BlockDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dev, ok := s.files[filename]
+	if !ok {
+		dev = &memDevice{}
+		s.files[filename] = dev
+	}
+	return dev, nil
+}
+
+func (s *MemStorage) OpenReadOnly(filename string) (BlockDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dev, ok := s.files[filename]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+	}
+	return dev, nil
+}
+
+func (s *MemStorage) Remove(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.files, filename)
+	return nil
+}
+
+func (s *MemStorage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// a MemStorage is new until some file has been created in it
+func (s *MemStorage) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.files) == 0
+}
+
+// BlockDevice over a growable byte slice
+type memDevice struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (d *memDevice) ReadAt(p []byte, off int64) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if off >= int64(len(d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *memDevice) WriteAt(p []byte, off int64) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	end := off + int64(len(p))
+	if end > int64(len(d.data)) {
+		d.data = append(d.data, make([]byte, end-int64(len(d.data)))...)
+	}
+	return copy(d.data[off:], p), nil
+}
+
+func (d *memDevice) Size() (int64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return int64(len(d.data)), nil
+}
+
+func (d *memDevice) Truncate(size int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if size < int64(len(d.data)) {
+		d.data = d.data[:size]
+	}
+	return nil
+}
+
+// nothing is ever durable in memory, there is nothing to do
+func (d *memDevice) Sync() error {
+	return nil
+}
+
+// closing a memory file keeps its contents, only Remove drops them
+func (d *memDevice) Close() error {
+	return nil
+}
@@ -0,0 +1,34 @@
+package file
+
+// Option configures a file manager when it is created
+type Option func(*Manager) error
+
+// Opens the database for reading only, sharing the directory lock, every write fails with ErrReadOnly
+func WithReadOnly() Option {
+	return func(manager *Manager) error {
+		manager.readOnly = true
+		return nil
+	}
+}
+
+// Opens the database for reading only without taking the directory lock, so it can be inspected while in use
+func WithoutLock() Option {
+	return func(manager *Manager) error {
+		manager.readOnly = true
+		manager.unlocked = true
+		return nil
+	}
+}
+
+// Encrypts every block the manager writes, and decrypts every block it reads, with the key
+// The key must be 16, 24 or 32 bytes long
+func WithEncryptionKey(key []byte) Option {
+	return func(manager *Manager) error {
+		bc, err := newBlockCipher(key)
+		if err != nil {
+			return err
+		}
+		manager.cipher = bc
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+const LOCK_FILE = "simpledb.lock"
+
+// Storage backed by a directory on the local file system
+// Writes land in the OS cache, a file is only durable once Sync is called on it
+// Lock only excludes other managers on unix systems, elsewhere nothing stops two managers opening the directory
+type OSStorage struct {
+	directory string
+	isNew     bool
+}
+
+func NewOSStorage(dirPath string) (*OSStorage, error) {
+	_, err := os.Stat(dirPath)
+	isNew := os.IsNotExist(err)
+
+	if !isNew && err != nil {
+		return nil, err
+	}
+
+	if isNew {
+		// give all permissions and not allow non-owner to delete
+		if err := os.MkdirAll(dirPath, os.ModeSticky|os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	return &OSStorage{
+		directory: dirPath,
+		isNew:     isNew,
+	}, nil
+}
+
+func (s *OSStorage) Open(filename string) (BlockDevice, error) {
+	filePath := path.Join(s.directory, filename)
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &osDevice{file: file}, nil
+}
+
+func (s *OSStorage) OpenReadOnly(filename string) (BlockDevice, error) {
+	file, err := os.Open(path.Join(s.directory, filename))
+	if err != nil {
+		return nil, err
+	}
+	return &osDevice{file: file}, nil
+}
+
+func (s *OSStorage) Remove(filename string) error {
+	err := os.Remove(path.Join(s.directory, filename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *OSStorage) List() ([]string, error) {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, v := range entries {
+		if !v.IsDir() {
+			names = append(names, v.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *OSStorage) Lock(shared bool) (io.Closer, error) {
+	flag := os.O_CREATE | os.O_RDWR
+	if shared {
+		flag = os.O_CREATE | os.O_RDONLY
+	}
+	lockPath := path.Join(s.directory, LOCK_FILE)
+	file, err := os.OpenFile(lockPath, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file, shared); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", err, s.directory)
+	}
+	// closing the file releases the lock
+	return file, nil
+}
+
+func (s *OSStorage) IsNew() bool {
+	return s.isNew
+}
+
+func (s *OSStorage) Directory() string {
+	return s.directory
+}
+
+// BlockDevice over an *os.File
+type osDevice struct {
+	file *os.File
+}
+
+func (d *osDevice) ReadAt(p []byte, off int64) (int, error) {
+	return d.file.ReadAt(p, off)
+}
+
+func (d *osDevice) WriteAt(p []byte, off int64) (int, error) {
+	return d.file.WriteAt(p, off)
+}
+
+func (d *osDevice) Size() (int64, error) {
+	fileInfo, err := d.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size(), nil
+}
+
+func (d *osDevice) Truncate(size int64) error {
+	return d.file.Truncate(size)
+}
+
+func (d *osDevice) Sync() error {
+	return d.file.Sync()
+}
+
+func (d *osDevice) Close() error {
+	return d.file.Close()
+}
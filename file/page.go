@@ -1,6 +1,9 @@
 package file
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 // the book uses java's ByteBuffer to represent the page
 // Only Integer and String data present in page
@@ -37,12 +40,17 @@ func (p *Page) GetBytes(offset int) []byte {
 	return result
 }
 
-func (p *Page) SetBytes(offset int, buf []byte) {
+// returns ErrPageOutOfBounds and leaves the page untouched
+// if the bytes and their size prefix do not fit in the page
+func (p *Page) SetBytes(offset int, buf []byte) error {
 	// check if bytes to be written are > page size
-	assertPageWrite(offset+len(buf)+IntBytes, p.maxSize)
+	if err := checkPageWrite(offset, offset+len(buf)+IntBytes, p.maxSize); err != nil {
+		return err
+	}
 
 	p.SetInt(offset, len(buf))
 	copy(p.buf[offset+IntBytes:], buf)
+	return nil
 }
 
 // string methods
@@ -51,8 +59,8 @@ func (p *Page) GetString(offset int) string {
 	return string(p.GetBytes(offset))
 }
 
-func (p *Page) SetString(offset int, val string) {
-	p.SetBytes(offset, []byte(val))
+func (p *Page) SetString(offset int, val string) error {
+	return p.SetBytes(offset, []byte(val))
 }
 
 // Integer methods
@@ -65,6 +73,11 @@ func (p *Page) SetInt(offset int, val int) {
 	binary.BigEndian.PutUint32(p.buf[offset:offset+IntBytes], uint32(val))
 }
 
+// returns ErrPageOutOfBounds if n bytes written at offset do not fit in the page
+func (p *Page) CheckWrite(offset int, n int) error {
+	return checkPageWrite(offset, offset+n, p.maxSize)
+}
+
 func (p *Page) Contents() []byte {
 	return p.buf
 }
@@ -74,8 +87,9 @@ func MaxLength(strlen int) int {
 	return IntBytes + strlen
 }
 
-func assertPageWrite(offsetAfterInsert int, maxSize int) {
-	if offsetAfterInsert > maxSize {
-		panic("Page Out of bounds")
+func checkPageWrite(offset int, offsetAfterInsert int, maxSize int) error {
+	if offset < 0 || offsetAfterInsert > maxSize {
+		return fmt.Errorf("%w: writing bytes [%d, %d) into a page of size %d", ErrPageOutOfBounds, offset, offsetAfterInsert, maxSize)
 	}
+	return nil
 }
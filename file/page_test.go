@@ -1,6 +1,9 @@
 package file
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestWriteInt(t *testing.T) {
 	page := NewPageWithSize(1024)
@@ -65,3 +68,17 @@ func TestWriteStringMultiple(t *testing.T) {
 		t.Fatalf("expected %q, got %q", v2, got)
 	}
 }
+
+func TestWriteStringOutOfBounds(t *testing.T) {
+	page := NewPageWithSize(16)
+
+	const v = "this string is too long"
+
+	if err := page.SetString(4, v); !errors.Is(err, ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", ErrPageOutOfBounds, err)
+	}
+
+	if got := page.GetInt(4); got != 0 {
+		t.Fatalf("expected page to be untouched, got size prefix %d", got)
+	}
+}
@@ -0,0 +1,75 @@
+package file
+
+import "io"
+
+// The backend the file manager reads and writes blocks through, every file is a BlockDevice opened by name
+
+type Storage interface {
+	// opens the named file, creating it if it does not exist
+	Open(filename string) (BlockDevice, error)
+	// deletes the named file, removing a missing file is not an error
+	Remove(filename string) error
+	// returns the names of all files currently in the storage
+	List() ([]string, error)
+	// reports whether the storage was freshly created
+	IsNew() bool
+}
+
+// Implemented by storages several processes can open, Lock fails with ErrDatabaseLocked on a conflicting lock
+type Locker interface {
+	Lock(shared bool) (io.Closer, error)
+}
+
+// Implemented by storages that can open a file without creating it, read-only managers open their files through it
+type ReadOnlyOpener interface {
+	// opens the named file for reading, an error matching fs.ErrNotExist if it does not exist
+	OpenReadOnly(filename string) (BlockDevice, error)
+}
+
+// A single file addressed by byte offsets
+// The file manager always reads and writes whole blocks at block boundaries
+type BlockDevice interface {
+	io.ReaderAt
+	io.WriterAt
+	// returns the current size of the file in bytes
+	Size() (int64, error)
+	// cuts the file down to size bytes
+	Truncate(size int64) error
+	// makes every earlier write and truncate durable
+	Sync() error
+	Close() error
+}
+
+// chunk size used when copying files byte for byte
+const copyChunk = 64 * 1024
+
+// Copies the file byte for byte from one storage to another, blocks stay encrypted
+func CopyFile(src Storage, dest Storage, filename string) error {
+	in, err := src.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dest.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buf := make([]byte, copyChunk)
+	for off := int64(0); ; {
+		n, err := in.ReadAt(buf, off)
+		if n > 0 {
+			if _, err := out.WriteAt(buf[:n], off); err != nil {
+				return err
+			}
+			off += int64(n)
+		}
+		if err == io.EOF {
+			return out.Sync()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
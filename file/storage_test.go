@@ -0,0 +1,220 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMemStorage(t *testing.T) {
+	const blockFile = "testfile"
+	const blockSize = 400
+
+	storage := NewMemStorage()
+	fileManager, err := NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	if !fileManager.IsNew() {
+		t.Fatalf("expected an empty memory storage to be new")
+	}
+
+	testStorageRoundTrip(t, fileManager, blockFile)
+
+	// a second manager over the same storage sees the same blocks
+	reopened, err := NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to reopen file manager: %v", err)
+	}
+	if reopened.IsNew() {
+		t.Fatalf("expected a memory storage with files to not be new")
+	}
+	page := NewPageWithSize(blockSize)
+	if err := reopened.Read(NewBlockID(blockFile, 2), page); err != nil {
+		t.Fatalf("failed to read block: %v", err)
+	}
+	if got := page.GetInt(0); got != 2 {
+		t.Fatalf("expected %d after reopen, got %d", 2, got)
+	}
+}
+
+func TestOSStorage(t *testing.T) {
+	const dbFolder = "../test_data"
+	const blockFile = "testfile"
+	const blockSize = 400
+
+	t.Cleanup(func() {
+		os.RemoveAll(dbFolder)
+	})
+
+	storage, err := NewOSStorage(dbFolder)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	fileManager, err := NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	defer fileManager.Close()
+
+	testStorageRoundTrip(t, fileManager, blockFile)
+}
+
+func TestStorageClearsTempFiles(t *testing.T) {
+	const blockSize = 400
+
+	storage := NewMemStorage()
+	fileManager, _ := NewFileManagerWithStorage(storage, blockSize)
+	fileManager.Append("tmp1")
+	fileManager.Append("data")
+
+	if _, err := NewFileManagerWithStorage(storage, blockSize); err != nil {
+		t.Fatalf("failed to reopen file manager: %v", err)
+	}
+
+	names, _ := storage.List()
+	if len(names) != 2 || names[0] != "data" || names[1] != SUPERBLOCK_FILE {
+		t.Fatalf("expected only %q and %q to survive, got %v", "data", SUPERBLOCK_FILE, names)
+	}
+}
+
+// appends 3 blocks, stamps each with its number and reads them back
+func testStorageRoundTrip(t *testing.T, fileManager *Manager, blockFile string) {
+	page := NewPageWithSize(fileManager.BlockSize())
+	for i := 0; i < 3; i++ {
+		blockID, err := fileManager.Append(blockFile)
+		if err != nil {
+			t.Fatalf("failed to append block: %v", err)
+		}
+		if blockID.BlockNumber() != i {
+			t.Fatalf("expected appended block %d, got %d", i, blockID.BlockNumber())
+		}
+		page.SetInt(0, i)
+		if err := fileManager.Write(blockID, page); err != nil {
+			t.Fatalf("failed to write block: %v", err)
+		}
+	}
+
+	if got, err := fileManager.Length(blockFile); err != nil || got != 3 {
+		t.Fatalf("expected length %d, got %d (%v)", 3, got, err)
+	}
+
+	for i := 2; i >= 0; i-- {
+		if err := fileManager.Read(NewBlockID(blockFile, i), page); err != nil {
+			t.Fatalf("failed to read block %d: %v", i, err)
+		}
+		if got := page.GetInt(0); got != i {
+			t.Fatalf("expected %d in block %d, got %d", i, i, got)
+		}
+	}
+
+	// reading past the end of the file gives an empty page
+	page.SetInt(0, 99)
+	if err := fileManager.Read(NewBlockID(blockFile, 10), page); err != nil {
+		t.Fatalf("failed to read past end of file: %v", err)
+	}
+	if got := page.GetInt(0); got != 0 {
+		t.Fatalf("expected empty block past end of file, got %d", got)
+	}
+}
+
+func TestOSStorageLock(t *testing.T) {
+	const dbFolder = "../test_data"
+	const blockSize = 400
+
+	t.Cleanup(func() {
+		os.RemoveAll(dbFolder)
+	})
+
+	fileManager := NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fileManager.Close()
+	})
+	blockID, _ := fileManager.Append("testfile")
+
+	// a second manager on the same directory, even in this process, is refused
+	storage, _ := NewOSStorage(dbFolder)
+	if _, err := NewFileManagerWithStorage(storage, blockSize); !errors.Is(err, ErrDatabaseLocked) {
+		t.Fatalf("expected %v, got %v", ErrDatabaseLocked, err)
+	}
+	if _, err := NewFileManagerWithStorage(storage, blockSize, WithReadOnly()); !errors.Is(err, ErrDatabaseLocked) {
+		t.Fatalf("expected %v for a reader, got %v", ErrDatabaseLocked, err)
+	}
+
+	if err := fileManager.Close(); err != nil {
+		t.Fatalf("failed to close file manager: %v", err)
+	}
+
+	// readers share the directory with each other but not with a writer
+	reader1, err := NewFileManagerWithStorage(storage, blockSize, WithReadOnly())
+	if err != nil {
+		t.Fatalf("failed to open reader: %v", err)
+	}
+	defer reader1.Close()
+	reader2, err := NewFileManagerWithStorage(storage, blockSize, WithReadOnly())
+	if err != nil {
+		t.Fatalf("failed to open second reader: %v", err)
+	}
+	defer reader2.Close()
+	if _, err := NewFileManagerWithStorage(storage, blockSize); !errors.Is(err, ErrDatabaseLocked) {
+		t.Fatalf("expected %v for a writer, got %v", ErrDatabaseLocked, err)
+	}
+
+	page := NewPageWithSize(blockSize)
+	if err := reader1.Read(blockID, page); err != nil {
+		t.Fatalf("failed to read block: %v", err)
+	}
+	if err := reader1.Write(blockID, page); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected %v, got %v", ErrReadOnly, err)
+	}
+}
+
+// a read-only open of a directory that is not a database leaves no superblock behind
+func TestReadOnlyCreatesNoFiles(t *testing.T) {
+	const blockSize = 400
+
+	for _, opt := range []Option{WithReadOnly(), WithoutLock()} {
+		dir := t.TempDir()
+		storage, err := NewOSStorage(dir)
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		if _, err := NewFileManagerWithStorage(storage, blockSize, opt); !errors.Is(err, ErrSuperblock) {
+			t.Fatalf("expected %v, got %v", ErrSuperblock, err)
+		}
+		if _, err := os.Stat(path.Join(dir, SUPERBLOCK_FILE)); !os.IsNotExist(err) {
+			t.Fatalf("expected no %s, got %v", SUPERBLOCK_FILE, err)
+		}
+	}
+
+	memStorage := NewMemStorage()
+	if _, err := NewFileManagerWithStorage(memStorage, blockSize, WithoutLock()); !errors.Is(err, ErrSuperblock) {
+		t.Fatalf("expected %v, got %v", ErrSuperblock, err)
+	}
+	if _, err := ReadSuperblock(memStorage); !errors.Is(err, ErrSuperblock) {
+		t.Fatalf("expected %v, got %v", ErrSuperblock, err)
+	}
+	if !memStorage.IsNew() {
+		t.Fatalf("expected the storage to stay empty")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	const blockFile = "testfile"
+	const blockSize = 400
+
+	fileManager, _ := NewFileManagerWithStorage(NewMemStorage(), blockSize)
+	for range 5 {
+		fileManager.Append(blockFile)
+	}
+	if err := fileManager.Truncate(blockFile, 2); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	if got, _ := fileManager.Length(blockFile); got != 2 {
+		t.Fatalf("expected length %d after truncate, got %d", 2, got)
+	}
+	if blockID, _ := fileManager.Append(blockFile); blockID.BlockNumber() != 2 {
+		t.Fatalf("expected to append block %d, got %d", 2, blockID.BlockNumber())
+	}
+}
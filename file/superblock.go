@@ -0,0 +1,137 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// A small unencrypted file describing how the database was created, written to alternating slots
+// so a torn update leaves the previous copy intact
+// slot: [magic 4][format version 4][block size 4][key id 4][created at 8][next txnum 8][sequence 8][checksum 4]
+
+const SUPERBLOCK_FILE = "simpledb.super"
+
+// Version of the on-disk format written by this code
+// 2: update log records carry the new value as well as the old one
+// 3: every log record starts with its lsn
+// 4: the log is split into segment files
+// 5: log records are framed with their size and a crc
+const FORMAT_VERSION = 5
+
+// Number of transaction numbers reserved by each superblock update
+const TXNUM_BATCH = 100
+
+const (
+	superblockMagic    = 0x53444253 // "SDBS"
+	superblockSlotSize = 64
+)
+
+type Superblock struct {
+	FormatVersion int
+	BlockSize     int
+	KeyID         uint32
+	CreatedAt     time.Time
+	NextTxNum     int
+	sequence      uint64
+}
+
+func (sb Superblock) marshal() []byte {
+	buf := make([]byte, superblockSlotSize)
+	binary.BigEndian.PutUint32(buf[0:], superblockMagic)
+	binary.BigEndian.PutUint32(buf[4:], uint32(sb.FormatVersion))
+	binary.BigEndian.PutUint32(buf[8:], uint32(sb.BlockSize))
+	binary.BigEndian.PutUint32(buf[12:], sb.KeyID)
+	binary.BigEndian.PutUint64(buf[16:], uint64(sb.CreatedAt.UnixNano()))
+	binary.BigEndian.PutUint64(buf[24:], uint64(sb.NextTxNum))
+	binary.BigEndian.PutUint64(buf[32:], sb.sequence)
+	binary.BigEndian.PutUint32(buf[40:], crc32.Checksum(buf[:40], crcTable))
+	return buf
+}
+
+// returns false if the slot does not hold a valid superblock
+func unmarshalSuperblock(buf []byte) (Superblock, bool) {
+	if binary.BigEndian.Uint32(buf[0:]) != superblockMagic {
+		return Superblock{}, false
+	}
+	if binary.BigEndian.Uint32(buf[40:]) != crc32.Checksum(buf[:40], crcTable) {
+		return Superblock{}, false
+	}
+	return Superblock{
+		FormatVersion: int(binary.BigEndian.Uint32(buf[4:])),
+		BlockSize:     int(binary.BigEndian.Uint32(buf[8:])),
+		KeyID:         binary.BigEndian.Uint32(buf[12:]),
+		CreatedAt:     time.Unix(0, int64(binary.BigEndian.Uint64(buf[16:]))),
+		NextTxNum:     int(binary.BigEndian.Uint64(buf[24:])),
+		sequence:      binary.BigEndian.Uint64(buf[32:]),
+	}, true
+}
+
+// reads the newest valid copy of the superblock
+// returns false if the file holds no valid copy
+func readSuperblock(dev BlockDevice) (Superblock, bool, error) {
+	buf := make([]byte, 2*superblockSlotSize)
+	n, err := dev.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return Superblock{}, false, fmt.Errorf("read %s: %w", SUPERBLOCK_FILE, err)
+	}
+	clear(buf[n:])
+
+	sb0, ok0 := unmarshalSuperblock(buf[:superblockSlotSize])
+	sb1, ok1 := unmarshalSuperblock(buf[superblockSlotSize:])
+	switch {
+	case ok0 && ok1 && sb1.sequence > sb0.sequence:
+		return sb1, true, nil
+	case ok0:
+		return sb0, true, nil
+	case ok1:
+		return sb1, true, nil
+	default:
+		return Superblock{}, false, nil
+	}
+}
+
+/*
+Reads the superblock of the database in the storage without opening it, e.g. to learn its block size
+The superblock is not created if it is missing, a *SuperblockError is returned instead
+*/
+func ReadSuperblock(storage Storage) (Superblock, error) {
+	var dev BlockDevice
+	var err error
+	if opener, ok := storage.(ReadOnlyOpener); ok {
+		dev, err = opener.OpenReadOnly(SUPERBLOCK_FILE)
+	} else {
+		dev, err = storage.Open(SUPERBLOCK_FILE)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return Superblock{}, &SuperblockError{Reason: fmt.Sprintf("%s is missing, the directory is not a simpleDB database", SUPERBLOCK_FILE)}
+	}
+	if err != nil {
+		return Superblock{}, err
+	}
+	defer dev.Close()
+	sb, ok, err := readSuperblock(dev)
+	if err != nil {
+		return Superblock{}, err
+	}
+	if !ok {
+		return Superblock{}, &SuperblockError{Reason: fmt.Sprintf("%s is damaged or was written by an older version", SUPERBLOCK_FILE)}
+	}
+	return sb, nil
+}
+
+// writes the superblock into the slot not holding the current copy
+func writeSuperblock(dev BlockDevice, sb Superblock) error {
+	offset := int64(sb.sequence%2) * superblockSlotSize
+	if _, err := dev.WriteAt(sb.marshal(), offset); err != nil {
+		return fmt.Errorf("write %s: %w", SUPERBLOCK_FILE, err)
+	}
+	if err := dev.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", SUPERBLOCK_FILE, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package file
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSuperblock(t *testing.T) {
+	const blockSize = 400
+
+	storage := NewMemStorage()
+	fileManager, err := NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	created := fileManager.Superblock()
+	if created.FormatVersion != FORMAT_VERSION || created.BlockSize != blockSize {
+		t.Fatalf("unexpected superblock %+v", created)
+	}
+	fileManager.Append("testfile")
+
+	for i := 1; i <= 250; i++ {
+		txnum, err := fileManager.NextTxNum()
+		if err != nil {
+			t.Fatalf("failed to get next txnum: %v", err)
+		}
+		if txnum != i {
+			t.Fatalf("expected txnum %d, got %d", i, txnum)
+		}
+	}
+
+	reopened, err := NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to reopen file manager: %v", err)
+	}
+	sb := reopened.Superblock()
+	if !sb.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("expected creation time %v, got %v", created.CreatedAt, sb.CreatedAt)
+	}
+	// the rest of the batch reserved before the restart is skipped
+	if txnum, _ := reopened.NextTxNum(); txnum != 1+3*TXNUM_BATCH {
+		t.Fatalf("expected txnum %d after reopen, got %d", 1+3*TXNUM_BATCH, txnum)
+	}
+
+	// reopening with another block size is rejected
+	if _, err := NewFileManagerWithStorage(storage, 2*blockSize); !errors.Is(err, ErrSuperblock) {
+		t.Fatalf("expected %v, got %v", ErrSuperblock, err)
+	}
+}
+
+func TestSuperblockTornUpdate(t *testing.T) {
+	const blockSize = 400
+
+	storage := NewMemStorage()
+	fileManager, _ := NewFileManagerWithStorage(storage, blockSize)
+	for range 2 * TXNUM_BATCH {
+		fileManager.NextTxNum()
+	}
+
+	// tear the newest copy, the one before it must still be found
+	dev, _ := storage.Open(SUPERBLOCK_FILE)
+	newest := int64(fileManager.Superblock().sequence%2) * superblockSlotSize
+	dev.WriteAt([]byte{0xde, 0xad}, newest+20)
+
+	reopened, err := NewFileManagerWithStorage(storage, blockSize)
+	if err != nil {
+		t.Fatalf("failed to reopen file manager: %v", err)
+	}
+	if got := reopened.Superblock().NextTxNum; got != 1+TXNUM_BATCH {
+		t.Fatalf("expected to fall back to next txnum %d, got %d", 1+TXNUM_BATCH, got)
+	}
+}
+
+func TestSuperblockMissing(t *testing.T) {
+	const blockSize = 400
+
+	storage := NewMemStorage()
+	fileManager, _ := NewFileManagerWithStorage(storage, blockSize)
+	fileManager.Append("testfile")
+	storage.Remove(SUPERBLOCK_FILE)
+
+	if _, err := NewFileManagerWithStorage(storage, blockSize); !errors.Is(err, ErrSuperblock) {
+		t.Fatalf("expected %v, got %v", ErrSuperblock, err)
+	}
+}
@@ -0,0 +1,10 @@
+package log
+
+import "errors"
+
+var ErrInvalidLSN = errors.New("no log record with this lsn")
+var ErrEndOfLog = errors.New("no log record after the reader's position")
+var ErrLogTruncated = errors.New("log block was removed with its segment")
+var ErrCorruptRecord = errors.New("log record failed crc verification")
+var ErrNoLog = errors.New("log file does not exist")
+var ErrLogFailed = errors.New("log failed, the database must be reopened")
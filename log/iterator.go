@@ -1,56 +1,94 @@
 package log
 
-import "github.com/nitishsharma2825/simpleDB/file"
+import (
+	"fmt"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
 
 // moves through the log file in reverse order
 
 type Iterator struct {
-	fm         *file.Manager
+	lm         *Manager
 	blockId    file.BlockID
 	page       *file.Page
 	currentPos int
 	boundary   int
+	lsn        int
 }
 
-func NewIterator(fm *file.Manager, blockId file.BlockID) *Iterator {
+func newIterator(lm *Manager, blockId file.BlockID) (*Iterator, error) {
 	iterator := &Iterator{
-		fm:      fm,
+		lm:      lm,
 		blockId: blockId,
-		page:    file.NewPageWithSlice(make([]byte, fm.BlockSize())),
+		page:    file.NewPageWithSlice(make([]byte, lm.fm.BlockSize())),
 	}
 
-	iterator.moveToBlock(blockId)
+	if err := iterator.moveToBlock(blockId); err != nil {
+		return nil, err
+	}
 
-	return iterator
+	return iterator, nil
 }
 
 // Determines if the current log record
 // is the earliest record in the log file
 // returns true if there is an earlier record
+// blocks of removed segments count as the start of the log
 func (it *Iterator) HasNext() bool {
-	return it.currentPos < it.fm.BlockSize() || it.blockId.BlockNumber() > 0
+	return it.currentPos < it.lm.fm.BlockSize() || it.blockId.BlockNumber() > it.lm.FirstBlock()
 }
 
 // Moves to the next log record in the block
 // If there are no more log records in the block,
 // then move to the previous block and return log from there
-func (it *Iterator) Next() []byte {
-	if it.currentPos == it.fm.BlockSize() {
+func (it *Iterator) Next() ([]byte, error) {
+	if it.currentPos == it.lm.fm.BlockSize() {
 		// we are the end of the block
 		it.blockId = file.NewBlockID(it.blockId.FileName(), it.blockId.BlockNumber()-1)
-		it.moveToBlock(it.blockId)
+		if err := it.moveToBlock(it.blockId); err != nil {
+			return nil, err
+		}
+	}
+	lsn, record, err := it.recordAt(it.currentPos)
+	if err != nil {
+		return nil, err
 	}
-	record := it.page.GetBytes(it.currentPos)
 
 	// move the iterator forward by
-	it.currentPos += file.IntBytes + len(record)
-	return record
+	it.currentPos += file.IntBytes + it.page.GetInt(it.currentPos)
+	it.lsn = lsn
+	return record, nil
+}
+
+// Returns the lsn of the record last returned by Next
+func (it *Iterator) LSN() int {
+	return it.lsn
 }
 
 // Moves to the specified log block
 // and positions it at the first record in that block
-func (it *Iterator) moveToBlock(blockId file.BlockID) {
-	it.fm.Read(blockId, it.page)
+func (it *Iterator) moveToBlock(blockId file.BlockID) error {
+	if _, err := it.lm.readBlock(blockId, it.page); err != nil {
+		return err
+	}
 	it.boundary = it.page.GetInt(0)
+	if it.boundary == 0 {
+		// appended just before a crash, the header was never written and there are no records
+		it.boundary = it.lm.fm.BlockSize()
+	}
 	it.currentPos = it.boundary
+	return nil
+}
+
+// reads the record at the position, which must be intact and carry the lsn of its position
+func (it *Iterator) recordAt(position int) (int, []byte, error) {
+	lsn, record, err := recordAt(it.page, position)
+	if err == nil && lsn != it.lm.lsnAt(it.blockId, position) {
+		err = fmt.Errorf("%w: lsn %d stored at lsn %d", ErrCorruptRecord, lsn, it.lm.lsnAt(it.blockId, position))
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("log block %d: %w", it.blockId.BlockNumber(), err)
+	}
+	return lsn, record, nil
 }
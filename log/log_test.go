@@ -1,10 +1,14 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nitishsharma2825/simpleDB/file"
 )
@@ -16,11 +20,13 @@ func TestLog(t *testing.T) {
 
 	t.Cleanup(func() {
 		p := path.Join(testDataFolder, logFile)
-		os.Remove(p)
-		os.Remove(path.Dir(p))
+		os.RemoveAll(path.Dir(p))
 	})
 
 	fileManager := file.NewFileManager(testDataFolder, blockSize)
+	t.Cleanup(func() {
+		fileManager.Close()
+	})
 
 	logManager := NewLogManager(fileManager, logFile)
 
@@ -43,7 +49,10 @@ func makeLogVal(idx int) int {
 // verifies that logs are returned in a LIFO manner
 func testLogIteration(t *testing.T, lm *Manager, from int) {
 	t.Log("The log file has now these records:")
-	iter := lm.Iterator()
+	iter, err := lm.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create log iterator: %v", err)
+	}
 	f := from
 	for {
 		if !iter.HasNext() {
@@ -54,7 +63,10 @@ func testLogIteration(t *testing.T, lm *Manager, from int) {
 		vexp := makeLogVal(f)
 		f--
 
-		record := iter.Next()
+		record, err := iter.Next()
+		if err != nil {
+			t.Fatalf("failed to read log record: %v", err)
+		}
 		page := file.NewPageWithSlice(record)
 
 		s := page.GetString(0)
@@ -78,7 +90,10 @@ func populateLogManager(t *testing.T, lm *Manager, start int, end int) {
 	t.Log("Creating log records:")
 	for i := start; i <= end; i++ {
 		record := createLogRecord(makeLogKey(i), makeLogVal(i))
-		lsn := lm.Append(record)
+		lsn, err := lm.Append(record)
+		if err != nil {
+			t.Fatalf("failed to append log record: %v", err)
+		}
 		t.Logf("%d", lsn)
 	}
 	t.Log("Records created.\n")
@@ -92,3 +107,425 @@ func createLogRecord(key string, val int) []byte {
 	page.SetInt(keyLen, val)
 	return recordBuf
 }
+
+// storage whose syncs are slow, so concurrent flushes pile up behind them
+type slowSyncStorage struct {
+	file.Storage
+	syncs atomic.Int32
+}
+
+type slowSyncDevice struct {
+	file.BlockDevice
+	storage *slowSyncStorage
+}
+
+func (s *slowSyncStorage) Open(filename string) (file.BlockDevice, error) {
+	dev, err := s.Storage.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &slowSyncDevice{BlockDevice: dev, storage: s}, nil
+}
+
+func (d *slowSyncDevice) Sync() error {
+	d.storage.syncs.Add(1)
+	time.Sleep(5 * time.Millisecond)
+	return d.BlockDevice.Sync()
+}
+
+// committers flushing at the same time share syncs instead of doing one each
+func TestGroupCommit(t *testing.T) {
+	const committers = 20
+	storage := &slowSyncStorage{Storage: file.NewMemStorage()}
+	fileManager, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to open file manager: %v", err)
+	}
+	defer fileManager.Close()
+	logManager := NewLogManager(fileManager, "testlog")
+	storage.syncs.Store(0)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, committers)
+	for i := range committers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lsn, err := logManager.Append(createLogRecord(makeLogKey(i), makeLogVal(i)))
+			if err == nil {
+				err = logManager.Flush(lsn)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("failed to flush log record: %v", err)
+		}
+	}
+
+	syncs := int(storage.syncs.Load())
+	if syncs == 0 || syncs >= committers {
+		t.Fatalf("expected between 1 and %d syncs, got %d", committers-1, syncs)
+	}
+	if logManager.lastSavedLSN != logManager.LatestLSN() {
+		t.Fatalf("expected %d, got %d", logManager.LatestLSN(), logManager.lastSavedLSN)
+	}
+}
+
+// lsns keep growing across a restart and every record can be read back by its lsn
+func TestLSN(t *testing.T) {
+	storage := file.NewMemStorage()
+	lsns := make([]int, 0)
+	for restart := range 2 {
+		fileManager, err := file.NewFileManagerWithStorage(storage, 400)
+		if err != nil {
+			t.Fatalf("failed to open file manager: %v", err)
+		}
+		logManager := NewLogManager(fileManager, "testlog")
+		for i := range 30 {
+			lsn, err := logManager.Append(createLogRecord(makeLogKey(i), makeLogVal(restart*30+i)))
+			if err != nil {
+				t.Fatalf("failed to append log record: %v", err)
+			}
+			if len(lsns) > 0 && lsn <= lsns[len(lsns)-1] {
+				t.Fatalf("expected lsn above %d, got %d", lsns[len(lsns)-1], lsn)
+			}
+			lsns = append(lsns, lsn)
+		}
+		if err := logManager.Flush(lsns[len(lsns)-1]); err != nil {
+			t.Fatalf("failed to flush log: %v", err)
+		}
+
+		for i, lsn := range lsns {
+			record, err := logManager.Record(lsn)
+			if err != nil {
+				t.Fatalf("failed to read log record %d: %v", lsn, err)
+			}
+			page := file.NewPageWithSlice(record)
+			if v := page.GetInt(file.MaxLength(len(page.GetString(0)))); v != makeLogVal(i) {
+				t.Fatalf("expected val %d, got %d", makeLogVal(i), v)
+			}
+		}
+		if _, err := logManager.Record(lsns[0] + 1); !errors.Is(err, ErrInvalidLSN) {
+			t.Fatalf("expected ErrInvalidLSN, got %v", err)
+		}
+
+		iter, err := logManager.Iterator()
+		if err != nil {
+			t.Fatalf("failed to create log iterator: %v", err)
+		}
+		for i := len(lsns) - 1; iter.HasNext(); i-- {
+			if _, err := iter.Next(); err != nil {
+				t.Fatalf("failed to read log record: %v", err)
+			}
+			if iter.LSN() != lsns[i] {
+				t.Fatalf("expected lsn %d, got %d", lsns[i], iter.LSN())
+			}
+		}
+		fileManager.Close()
+	}
+}
+
+// reads the records forward from the reader and checks they are i = from..to
+func testLogReading(t *testing.T, reader *Reader, lsns []int, from int, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		if !reader.HasNext() {
+			t.Fatalf("expected record %d, the reader has none", i)
+		}
+		record, err := reader.Next()
+		if err != nil {
+			t.Fatalf("failed to read log record: %v", err)
+		}
+		page := file.NewPageWithSlice(record)
+		if s := page.GetString(0); s != makeLogKey(i) {
+			t.Fatalf("expected key %q, got %q", makeLogKey(i), s)
+		}
+		if reader.LSN() != lsns[i] {
+			t.Fatalf("expected lsn %d, got %d", lsns[i], reader.LSN())
+		}
+	}
+	if reader.HasNext() {
+		t.Fatalf("expected the reader to end after record %d", to)
+	}
+	if _, err := reader.Next(); !errors.Is(err, ErrEndOfLog) {
+		t.Fatalf("expected ErrEndOfLog, got %v", err)
+	}
+}
+
+func TestLogReader(t *testing.T) {
+	const records = 200
+	storage := file.NewMemStorage()
+	fileManager, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to open file manager: %v", err)
+	}
+	defer fileManager.Close()
+	logManager := NewLogManager(fileManager, "testlog")
+
+	reader, err := logManager.Reader()
+	if err != nil {
+		t.Fatalf("failed to create log reader: %v", err)
+	}
+	if reader.HasNext() {
+		t.Fatalf("expected an empty log")
+	}
+
+	lsns := make([]int, records)
+	for i := range records {
+		if lsns[i], err = logManager.Append(createLogRecord(makeLogKey(i), makeLogVal(i))); err != nil {
+			t.Fatalf("failed to append log record: %v", err)
+		}
+	}
+	if lsns[records-1]/400 < 5 {
+		t.Fatalf("expected the records to span many blocks, they end in block %d", lsns[records-1]/400)
+	}
+
+	// the reader picks up records appended after it was created
+	testLogReading(t, reader, lsns, 0, records-1)
+
+	// and keeps up with the tail of the log
+	lsns = append(lsns, 0)
+	if lsns[records], err = logManager.Append(createLogRecord(makeLogKey(records), makeLogVal(records))); err != nil {
+		t.Fatalf("failed to append log record: %v", err)
+	}
+	testLogReading(t, reader, lsns, records, records)
+
+	// seeking to a record starts at it, seeking between records starts at the next one
+	for _, i := range []int{0, 1, 57, 120, records} {
+		if err := reader.Seek(lsns[i]); err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+		testLogReading(t, reader, lsns, i, records)
+		if err := reader.Seek(lsns[i] - 1); err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+		testLogReading(t, reader, lsns, i, records)
+	}
+
+	// seeking past the end waits for new records
+	if err := reader.Seek(lsns[records] + 1); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	testLogReading(t, reader, lsns, records+1, records)
+}
+
+func TestLogSegments(t *testing.T) {
+	const records = 200
+	storage := file.NewMemStorage()
+	archive := file.NewMemStorage()
+	fileManager, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to open file manager: %v", err)
+	}
+	defer fileManager.Close()
+
+	logManager := NewLogManager(fileManager, "testlog", WithSegmentBlocks(4))
+	lsns := make([]int, records)
+	for i := range records / 2 {
+		if lsns[i], err = logManager.Append(createLogRecord(makeLogKey(i), makeLogVal(i))); err != nil {
+			t.Fatalf("failed to append log record: %v", err)
+		}
+	}
+	if err := logManager.Flush(lsns[records/2-1]); err != nil {
+		t.Fatalf("failed to flush log: %v", err)
+	}
+
+	// a restart picks up the segments, whatever segment size it is given
+	logManager = NewLogManager(fileManager, "testlog", WithSegmentBlocks(3), WithArchive(archive))
+	for i := records / 2; i < records; i++ {
+		if lsns[i], err = logManager.Append(createLogRecord(makeLogKey(i), makeLogVal(i))); err != nil {
+			t.Fatalf("failed to append log record: %v", err)
+		}
+	}
+	segments, err := logManager.listSegments()
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+	if len(segments) < 5 {
+		t.Fatalf("expected at least %d segments, got %d", 5, len(segments))
+	}
+
+	reader, err := logManager.Reader()
+	if err != nil {
+		t.Fatalf("failed to create log reader: %v", err)
+	}
+	testLogReading(t, reader, lsns, 0, records-1)
+	iter, err := logManager.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create log iterator: %v", err)
+	}
+	count := 0
+	for ; iter.HasNext(); count++ {
+		if _, err := iter.Next(); err != nil {
+			t.Fatalf("failed to read log record: %v", err)
+		}
+	}
+	if count != records {
+		t.Fatalf("expected %d, got %d", records, count)
+	}
+
+	// truncating archives the segments before the record, the reader starts after them
+	const kept = 120
+	if err := logManager.Truncate(lsns[kept]); err != nil {
+		t.Fatalf("failed to truncate log: %v", err)
+	}
+	first := logManager.FirstBlock()
+	if first == 0 || first > lsns[kept]/400 {
+		t.Fatalf("expected the first block in (0, %d], got %d", lsns[kept]/400, first)
+	}
+	archived, err := archive.List()
+	if err != nil {
+		t.Fatalf("failed to list archive: %v", err)
+	}
+	remaining, err := logManager.listSegments()
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+	if len(archived)+len(remaining) != len(segments) || remaining[0] != first {
+		t.Fatalf("expected %d segments archived, got %d", len(segments)-len(remaining), len(archived))
+	}
+
+	oldest := 0
+	for lsns[oldest]/400 < first {
+		oldest++
+	}
+	if _, err := logManager.Record(lsns[oldest-1]); !errors.Is(err, ErrLogTruncated) {
+		t.Fatalf("expected ErrLogTruncated, got %v", err)
+	}
+	if err := reader.Seek(0); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	testLogReading(t, reader, lsns, oldest, records-1)
+
+	iter, err = logManager.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create log iterator: %v", err)
+	}
+	for count = 0; iter.HasNext(); count++ {
+		if _, err := iter.Next(); err != nil {
+			t.Fatalf("failed to read log record: %v", err)
+		}
+	}
+	if count != records-oldest {
+		t.Fatalf("expected %d, got %d", records-oldest, count)
+	}
+}
+
+// a crash tearing the write of the tail block keeps every record synced before it
+func TestTornLogTail(t *testing.T) {
+	const synced = 10
+	for seed := range int64(20) {
+		storage := file.NewFaultStorage(seed)
+		fileManager, err := file.NewFileManagerWithStorage(storage, 400)
+		if err != nil {
+			t.Fatalf("failed to open file manager: %v", err)
+		}
+		logManager := NewLogManager(fileManager, "testlog")
+		lsns := make([]int, 0)
+		for i := range synced + 5 {
+			lsn, err := logManager.Append(createLogRecord(makeLogKey(i), makeLogVal(i)))
+			if err != nil {
+				t.Fatalf("failed to append log record: %v", err)
+			}
+			lsns = append(lsns, lsn)
+			if i == synced-1 {
+				if err := logManager.Flush(lsn); err != nil {
+					t.Fatalf("failed to flush log: %v", err)
+				}
+			}
+		}
+		// written but never synced
+		if _, err := logManager.Position(); err != nil {
+			t.Fatalf("failed to write log tail: %v", err)
+		}
+		storage.Crash(file.TEAR_UNSYNCED)
+		storage.Restart()
+
+		// a read-only log reads past the torn write without repairing it
+		fileManager, err = file.NewFileManagerWithStorage(storage, 400, file.WithReadOnly())
+		if err != nil {
+			t.Fatalf("failed to reopen file manager: %v", err)
+		}
+		logManager, err = OpenLogManager(fileManager, "testlog")
+		if err != nil {
+			t.Fatalf("seed %d: failed to open read-only log: %v", seed, err)
+		}
+		readOnlyCount := countTornLogRecords(t, seed, logManager, lsns)
+		fileManager.Close()
+
+		fileManager, err = file.NewFileManagerWithStorage(storage, 400)
+		if err != nil {
+			t.Fatalf("failed to reopen file manager: %v", err)
+		}
+		logManager = NewLogManager(fileManager, "testlog")
+		count := countTornLogRecords(t, seed, logManager, lsns)
+		if count < synced {
+			t.Fatalf("seed %d: expected at least %d records, got %d", seed, synced, count)
+		}
+		if count != readOnlyCount {
+			t.Fatalf("seed %d: expected %d records read-only, got %d", seed, count, readOnlyCount)
+		}
+		lsn, err := logManager.Append(createLogRecord(makeLogKey(0), makeLogVal(0)))
+		if err != nil {
+			t.Fatalf("failed to append log record: %v", err)
+		}
+		if lsn <= lsns[count-1] {
+			t.Fatalf("seed %d: expected lsn above %d, got %d", seed, lsns[count-1], lsn)
+		}
+	}
+}
+
+// reads the log, which holds the first records appended with the lsns, and returns how many it holds
+func countTornLogRecords(t *testing.T, seed int64, lm *Manager, lsns []int) int {
+	reader, err := lm.Reader()
+	if err != nil {
+		t.Fatalf("failed to create log reader: %v", err)
+	}
+	count := 0
+	for ; reader.HasNext(); count++ {
+		if _, err := reader.Next(); err != nil {
+			t.Fatalf("seed %d: failed to read log record: %v", seed, err)
+		}
+		if reader.LSN() != lsns[count] {
+			t.Fatalf("seed %d: expected lsn %d, got %d", seed, lsns[count], reader.LSN())
+		}
+	}
+	return count
+}
+
+// damage in the middle of the log is reported, never read as records
+func TestCorruptLogBlock(t *testing.T) {
+	storage := file.NewMemStorage()
+	fileManager, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to open file manager: %v", err)
+	}
+	defer fileManager.Close()
+	logManager := NewLogManager(fileManager, "testlog")
+	populateLogManager(t, logManager, 1, 100)
+
+	dev, err := storage.Open(SegmentFile("testlog", 0))
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	if _, err := dev.WriteAt([]byte("garbage"), 3*int64(fileManager.BlockSize())); err != nil {
+		t.Fatalf("failed to damage segment: %v", err)
+	}
+
+	iter, err := logManager.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create log iterator: %v", err)
+	}
+	for iter.HasNext() {
+		if _, err = iter.Next(); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, file.ErrCorruptBlock) {
+		t.Fatalf("expected ErrCorruptBlock, got %v", err)
+	}
+}
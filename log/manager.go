@@ -1,6 +1,8 @@
 package log
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/nitishsharma2825/simpleDB/file"
@@ -8,100 +10,361 @@ import (
 
 // Responsible for writing log records into a log file
 // Tail of the log is kept in buffer which is flushed to disk when needed
+// The LSN of a record is its end offset in the log file, records fill a block from the right
+// so LSNs grow with every record and locate it. The log is split into segment files, see segment.go
 type Manager struct {
-	fm           *file.Manager
-	logFile      string
-	logPage      *file.Page
-	currentBlock file.BlockID
-	latestLSN    int
-	lastSavedLSN int
-	mu           sync.Mutex
+	fm            *file.Manager
+	logFile       string
+	logPage       *file.Page
+	currentBlock  file.BlockID // block of the log, not of a segment
+	latestLSN     int          // lsn of the newest record, 0 if there is none
+	lastSavedLSN  int          // every record up to this lsn is durable
+	syncing       bool
+	synced        *sync.Cond
+	segments      []int // first block of every segment, oldest first
+	segmentBlocks int
+	retention     Retention
+	archive       file.Storage
+	failed        error // set by Fail, nothing is appended or flushed after it
+	mu            sync.Mutex
 }
 
-func NewLogManager(fm *file.Manager, logFile string) *Manager {
+// panics if the tail of the log cannot be read
+func NewLogManager(fm *file.Manager, logFile string, opts ...Option) *Manager {
+	logManager, err := OpenLogManager(fm, logFile, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return logManager
+}
+
+// Opens the log like NewLogManager but returns the error instead of panicking
+// ErrNoLog if a read-only file manager has no log to open
+func OpenLogManager(fm *file.Manager, logFile string, opts ...Option) (*Manager, error) {
 	buf := make([]byte, fm.BlockSize())
-	logSize := fm.Length(logFile)
 	logPage := file.NewPageWithSlice(buf)
 
 	logManager := &Manager{
-		fm:           fm,
-		logFile:      logFile,
-		logPage:      logPage,
-		latestLSN:    0,
-		lastSavedLSN: 0,
-		mu:           sync.Mutex{},
+		fm:            fm,
+		logFile:       logFile,
+		logPage:       logPage,
+		segmentBlocks: SEGMENT_BLOCKS,
+		mu:            sync.Mutex{},
+	}
+	logManager.synced = sync.NewCond(&logManager.mu)
+	for _, opt := range opts {
+		opt(logManager)
 	}
 
-	if logSize == 0 {
+	segments, err := logManager.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	logManager.segments = segments
+	if len(segments) == 0 && fm.IsReadOnly() {
+		err = fmt.Errorf("open log %s: %w", logFile, ErrNoLog)
+	} else if len(segments) == 0 {
 		// empty log, append a new disk block and assign new page
-		logManager.AppendNewBlock()
+		logManager.currentBlock = file.NewBlockID(logFile, -1)
+		err = logManager.AppendNewBlock()
 	} else {
-		logManager.currentBlock = file.NewBlockID(logFile, logSize-1)
-		logManager.fm.Read(logManager.currentBlock, logPage)
+		last := segments[len(segments)-1]
+		var segmentSize int
+		segmentSize, err = fm.Length(SegmentFile(logFile, last))
+		if err == nil {
+			logManager.currentBlock = file.NewBlockID(logFile, last+max(segmentSize-1, 0))
+			err = logManager.readSegmentBlock(logManager.currentBlock.BlockNumber(), logPage)
+		}
+		var corrupt *file.CorruptBlockError
+		if errors.As(err, &corrupt) {
+			// a crash tore the last write of the tail
+			err = logManager.truncateTornTail()
+		}
+		if err == nil && logPage.GetInt(0) == 0 {
+			// a crash cut AppendNewBlock short, the block is empty
+			logPage.SetInt(0, fm.BlockSize())
+		}
+	}
+	if err == nil {
+		logManager.latestLSN, err = logManager.lastRecordLSN()
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return logManager
+	// whatever is in the file was there before the restart, take it as durable
+	logManager.lastSavedLSN = logManager.latestLSN
+	return logManager, nil
 }
 
-// Appends a log record to the log buffer
+// Cuts the torn tail block back to its intact records, found from the end of the block by their crc
+// a read-only log only changes its copy of the block
+func (lm *Manager) truncateTornTail() error {
+	blockId, err := lm.segmentBlock(lm.currentBlock.BlockNumber())
+	if err != nil {
+		return err
+	}
+	if err := lm.fm.ReadUnverified(blockId, lm.logPage); err != nil {
+		return err
+	}
+	boundary := intactBoundary(lm.logPage, lm.currentBlock, lm.lsnAt)
+	clear(lm.logPage.Contents()[:boundary])
+	lm.logPage.SetInt(0, boundary)
+	if lm.fm.IsReadOnly() {
+		return nil
+	}
+	if err := lm.flush(); err != nil {
+		return err
+	}
+	return lm.syncCurrent()
+}
+
+// finds the lsn of the newest record in the file, 0 if the log is empty
+func (lm *Manager) lastRecordLSN() (int, error) {
+	page := lm.logPage
+	blockId := lm.currentBlock
+	if page.GetInt(0) == lm.fm.BlockSize() {
+		if blockId.BlockNumber() == lm.segments[0] {
+			// nothing before it, the log holds no record or only removed ones
+			return lm.lsnAt(blockId, page.GetInt(0)), nil
+		}
+		// the tail block is empty, the newest record ends the block before it
+		blockId = file.NewBlockID(lm.logFile, blockId.BlockNumber()-1)
+		page = file.NewPageWithSize(lm.fm.BlockSize())
+		if err := lm.readSegmentBlock(blockId.BlockNumber(), page); err != nil {
+			return 0, err
+		}
+	}
+	return lm.lsnAt(blockId, page.GetInt(0)), nil
+}
+
+// Appends a log record to the log buffer and returns its lsn
 // The record is an arbitrary array of bytes
 // Log records are written right->left in the buffer
-// Size of the record is written before the bytes
+// Size of the record is written before the lsn and the bytes
 // The beginning 4 bytes of buffer contain the location of last written record ("boundary")
 // Storing the record backwards makes it easy to read them in reverse order
 
-func (lm *Manager) Append(logRecord []byte) int {
+func (lm *Manager) Append(logRecord []byte) (int, error) {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
 
+	if lm.failed != nil {
+		return 0, lm.failed
+	}
 	// boundary contains the offset of the most recently added record
 	boundary := lm.logPage.GetInt(0)
-	recordSize := len(logRecord)
+	recordSize := recordHeader + len(logRecord) + recordTrailer
 
-	// data + size(data)
+	// framed data + size(framed data)
 	bytesNeeded := recordSize + file.IntBytes
 
 	// if bytes needed + page header > space left
 	if bytesNeeded+file.IntBytes > boundary {
-		lm.flush()
-		lm.AppendNewBlock()
+		// the full block is made durable before the next one is started,
+		// so a crash can never keep a later block and lose an earlier one
+		if err := lm.flush(); err != nil {
+			return 0, err
+		}
+		if err := lm.syncCurrent(); err != nil {
+			return 0, err
+		}
+		lm.lastSavedLSN = lm.latestLSN
+		if err := lm.AppendNewBlock(); err != nil {
+			return 0, err
+		}
 		boundary = lm.logPage.GetInt(0)
 	}
 
 	// compute the leading byte offset where new record will start
 	recordPosition := boundary - bytesNeeded
+	lsn := lm.lsnAt(lm.currentBlock, recordPosition)
 
-	lm.logPage.SetBytes(recordPosition, logRecord)
+	if err := lm.logPage.SetBytes(recordPosition, frameRecord(lsn, logRecord)); err != nil {
+		return 0, err
+	}
 	lm.logPage.SetInt(0, recordPosition)
-	lm.latestLSN += 1
+	lm.latestLSN = lsn
+	return lsn, nil
+}
+
+// Returns the bytes of the record with the lsn
+// ErrInvalidLSN if no record starts there
+func (lm *Manager) Record(lsn int) ([]byte, error) {
+	blockSize := lm.fm.BlockSize()
+	blockId := file.NewBlockID(lm.logFile, lsn/blockSize)
+	position := blockSize - lsn%blockSize
+
+	if lsn <= 0 || lsn > lm.LatestLSN() {
+		return nil, fmt.Errorf("read log record %d: %w", lsn, ErrInvalidLSN)
+	}
+	page := file.NewPageWithSize(blockSize)
+	if _, err := lm.readBlock(blockId, page); err != nil {
+		return nil, fmt.Errorf("read log record %d: %w", lsn, err)
+	}
+
+	// the position must hold a record, and the record must carry this lsn
+	start := page.GetInt(0)
+	for start < position {
+		start += file.IntBytes + page.GetInt(start)
+	}
+	if start != position {
+		return nil, fmt.Errorf("read log record %d: %w", lsn, ErrInvalidLSN)
+	}
+	recordLSN, record, err := recordAt(page, position)
+	if err != nil {
+		return nil, fmt.Errorf("read log record %d: %w", lsn, err)
+	}
+	if recordLSN != lsn {
+		return nil, fmt.Errorf("read log record %d: %w", lsn, ErrInvalidLSN)
+	}
+	return record, nil
+}
+
+// Returns the lsn of the most recently appended record, 0 if the log is empty
+func (lm *Manager) LatestLSN() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
 	return lm.latestLSN
 }
 
+// Returns the lsn up to which every record is durable
+func (lm *Manager) DurableLSN() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.lastSavedLSN
+}
+
+// reads the block, or copies the tail of the log if it is the block being appended to
+// reports whether it was the tail
+func (lm *Manager) readBlock(blockId file.BlockID, page *file.Page) (bool, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if blockId == lm.currentBlock {
+		copy(page.Contents(), lm.logPage.Contents())
+		return true, nil
+	}
+	return false, lm.readSegmentBlock(blockId.BlockNumber(), page)
+}
+
+// reads the log block from its segment
+func (lm *Manager) readSegmentBlock(blockNum int, page *file.Page) error {
+	blockId, err := lm.segmentBlock(blockNum)
+	if err != nil {
+		return err
+	}
+	return lm.fm.Read(blockId, page)
+}
+
+// syncs the segment of the current block, earlier segments were synced when they filled up
+func (lm *Manager) syncCurrent() error {
+	blockId, err := lm.segmentBlock(lm.currentBlock.BlockNumber())
+	if err != nil {
+		return err
+	}
+	return lm.fm.Sync(blockId.FileName())
+}
+
+// lsn of a record starting at the position in the block
+func (lm *Manager) lsnAt(blockId file.BlockID, position int) int {
+	blockSize := lm.fm.BlockSize()
+	return blockId.BlockNumber()*blockSize + blockSize - position
+}
+
 // helper methods
 
-func (lm *Manager) AppendNewBlock() {
-	// append an empty disk block to end of file
+func (lm *Manager) AppendNewBlock() error {
+	// append an empty disk block to end of file, starting a new segment if the last one is full
 	// set the starting offset in page
 	// write to disk
-	lm.currentBlock = lm.fm.Append(lm.logFile)
+	blockNum := lm.currentBlock.BlockNumber() + 1
+	if len(lm.segments) == 0 || blockNum-lm.segments[len(lm.segments)-1] >= lm.segmentBlocks {
+		lm.segments = append(lm.segments, blockNum)
+	}
+	lm.currentBlock = file.NewBlockID(lm.logFile, blockNum)
+	clear(lm.logPage.Contents())
 	lm.logPage.SetInt(0, lm.fm.BlockSize())
-	lm.fm.Write(lm.currentBlock, lm.logPage)
+	return lm.flush()
+}
+
+// Makes the record with the lsn and every record before it durable
+// callers arriving during a sync wait, then share the next one (group commit)
+func (lm *Manager) Flush(lsn int) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.failed != nil {
+		return lm.failed
+	}
+	for lsn > lm.lastSavedLSN {
+		if lm.syncing {
+			lm.synced.Wait()
+			continue
+		}
+		if err := lm.flush(); err != nil {
+			return err
+		}
+		segment, err := lm.segmentBlock(lm.currentBlock.BlockNumber())
+		if err != nil {
+			return err
+		}
+		target := lm.latestLSN
+		lm.syncing = true
+
+		// records can still be appended while the file syncs
+		lm.mu.Unlock()
+		err = lm.fm.Sync(segment.FileName())
+		lm.mu.Lock()
+
+		lm.syncing = false
+		lm.synced.Broadcast()
+		if err != nil {
+			return err
+		}
+		lm.lastSavedLSN = max(lm.lastSavedLSN, target)
+	}
+	return nil
 }
 
-func (lm *Manager) Flush(lsn int) {
-	if lsn >= lm.lastSavedLSN {
-		lm.flush()
+// Stops the log after a txn could not log its end, so nothing builds on its changes until recovery
+func (lm *Manager) Fail(cause error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.failed == nil {
+		lm.failed = fmt.Errorf("%w: %w", ErrLogFailed, cause)
 	}
 }
 
-func (lm *Manager) Iterator() *Iterator {
-	lm.flush()
-	return NewIterator(lm.fm, lm.currentBlock)
+// Writes the log tail to the file and returns the block currently being appended to
+// blocks before it are full and never change again
+func (lm *Manager) Position() (file.BlockID, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if err := lm.flush(); err != nil {
+		return file.BlockID{}, err
+	}
+	return lm.currentBlock, nil
+}
+
+func (lm *Manager) Iterator() (*Iterator, error) {
+	lm.mu.Lock()
+	blockId := lm.currentBlock
+	lm.mu.Unlock()
+
+	return newIterator(lm, blockId)
 }
 
 // writes the contents of the logPage into the current block
-// and updates lastSavedLSN id
-func (lm *Manager) flush() {
-	lm.fm.Write(lm.currentBlock, lm.logPage)
-	lm.lastSavedLSN = lm.latestLSN
+// the write is not durable until the log file is synced
+func (lm *Manager) flush() error {
+	blockId, err := lm.segmentBlock(lm.currentBlock.BlockNumber())
+	if err != nil {
+		return err
+	}
+	return lm.fm.Write(blockId, lm.logPage)
 }
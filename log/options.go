@@ -0,0 +1,28 @@
+package log
+
+import "github.com/nitishsharma2825/simpleDB/file"
+
+// Option configures a log manager when it is created
+type Option func(*Manager)
+
+// Starts a new segment every n blocks
+func WithSegmentBlocks(n int) Option {
+	return func(lm *Manager) {
+		lm.segmentBlocks = max(n, 1)
+	}
+}
+
+// Decides what Truncate does with the segments no longer needed
+func WithRetention(retention Retention) Option {
+	return func(lm *Manager) {
+		lm.retention = retention
+	}
+}
+
+// Moves the segments no longer needed into the storage, blocks stay encrypted
+func WithArchive(archive file.Storage) Option {
+	return func(lm *Manager) {
+		lm.retention = ARCHIVE_SEGMENTS
+		lm.archive = archive
+	}
+}
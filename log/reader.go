@@ -0,0 +1,123 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+// moves through the log oldest record first, including records appended after it was created
+
+type Reader struct {
+	lm        *Manager
+	blockId   file.BlockID
+	page      *file.Page
+	positions []int // positions of the records in the block, oldest first
+	next      int   // index in positions of the record Next returns
+	lsn       int   // lsn of the record last returned, every later record is still to come
+	tail      bool  // the block was the tail of the log when it was read
+}
+
+// Returns a reader positioned at the oldest record of the log still kept
+func (lm *Manager) Reader() (*Reader, error) {
+	reader := &Reader{
+		lm:   lm,
+		page: file.NewPageWithSize(lm.fm.BlockSize()),
+	}
+	if err := reader.Seek(0); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Positions the reader so Next returns the oldest record with an lsn of at least the one given
+// or the oldest record kept, if the lsn is in a removed segment
+func (r *Reader) Seek(lsn int) error {
+	blockNum := max(lsn, 0) / r.lm.fm.BlockSize()
+	r.lm.mu.Lock()
+	blockNum = max(min(blockNum, r.lm.currentBlock.BlockNumber()), r.lm.segments[0])
+	r.lm.mu.Unlock()
+
+	r.lsn = max(lsn-1, 0) // lsns start at 1
+	return r.moveToBlock(file.NewBlockID(r.lm.logFile, blockNum))
+}
+
+// Determines if the log holds a record after the one last returned
+func (r *Reader) HasNext() bool {
+	return r.next < len(r.positions) || r.lsn < r.lm.LatestLSN()
+}
+
+// Moves to the next log record, ErrEndOfLog if there is none
+func (r *Reader) Next() ([]byte, error) {
+	reloaded := false
+	for r.next == len(r.positions) {
+		blockId := r.blockId
+		switch {
+		case r.tail && !reloaded:
+			// records may have been appended to the block since it was read
+			reloaded = true
+		case r.lastBlock():
+			return nil, ErrEndOfLog
+		default:
+			blockId = file.NewBlockID(blockId.FileName(), blockId.BlockNumber()+1)
+		}
+		if err := r.moveToBlock(blockId); err != nil {
+			return nil, err
+		}
+	}
+	position := r.positions[r.next]
+	lsn, record, err := recordAt(r.page, position)
+	if err == nil && lsn != r.lm.lsnAt(r.blockId, position) {
+		err = fmt.Errorf("%w: lsn %d stored at lsn %d", ErrCorruptRecord, lsn, r.lm.lsnAt(r.blockId, position))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("log block %d: %w", r.blockId.BlockNumber(), err)
+	}
+	r.next++
+	r.lsn = lsn
+	return record, nil
+}
+
+// Returns the lsn of the record last returned by Next
+func (r *Reader) LSN() int {
+	return r.lsn
+}
+
+// reads the block and finds its records after the one last returned
+func (r *Reader) moveToBlock(blockId file.BlockID) error {
+	tail, err := r.lm.readBlock(blockId, r.page)
+	if err != nil {
+		return err
+	}
+	r.tail = tail
+	r.blockId = blockId
+	r.positions = r.positions[:0]
+	r.next = 0
+
+	blockSize := r.lm.fm.BlockSize()
+	boundary := r.page.GetInt(0)
+	if boundary == 0 {
+		// appended just before a crash, there are no records
+		boundary = blockSize
+	}
+	// walk from the oldest record at the end of the block to the newest one at the boundary
+	// the sizes are checked again when the records are read
+	for end := blockSize; end > boundary && end-recordTrailer >= file.IntBytes; {
+		pos := end - file.IntBytes - r.page.GetInt(end-recordTrailer)
+		if pos < boundary {
+			return fmt.Errorf("log block %d: %w: record ending at %d overlaps the boundary", blockId.BlockNumber(), ErrCorruptRecord, end)
+		}
+		if r.lm.lsnAt(blockId, pos) > r.lsn {
+			r.positions = append(r.positions, pos)
+		}
+		end = pos
+	}
+	return nil
+}
+
+func (r *Reader) lastBlock() bool {
+	r.lm.mu.Lock()
+	defer r.lm.mu.Unlock()
+
+	return r.blockId.BlockNumber() >= r.lm.currentBlock.BlockNumber()
+}
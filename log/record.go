@@ -0,0 +1,79 @@
+package log
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+// Framing of a log record in its block: [size 4][crc 4][lsn 8][bytes of the record][size 4]
+// the trailing size lets the records of a torn block be walked from its end
+
+// size of the lsn stored in front of every record
+const LSN_BYTES = 8
+
+const (
+	crcBytes      = 4
+	recordHeader  = crcBytes + LSN_BYTES
+	recordTrailer = 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// frames the record's bytes, the result is stored behind the size prefix
+func frameRecord(lsn int, data []byte) []byte {
+	framed := make([]byte, recordHeader+len(data)+recordTrailer)
+	binary.BigEndian.PutUint64(framed[crcBytes:], uint64(lsn))
+	copy(framed[recordHeader:], data)
+	binary.BigEndian.PutUint32(framed[len(framed)-recordTrailer:], uint32(len(framed)))
+	binary.BigEndian.PutUint32(framed, crc32.Checksum(framed[crcBytes:], crcTable))
+	return framed
+}
+
+// checks the framed record and returns its lsn and bytes
+// ErrCorruptRecord if it fails verification
+func unframeRecord(framed []byte) (int, []byte, error) {
+	if len(framed) < recordHeader+recordTrailer {
+		return 0, nil, fmt.Errorf("%w: %d bytes is too short", ErrCorruptRecord, len(framed))
+	}
+	if size := int(binary.BigEndian.Uint32(framed[len(framed)-recordTrailer:])); size != len(framed) {
+		return 0, nil, fmt.Errorf("%w: size %d, trailer says %d", ErrCorruptRecord, len(framed), size)
+	}
+	stored := binary.BigEndian.Uint32(framed)
+	if computed := crc32.Checksum(framed[crcBytes:], crcTable); stored != computed {
+		return 0, nil, fmt.Errorf("%w: stored crc %08x, computed %08x", ErrCorruptRecord, stored, computed)
+	}
+	lsn := int(binary.BigEndian.Uint64(framed[crcBytes:]))
+	return lsn, framed[recordHeader : len(framed)-recordTrailer], nil
+}
+
+// reads and checks the record stored at the position of the page
+// ErrCorruptRecord if there is no intact record there
+func recordAt(page *file.Page, position int) (int, []byte, error) {
+	blockSize := len(page.Contents())
+	if position < file.IntBytes || position+file.IntBytes > blockSize {
+		return 0, nil, fmt.Errorf("%w: position %d", ErrCorruptRecord, position)
+	}
+	if size := page.GetInt(position); size > blockSize-position-file.IntBytes {
+		return 0, nil, fmt.Errorf("%w: size %d at position %d", ErrCorruptRecord, size, position)
+	}
+	return unframeRecord(page.GetBytes(position))
+}
+
+// returns the position of the newest intact record walking from the end, the block size if there is none
+func intactBoundary(page *file.Page, blockId file.BlockID, lsnAt func(file.BlockID, int) int) int {
+	blockSize := len(page.Contents())
+	end := blockSize
+	for end-recordTrailer >= file.IntBytes {
+		size := page.GetInt(end - recordTrailer)
+		position := end - size - file.IntBytes
+		lsn, _, err := recordAt(page, position)
+		if err != nil || lsn != lsnAt(blockId, position) {
+			break
+		}
+		end = position
+	}
+	return end
+}
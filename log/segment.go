@@ -0,0 +1,122 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+// The log is split into segment files named after their first block, e.g. simpledb.log.000000256
+// block numbers and lsns run on across segments as if the log were one file
+
+// Number of blocks in a segment, unless WithSegmentBlocks says otherwise
+const SEGMENT_BLOCKS = 256
+
+// width of the block number in a segment's name
+const segmentDigits = 9
+
+// What Truncate does with the segments no longer needed
+type Retention int
+
+const (
+	// segments are never removed, the log keeps growing
+	KEEP_SEGMENTS Retention = iota
+	// segments are deleted
+	DELETE_SEGMENTS
+	// segments are moved to the archive storage
+	ARCHIVE_SEGMENTS
+)
+
+// name of the segment starting at the block
+func SegmentFile(logFile string, firstBlock int) string {
+	return fmt.Sprintf("%s.%0*d", logFile, segmentDigits, firstBlock)
+}
+
+// Reports whether the file is a segment of the log, and the number of its first block
+func IsSegmentFile(logFile string, filename string) (int, bool) {
+	suffix, ok := strings.CutPrefix(filename, logFile+".")
+	if !ok || len(suffix) != segmentDigits {
+		return 0, false
+	}
+	firstBlock, err := strconv.Atoi(suffix)
+	if err != nil || firstBlock < 0 {
+		return 0, false
+	}
+	return firstBlock, true
+}
+
+// returns the first block of every segment in the storage, oldest first
+func (lm *Manager) listSegments() ([]int, error) {
+	files, err := lm.fm.Files()
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]int, 0)
+	for _, filename := range files {
+		if firstBlock, ok := IsSegmentFile(lm.logFile, filename); ok {
+			segments = append(segments, firstBlock)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// Returns the block of the segment file holding the log block
+// ErrLogTruncated if its segment was removed
+func (lm *Manager) SegmentBlock(blockNum int) (file.BlockID, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.segmentBlock(blockNum)
+}
+
+// Returns the number of the oldest log block still kept
+func (lm *Manager) FirstBlock() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.segments[0]
+}
+
+func (lm *Manager) segmentBlock(blockNum int) (file.BlockID, error) {
+	if blockNum < lm.segments[0] {
+		return file.BlockID{}, fmt.Errorf("log block %d: %w", blockNum, ErrLogTruncated)
+	}
+	// the last segment starting at or before the block
+	i := sort.SearchInts(lm.segments, blockNum+1) - 1
+	firstBlock := lm.segments[i]
+	return file.NewBlockID(SegmentFile(lm.logFile, firstBlock), blockNum-firstBlock), nil
+}
+
+/*
+Removes the segments whose records all come before the lsn, e.g. that of a quiescent checkpoint,
+following the retention policy
+*/
+func (lm *Manager) Truncate(lsn int) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.retention == KEEP_SEGMENTS {
+		return nil
+	}
+	if lm.retention == ARCHIVE_SEGMENTS && lm.archive == nil {
+		return fmt.Errorf("truncate log: archiving segments needs an archive storage, see WithArchive")
+	}
+	blockNum := lsn / lm.fm.BlockSize()
+	for len(lm.segments) > 1 && lm.segments[1] <= blockNum {
+		filename := SegmentFile(lm.logFile, lm.segments[0])
+		if lm.retention == ARCHIVE_SEGMENTS {
+			if err := file.CopyFile(lm.fm.Storage(), lm.archive, filename); err != nil {
+				return fmt.Errorf("archive %s: %w", filename, err)
+			}
+		}
+		if err := lm.fm.Remove(filename); err != nil {
+			return err
+		}
+		lm.segments = lm.segments[1:]
+	}
+	return nil
+}
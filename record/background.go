@@ -0,0 +1,182 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+var ErrCheckpointBusy = errors.New("txns kept running while the checkpoint waited for them")
+
+/*
+Background work of the database
+The writer trickles out modified buffers so evictions rarely wait for a write,
+the checkpointer takes a quiescent checkpoint at every interval to bound recovery
+*/
+
+// keeps txns from starting while a checkpoint runs
+type txnGate struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{} // closed when the last running txn ends while the gate is shut
+	open   chan struct{} // non-nil while the gate is shut, closed when it opens again
+}
+
+// waits until the gate is open and counts the txn as running
+func (g *txnGate) enter() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for g.open != nil {
+		open := g.open
+		g.mu.Unlock()
+		<-open
+		g.mu.Lock()
+	}
+	g.active++
+}
+
+func (g *txnGate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.active--
+	if g.active == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// shuts the gate and waits for the running txns to end
+// if the context ends first the gate opens again and the context's error is returned
+func (g *txnGate) shut(ctx context.Context) error {
+	g.mu.Lock()
+	g.open = make(chan struct{})
+	if g.active == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	g.idle = make(chan struct{})
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		g.reopen()
+		return ctx.Err()
+	}
+}
+
+func (g *txnGate) reopen() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	close(g.open)
+	g.open = nil
+	g.idle = nil
+}
+
+type background struct {
+	mu   sync.Mutex
+	stop chan struct{} // nil unless running
+	done sync.WaitGroup
+	// the workers set lastErr while StopBackground holds mu and waits for them
+	errMu   sync.Mutex
+	lastErr error
+}
+
+/*
+Takes a quiescent checkpoint, new txns wait while it runs
+ErrCheckpointBusy if the context ends before the running txns do
+*/
+func (s *SimpleDB) Checkpoint(ctx context.Context) error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	if err := s.gate.shut(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrCheckpointBusy, err)
+	}
+	defer s.gate.reopen()
+	return tx.Checkpoint(s.fm, s.lm, s.bm)
+}
+
+/*
+Starts the background writer and checkpointer as configured, opening the database starts them
+*/
+func (s *SimpleDB) StartBackground() {
+	s.background.mu.Lock()
+	defer s.background.mu.Unlock()
+
+	if s.background.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.background.stop = stop
+	if s.cfg.writerInterval > 0 {
+		s.runEvery(stop, s.cfg.writerInterval, func() error {
+			_, err := s.bm.WriteDirty(s.cfg.writerBatch)
+			return err
+		})
+	}
+	if s.cfg.checkpointInterval > 0 {
+		s.runEvery(stop, s.cfg.checkpointInterval, func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), s.cfg.checkpointWait)
+			defer cancel()
+			err := s.Checkpoint(ctx)
+			if errors.Is(err, ErrCheckpointBusy) {
+				// tried again at the next interval
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// Stops the background writer and checkpointer and waits for them to finish
+func (s *SimpleDB) StopBackground() {
+	s.background.mu.Lock()
+	defer s.background.mu.Unlock()
+
+	if s.background.stop == nil {
+		return
+	}
+	close(s.background.stop)
+	s.background.stop = nil
+	s.background.done.Wait()
+}
+
+// Returns the last error of the background writer or checkpointer, nil if there was none
+func (s *SimpleDB) BackgroundErr() error {
+	s.background.errMu.Lock()
+	defer s.background.errMu.Unlock()
+
+	return s.background.lastErr
+}
+
+func (s *SimpleDB) runEvery(stop chan struct{}, interval time.Duration, work func() error) {
+	s.background.done.Add(1)
+	go func() {
+		defer s.background.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if err := work(); err != nil {
+				s.background.errMu.Lock()
+				s.background.lastErr = err
+				s.background.errMu.Unlock()
+			}
+		}
+	}()
+}
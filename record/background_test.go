@@ -0,0 +1,207 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+)
+
+// waits until cond holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBackgroundWriter(t *testing.T) {
+	db := setupCrashDB(file.NewMemStorage(), WithBackgroundWriter(5*time.Millisecond, 4))
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	for i := range 10 {
+		db.Planner().ExecuteUpdate(fmt.Sprintf("insert into crash(a, b) values (%d, 'row')", i), tx)
+	}
+	tx.Commit()
+
+	// the commit made the log durable, the writer cleans every frame left unpinned
+	waitFor(t, "every unpinned frame written", func() bool {
+		for _, frame := range db.BufferMgr().Frames() {
+			if frame.Dirty && frame.Pins == 0 {
+				return false
+			}
+		}
+		return true
+	})
+	if err := db.BackgroundErr(); err != nil {
+		t.Fatalf("background writer: %v", err)
+	}
+
+	db.StopBackground()
+	tx = db.NewTx()
+	db.Planner().ExecuteUpdate("insert into crash(a, b) values (10, 'row')", tx)
+	tx.Commit()
+	time.Sleep(20 * time.Millisecond)
+	if stats := db.BufferMgr().Stats(); stats.DirtyFlushes == 0 {
+		t.Fatalf("expected dirty flushes")
+	}
+	dirty := 0
+	for _, frame := range db.BufferMgr().Frames() {
+		if frame.Dirty && frame.Pins == 0 {
+			dirty++
+		}
+	}
+	if dirty == 0 {
+		t.Fatalf("expected the stopped writer to leave dirty frames")
+	}
+}
+
+func TestCheckpointScheduler(t *testing.T) {
+	storage := file.NewMemStorage()
+	logOpts := WithLogOptions(log.WithSegmentBlocks(1), log.WithRetention(log.DELETE_SEGMENTS))
+	db := setupCrashDB(storage, logOpts, WithCheckpoints(10*time.Millisecond, time.Second))
+	t.Cleanup(func() {
+		db.Close()
+	})
+	for i := range 50 {
+		tx := db.NewTx()
+		db.Planner().ExecuteUpdate(fmt.Sprintf("insert into crash(a, b) values (%d, 'row')", i), tx)
+		tx.Commit()
+	}
+
+	// checkpoints remove the segments before them without reopening the database
+	waitFor(t, "the oldest segments removed", func() bool {
+		return db.LogMgr().FirstBlock() > 0
+	})
+	if err := db.BackgroundErr(); err != nil {
+		t.Fatalf("checkpointer: %v", err)
+	}
+	db.StopBackground()
+
+	tx := db.NewTx()
+	scan := db.Planner().CreateQueryPlan("select a from crash", tx).Open()
+	rows := 0
+	for scan.Next() {
+		rows++
+	}
+	scan.Close()
+	tx.Commit()
+	if rows != 50 {
+		t.Fatalf("expected %d rows, got %d", 50, rows)
+	}
+}
+
+func TestCheckpointWaitsForTxns(t *testing.T) {
+	db := setupCrashDB(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	db.Planner().ExecuteUpdate("insert into crash(a, b) values (1, 'row')", tx)
+
+	// the running txn outlives the wait
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := db.Checkpoint(ctx); !errors.Is(err, ErrCheckpointBusy) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", ErrCheckpointBusy, err)
+	}
+
+	// new txns wait for the checkpoint, which waits for the running txn
+	done := make(chan error)
+	go func() {
+		done <- db.Checkpoint(context.Background())
+	}()
+	waitFor(t, "the gate shut", func() bool {
+		db.gate.mu.Lock()
+		defer db.gate.mu.Unlock()
+		return db.gate.open != nil
+	})
+	started := make(chan struct{})
+	go func() {
+		next := db.NewTx()
+		close(started)
+		next.Commit()
+	}()
+	select {
+	case <-started:
+		t.Fatalf("expected the new txn to wait for the checkpoint")
+	case <-time.After(20 * time.Millisecond):
+	}
+	tx.Commit()
+	if err := <-done; err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+	<-started
+	for _, frame := range db.BufferMgr().Frames() {
+		if frame.Dirty && frame.ModifyingTxn == tx.TxNum() {
+			t.Fatalf("expected the checkpoint to write every frame, got %+v", frame)
+		}
+	}
+}
+
+// storage whose syncs fail while failing is set
+type failingSyncStorage struct {
+	file.Storage
+	failing atomic.Bool
+}
+
+func (s *failingSyncStorage) Open(filename string) (file.BlockDevice, error) {
+	dev, err := s.Storage.Open(filename)
+	return failingSyncDevice{dev, s}, err
+}
+
+type failingSyncDevice struct {
+	file.BlockDevice
+	storage *failingSyncStorage
+}
+
+func (d failingSyncDevice) Sync() error {
+	if d.storage.failing.Load() {
+		return errors.New("sync failed")
+	}
+	return d.BlockDevice.Sync()
+}
+
+// stopping the background work never waits on a worker reporting an error
+func TestStopBackgroundFailingCheckpoint(t *testing.T) {
+	storage := &failingSyncStorage{Storage: file.NewMemStorage()}
+	db := setupCrashDB(storage, WithCheckpoints(time.Microsecond, time.Second))
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		// a deadlocked database is left open
+		select {
+		case <-stopped:
+			storage.failing.Store(false)
+			db.Close()
+		default:
+		}
+	})
+	storage.failing.Store(true)
+
+	go func() {
+		defer close(stopped)
+		for range 50 {
+			db.StartBackground()
+			time.Sleep(time.Millisecond)
+			db.StopBackground()
+		}
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the background work to stop")
+	}
+	if db.BackgroundErr() == nil {
+		t.Fatalf("expected the failed checkpoints to be reported")
+	}
+}
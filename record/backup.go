@@ -0,0 +1,195 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+/*
+Online backup of a running database
+Writers keep running while the files are copied, the log tail is copied last
+so recovery of the copy redoes every change found in the copied blocks
+*/
+
+var ErrDatabaseExists = errors.New("directory already holds a database")
+
+/*
+Copies the database into destDir, which must not exist yet
+The copy is a database of its own, opened with the same options as this one
+*/
+func (s *SimpleDB) Backup(destDir string) error {
+	storage, err := file.NewOSStorage(destDir)
+	if err != nil {
+		return err
+	}
+	if !storage.IsNew() {
+		return fmt.Errorf("backup to %s: %w", destDir, ErrDatabaseExists)
+	}
+	return s.BackupToStorage(storage)
+}
+
+/*
+Copies the database into an empty storage
+Appends wait while the log tail is copied, and no checkpoint runs during the backup
+*/
+func (s *SimpleDB) BackupToStorage(storage file.Storage) error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	dest, err := file.NewFileManagerWithStorage(storage, s.fm.BlockSize(), s.fileOptions...)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	// blocks before the starting position are final, copy them right away
+	logStart, err := s.lm.Position()
+	if err != nil {
+		return err
+	}
+	if err := s.copyLogBlocks(dest, s.lm.FirstBlock(), logStart.BlockNumber()); err != nil {
+		return err
+	}
+
+	copied := make(map[string]int)
+	files, err := s.dataFiles()
+	if err != nil {
+		return err
+	}
+	for _, filename := range files {
+		size, err := s.fm.Length(filename)
+		if err != nil {
+			return err
+		}
+		if err := copyBlocks(s.fm, dest, filename, 0, size); err != nil {
+			return err
+		}
+		copied[filename] = size
+	}
+
+	// lock the end of every file so no block is appended until the log tail is copied
+	txn := s.NewTx()
+	if err := s.copyAppendedBlocks(txn, dest, copied); err != nil {
+		txn.Rollback()
+		return err
+	}
+	logEnd, err := s.lm.Position()
+	if err == nil {
+		err = s.copyLogBlocks(dest, logStart.BlockNumber(), logEnd.BlockNumber()+1)
+	}
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	// every txn in the copied log got its number before this point
+	if err := dest.AdvanceTxNum(s.fm.Superblock().NextTxNum); err != nil {
+		return err
+	}
+	return dest.SyncAll()
+}
+
+// copies the blocks appended since the first pass, holding the end of file lock of every file
+func (s *SimpleDB) copyAppendedBlocks(txn *tx.Transaction, dest *file.Manager, copied map[string]int) error {
+	files, err := s.dataFiles()
+	if err != nil {
+		return err
+	}
+	for _, filename := range files {
+		size, err := txn.Size(filename)
+		if err != nil {
+			return err
+		}
+		if err := copyBlocks(s.fm, dest, filename, copied[filename], size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns every file except the log segments
+func (s *SimpleDB) dataFiles() ([]string, error) {
+	files, err := s.fm.Files()
+	if err != nil {
+		return nil, err
+	}
+	dataFiles := make([]string, 0, len(files))
+	for _, filename := range files {
+		if _, ok := log.IsSegmentFile(LOG_FILE, filename); !ok {
+			dataFiles = append(dataFiles, filename)
+		}
+	}
+	return dataFiles, nil
+}
+
+// copies log blocks [from, to) into the same segments of the copy
+func (s *SimpleDB) copyLogBlocks(dest *file.Manager, from int, to int) error {
+	for blockNum := from; blockNum < to; blockNum++ {
+		blockId, err := s.lm.SegmentBlock(blockNum)
+		if err != nil {
+			return err
+		}
+		if err := copyBlocks(s.fm, dest, blockId.FileName(), blockId.BlockNumber(), blockId.BlockNumber()+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copies blocks [from, to) of the file, verifying each and sealing it again for the copy
+func copyBlocks(src *file.Manager, dest *file.Manager, filename string, from int, to int) error {
+	page := file.NewPageWithSize(src.BlockSize())
+	for blockNum := from; blockNum < to; blockNum++ {
+		blockId := file.NewBlockID(filename, blockNum)
+		if err := src.Read(blockId, page); err != nil {
+			return err
+		}
+		if err := dest.Write(blockId, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Copies a backup into dbDir, which must not exist yet, opening dbDir recovers it
+*/
+func Restore(backupDir string, dbDir string) error {
+	// opening the storage would create a missing directory
+	if _, err := os.Stat(backupDir); err != nil {
+		return fmt.Errorf("restore from %s: %w", backupDir, err)
+	}
+	src, err := file.NewOSStorage(backupDir)
+	if err != nil {
+		return err
+	}
+	dest, err := file.NewOSStorage(dbDir)
+	if err != nil {
+		return err
+	}
+	if !dest.IsNew() {
+		return fmt.Errorf("restore to %s: %w", dbDir, ErrDatabaseExists)
+	}
+
+	names, err := src.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name == file.LOCK_FILE {
+			continue
+		}
+		if err := file.CopyFile(src, dest, name); err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+func TestBackupWithConcurrentWriters(t *testing.T) {
+	const numWriters = 3
+	dir := t.TempDir()
+	dbDir := path.Join(dir, "db")
+	backupDir := path.Join(dir, "backup")
+	restoreDir := path.Join(dir, "restored")
+
+	db := NewSimpleDB(dbDir)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	planner := db.Planner()
+
+	tx := db.NewTx()
+	for w := range numWriters {
+		planner.ExecuteUpdate(fmt.Sprintf("create table w%d(A int, B varchar(8))", w), tx)
+	}
+	planner.ExecuteUpdate("create table pending(A int, B varchar(8))", tx)
+	planner.ExecuteUpdate("insert into pending(A, B) values (0, 'done')", tx)
+	tx.Commit()
+
+	// this txn is still running when the backup is taken, so its row must not survive
+	pendingTx := db.NewTx()
+	planner.ExecuteUpdate("insert into pending(A, B) values (1, 'open')", pendingTx)
+
+	// every writer commits pairs of rows, a consistent copy holds both rows of a pair or neither
+	// the writers go through table scans, the planner's statistics refresh would make them wait on each other
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for w := range numWriters {
+		tblname := fmt.Sprintf("w%d", w)
+		tx := db.NewTx()
+		layout := db.MdMgr().GetLayout(tblname, tx)
+		tx.Commit()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; !stop.Load(); i++ {
+				tx := db.NewTx()
+				scan := NewTableScan(tx, tblname, layout)
+				for _, b := range []string{"first", "second"} {
+					scan.Insert()
+					scan.SetInt("a", i)
+					scan.SetString("b", b)
+				}
+				scan.Close()
+				tx.Commit()
+			}
+		}()
+	}
+
+	err := db.Backup(backupDir)
+	stop.Store(true)
+	wg.Wait()
+	pendingTx.Rollback()
+	if err != nil {
+		t.Fatalf("failed to back up: %v", err)
+	}
+
+	if err := db.Backup(backupDir); !errors.Is(err, ErrDatabaseExists) {
+		t.Fatalf("expected %v when backing up over a database, got %v", ErrDatabaseExists, err)
+	}
+	if err := Restore(backupDir, restoreDir); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+
+	restored := NewSimpleDB(restoreDir)
+	t.Cleanup(func() {
+		restored.Close()
+	})
+	tx = restored.NewTx()
+	for w := range numWriters {
+		rows := make(map[int]int)
+		tblname := fmt.Sprintf("w%d", w)
+		scan := NewTableScan(tx, tblname, restored.MdMgr().GetLayout(tblname, tx))
+		for scan.Next() {
+			rows[scan.GetInt("a")]++
+		}
+		scan.Close()
+		for i := range len(rows) {
+			if rows[i] != 2 {
+				t.Fatalf("writer %d: expected %d rows for pair %d, got %d", w, 2, i, rows[i])
+			}
+		}
+		t.Logf("writer %d: %d pairs in the backup", w, len(rows))
+	}
+
+	scan := NewTableScan(tx, "pending", restored.MdMgr().GetLayout("pending", tx))
+	count := 0
+	for scan.Next() {
+		if scan.GetString("b") != "done" {
+			t.Fatalf("expected only the committed row, got %q", scan.GetString("b"))
+		}
+		count++
+	}
+	scan.Close()
+	if count != 1 {
+		t.Fatalf("expected %d pending rows, got %d", 1, count)
+	}
+	tx.Commit()
+}
+
+func TestBackupDuringCheckpoints(t *testing.T) {
+	const numWriters = 3
+	db := NewSimpleDB(path.Join(t.TempDir(), "db"), WithCheckpoints(time.Millisecond, 100*time.Millisecond))
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	for w := range numWriters {
+		db.Planner().ExecuteUpdate(fmt.Sprintf("create table w%d(A int, B varchar(8))", w), tx)
+	}
+	tx.Commit()
+
+	// a checkpoint between copying the data files and the log tail would cut the copy's recovery short,
+	// losing the rows committed meanwhile
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for w := range numWriters {
+		tblname := fmt.Sprintf("w%d", w)
+		tx := db.NewTx()
+		layout := db.MdMgr().GetLayout(tblname, tx)
+		tx.Commit()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; !stop.Load(); i++ {
+				tx := db.NewTx()
+				scan := NewTableScan(tx, tblname, layout)
+				scan.Insert()
+				scan.SetInt("a", i)
+				scan.Close()
+				tx.Commit()
+			}
+		}()
+	}
+
+	// the copy is slowed down so checkpoints run while it is taken
+	time.Sleep(20 * time.Millisecond)
+	backup := file.NewMemStorage()
+	err := db.BackupToStorage(slowStorage{backup})
+	stop.Store(true)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("failed to back up: %v", err)
+	}
+
+	restored := NewSimpleDBWithStorage(backup)
+	t.Cleanup(func() {
+		restored.Close()
+	})
+	tx = restored.NewTx()
+	for w := range numWriters {
+		rows := make(map[int]bool)
+		tblname := fmt.Sprintf("w%d", w)
+		scan := NewTableScan(tx, tblname, restored.MdMgr().GetLayout(tblname, tx))
+		for scan.Next() {
+			rows[scan.GetInt("a")] = true
+		}
+		scan.Close()
+		for i := range len(rows) {
+			if !rows[i] {
+				t.Fatalf("writer %d: row %d is missing from the backup of %d rows", w, i, len(rows))
+			}
+		}
+		t.Logf("writer %d: %d rows", w, len(rows))
+	}
+	tx.Commit()
+}
+
+// storage whose writes take a while
+type slowStorage struct {
+	file.Storage
+}
+
+func (s slowStorage) Open(filename string) (file.BlockDevice, error) {
+	dev, err := s.Storage.Open(filename)
+	return slowDevice{dev}, err
+}
+
+type slowDevice struct {
+	file.BlockDevice
+}
+
+func (d slowDevice) WriteAt(p []byte, off int64) (int, error) {
+	time.Sleep(time.Millisecond)
+	return d.BlockDevice.WriteAt(p, off)
+}
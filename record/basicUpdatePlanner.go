@@ -13,6 +13,7 @@ func NewBasicUpdatePlanner(mdm *MetadataManager) *BasicUpdatePlanner {
 }
 
 func (bup *BasicUpdatePlanner) ExecuteDelete(data *DeleteData, tx *tx.Transaction) int {
+	bup.mdm.checkWritable(data.TblName)
 	tablePlan := NewTablePlan(tx, data.TblName, bup.mdm)
 	selectPlan := NewSelectPlan(tablePlan, data.Pred)
 	updateScan := selectPlan.Open().(*SelectScan)
@@ -26,6 +27,7 @@ func (bup *BasicUpdatePlanner) ExecuteDelete(data *DeleteData, tx *tx.Transactio
 }
 
 func (bup *BasicUpdatePlanner) ExecuteModify(data *ModifyData, tx *tx.Transaction) int {
+	bup.mdm.checkWritable(data.TblName)
 	tablePlan := NewTablePlan(tx, data.TblName, bup.mdm)
 	selectPlan := NewSelectPlan(tablePlan, data.Pred)
 	updateScan := selectPlan.Open().(*SelectScan)
@@ -40,6 +42,7 @@ func (bup *BasicUpdatePlanner) ExecuteModify(data *ModifyData, tx *tx.Transactio
 }
 
 func (bup *BasicUpdatePlanner) ExecuteInsert(data *InsertData, tx *tx.Transaction) int {
+	bup.mdm.checkWritable(data.TblName)
 	tablePlan := NewTablePlan(tx, data.TblName, bup.mdm)
 	updateScan := tablePlan.Open().(*TableScan)
 	updateScan.Insert()
@@ -51,6 +54,7 @@ func (bup *BasicUpdatePlanner) ExecuteInsert(data *InsertData, tx *tx.Transactio
 }
 
 func (bup *BasicUpdatePlanner) ExecuteCreateTable(data *CreateTableData, tx *tx.Transaction) int {
+	bup.mdm.checkWritable(data.TblName)
 	bup.mdm.CreateTable(data.TblName, data.Schema, tx)
 	return 0
 }
@@ -35,9 +35,16 @@ func NewBTreeIndex(tx *tx.Transaction, idxname string, leafLayout *Layout) *BTre
 
 	// deal with the leaves
 	index.leafTable = fmt.Sprintf("%q%q", idxname, "leaf")
-	if tx.Size(index.leafTable) == 0 {
+	leafSize, err := tx.Size(index.leafTable)
+	if err != nil {
+		panic(err)
+	}
+	if leafSize == 0 {
 		// Add a block to the leaf index file
-		block := tx.Append(index.leafTable)
+		block, err := tx.Append(index.leafTable)
+		if err != nil {
+			panic(err)
+		}
 		node := NewBTPage(tx, &block, index.leafLayout)
 		node.Format(&block, -1)
 	}
@@ -50,9 +57,15 @@ func NewBTreeIndex(tx *tx.Transaction, idxname string, leafLayout *Layout) *BTre
 	index.dirLayout = NewLayout(dirSchema)
 	rootBlock := file.NewBlockID(dirTable, 0)
 	index.rootBlock = &rootBlock
-	if tx.Size(dirTable) == 0 {
+	dirSize, err := tx.Size(dirTable)
+	if err != nil {
+		panic(err)
+	}
+	if dirSize == 0 {
 		// create new root block
-		tx.Append(dirTable)
+		if _, err := tx.Append(dirTable); err != nil {
+			panic(err)
+		}
 		node := NewBTPage(tx, &rootBlock, index.dirLayout)
 		node.Format(&rootBlock, 0)
 		// insert initial directory entry
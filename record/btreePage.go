@@ -29,7 +29,9 @@ func NewBTPage(tx *tx.Transaction, currentBlock *file.BlockID, layout *Layout) *
 		currentBlock: currentBlock,
 		layout:       layout,
 	}
-	tx.Pin(*currentBlock)
+	if err := tx.Pin(*currentBlock); err != nil {
+		panic(err)
+	}
 	return btPage
 }
 
@@ -90,7 +92,11 @@ func (btpage *BTPage) SetFlag(val int) {
 
 // get the flag value for the block
 func (btpage *BTPage) GetFlag() int {
-	return btpage.tx.GetInt(*btpage.currentBlock, 0)
+	val, err := btpage.tx.GetInt(*btpage.currentBlock, 0)
+	if err != nil {
+		panic(err)
+	}
+	return val
 }
 
 /*
@@ -98,14 +104,19 @@ Append a new block to the end of the specified B-tree file,
 having the specified flag value
 */
 func (btpage *BTPage) AppendNew(flag int) *file.BlockID {
-	block := btpage.tx.Append(btpage.currentBlock.FileName())
-	btpage.tx.Pin(block)
+	block, err := btpage.tx.Append(btpage.currentBlock.FileName())
+	if err != nil {
+		panic(err)
+	}
+	if err := btpage.tx.Pin(block); err != nil {
+		panic(err)
+	}
 	btpage.Format(&block, flag)
 	return &block
 }
 
 func (btpage *BTPage) Format(block *file.BlockID, flag int) {
-	btpage.tx.SetInt(*block, 0, flag, false)
+	btpage.tx.SetInt(*block, 0, flag, true)           // logged, recovery must redo it on a new block
 	btpage.tx.SetInt(*block, file.IntBytes, 0, false) // #records = 0
 	recordSize := btpage.layout.SlotSize()
 	for pos := 2 * file.IntBytes; pos+recordSize <= btpage.tx.BlockSize(); pos += recordSize {
@@ -168,7 +179,11 @@ Return the numnber of index records in this page
 The 4th-7th bit contains the number of records
 */
 func (btpage *BTPage) GetNumRecs() int {
-	return btpage.tx.GetInt(*btpage.currentBlock, file.IntBytes)
+	val, err := btpage.tx.GetInt(*btpage.currentBlock, file.IntBytes)
+	if err != nil {
+		panic(err)
+	}
+	return val
 }
 
 // private methods
@@ -186,12 +201,20 @@ func (btpage *BTPage) getVal(slot int, fieldname string) *Constant {
 
 func (btpage *BTPage) getInt(slot int, fieldname string) int {
 	pos := btpage.fieldPos(slot, fieldname)
-	return btpage.tx.GetInt(*btpage.currentBlock, pos)
+	val, err := btpage.tx.GetInt(*btpage.currentBlock, pos)
+	if err != nil {
+		panic(err)
+	}
+	return val
 }
 
 func (btpage *BTPage) getString(slot int, fieldname string) string {
 	pos := btpage.fieldPos(slot, fieldname)
-	return btpage.tx.GetString(*btpage.currentBlock, pos)
+	val, err := btpage.tx.GetString(*btpage.currentBlock, pos)
+	if err != nil {
+		panic(err)
+	}
+	return val
 }
 
 func (btpage *BTPage) setVal(slot int, fldname string, val *Constant) {
@@ -24,10 +24,16 @@ func TestCatalog(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	tx := tx.NewTransaction(fm, lm, bm)
+	tx, err := tx.NewTransaction(fm, lm, bm)
+	if err != nil {
+		t.Fatalf("failed to start txn: %v", err)
+	}
 	tableManager := NewTableManager(true, tx) // keep it false if data files exist
 	tcatLayout := tableManager.GetLayout("tblcat", tx)
 
@@ -50,4 +56,5 @@ func TestCatalog(t *testing.T) {
 		t.Logf("%q %q %d", tname, fname, offset)
 	}
 	ts.Close()
+	tx.Commit()
 }
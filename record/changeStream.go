@@ -0,0 +1,338 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+/*
+Change data capture
+A ChangeStream reads the log and turns every durably committed txn into row events,
+decoded with the layouts of the tables, and can be resumed from the Position it reported
+*/
+
+const (
+	CHANGE_INSERT = "insert"
+	CHANGE_UPDATE = "update"
+	CHANGE_DELETE = "delete"
+)
+
+// A row changed by a committed txn
+type ChangeEvent struct {
+	LSN   int            `json:"lsn"` // lsn of the txn's COMMIT record
+	TxNum int            `json:"txnum"`
+	Table string         `json:"table"`
+	Op    string         `json:"op"`
+	Block int            `json:"block"`
+	Slot  int            `json:"slot"`
+	New   map[string]any `json:"new,omitempty"` // values of an inserted row, changed values of an updated row
+	Old   map[string]any `json:"old,omitempty"` // values of a deleted row, previous values of an updated row
+}
+
+// Where a stream stands in the log
+// ReadFrom is where reading resumes, the START of the oldest txn still running,
+// and Committed is the COMMIT record of the last txn already returned
+type ChangePosition struct {
+	ReadFrom  int `json:"read_from"`
+	Committed int `json:"committed"`
+}
+
+type ChangeStream struct {
+	db        *SimpleDB
+	reader    *log.Reader
+	pending   map[int]*pendingTxn
+	layouts   map[string]*Layout
+	committed int
+	lastRead  int
+}
+
+// the records of a txn that has not finished yet
+type pendingTxn struct {
+	start   int
+	updates []tx.UpdateRecord
+}
+
+/*
+Starts a stream of the txns committed after the position
+The zero position starts at the oldest record kept in the log
+*/
+func (s *SimpleDB) Subscribe(from ChangePosition) (*ChangeStream, error) {
+	txn := s.NewTx()
+	layouts := s.mdm.GetLayouts(txn)
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	reader, err := s.lm.Reader()
+	if err != nil {
+		return nil, err
+	}
+	if first := s.lm.FirstBlock() * s.fm.BlockSize(); from.ReadFrom > 0 && from.ReadFrom <= first {
+		return nil, fmt.Errorf("subscribe from lsn %d: %w", from.ReadFrom, log.ErrLogTruncated)
+	}
+	if err := reader.Seek(from.ReadFrom); err != nil {
+		return nil, err
+	}
+	return &ChangeStream{
+		db:        s,
+		reader:    reader,
+		pending:   make(map[int]*pendingTxn),
+		layouts:   layouts,
+		committed: from.Committed,
+		lastRead:  max(from.ReadFrom-1, 0),
+	}, nil
+}
+
+// Returns the events of the txns committed since the last call, oldest txn first
+func (cs *ChangeStream) Poll() ([]ChangeEvent, error) {
+	events := make([]ChangeEvent, 0)
+	durable := cs.db.lm.DurableLSN()
+	for cs.reader.HasNext() {
+		buf, err := cs.reader.Next()
+		if err != nil {
+			return events, err
+		}
+		lsn := cs.reader.LSN()
+		if lsn > durable {
+			// not durable yet, a crash could still take it away
+			return events, cs.reader.Seek(lsn)
+		}
+		cs.lastRead = lsn
+
+		record, err := tx.CreateLogRecord(buf)
+		if err != nil {
+			return events, fmt.Errorf("log record %d: %w", lsn, err)
+		}
+		txnum := record.TxNumber()
+		switch record.Op() {
+		case tx.START:
+			cs.pending[txnum] = &pendingTxn{start: lsn}
+		case tx.SETINT, tx.SETSTRING, tx.SETBYTES:
+			if cs.pending[txnum] == nil {
+				cs.pending[txnum] = &pendingTxn{start: lsn}
+			}
+			cs.pending[txnum].updates = append(cs.pending[txnum].updates, record.(tx.UpdateRecord))
+		case tx.ROLLBACK:
+			delete(cs.pending, txnum)
+		case tx.CHECKPOINT:
+			// the txns still pending were cut off by a crash
+			clear(cs.pending)
+		case tx.COMMIT:
+			txn := cs.pending[txnum]
+			delete(cs.pending, txnum)
+			if txn == nil || lsn <= cs.committed {
+				continue
+			}
+			cs.committed = lsn
+			decoded := cs.decode(txnum, lsn, txn.updates)
+			if cs.learnLayouts(decoded) {
+				// the txn may have filled the tables it created
+				decoded = cs.decode(txnum, lsn, txn.updates)
+			}
+			events = append(events, decoded...)
+		}
+	}
+	return events, nil
+}
+
+// Writes the events of the txns committed since the last call as JSON, one event per line
+// returns the number of events written
+func (cs *ChangeStream) PollJSON(w io.Writer) (int, error) {
+	events, err := cs.Poll()
+	encoder := json.NewEncoder(w)
+	for i, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return i, err
+		}
+	}
+	return len(events), err
+}
+
+// Returns the position to resume the stream from, after the events returned so far
+func (cs *ChangeStream) Position() ChangePosition {
+	readFrom := cs.lastRead + 1
+	for _, txn := range cs.pending {
+		readFrom = min(readFrom, txn.start)
+	}
+	return ChangePosition{ReadFrom: readFrom, Committed: cs.committed}
+}
+
+// the changes of one slot in a txn, in log order
+type slotChange struct {
+	event   ChangeEvent
+	firstAt int // index of the first update of the change, events are ordered by it
+}
+
+// turns the updates of a committed txn into row events
+func (cs *ChangeStream) decode(txnum int, lsn int, updates []tx.UpdateRecord) []ChangeEvent {
+	type slotKey struct {
+		table string
+		block int
+		slot  int
+	}
+	open := make(map[slotKey]*slotChange)
+	done := make([]*slotChange, 0)
+
+	for i, update := range updates {
+		table, ok := strings.CutSuffix(update.Block().FileName(), ".tbl")
+		if !ok {
+			continue // indexes, free space maps
+		}
+		layout := cs.layouts[table]
+		if layout == nil {
+			continue // temp tables, hash index buckets
+		}
+		slot := update.Offset() / layout.SlotSize()
+		key := slotKey{table: table, block: update.Block().BlockNumber(), slot: slot}
+		change := open[key]
+
+		if offset := update.Offset() % layout.SlotSize(); offset == 0 {
+			// the slot's flag, or the whole slot
+			oldFlag, newFlag := update.OldValue(), update.NewValue()
+			oldSlot, ok := oldFlag.([]byte)
+			if ok {
+				oldFlag, newFlag = slotFlag(oldSlot), slotFlag(newFlag.([]byte))
+			}
+			switch {
+			case oldFlag == EMPTY && newFlag == USED:
+				if change != nil {
+					done = append(done, change)
+				}
+				open[key] = cs.newSlotChange(txnum, lsn, key.table, key.block, key.slot, CHANGE_INSERT, i)
+			case oldFlag == USED && newFlag == EMPTY:
+				if change != nil && change.event.Op == CHANGE_INSERT {
+					// inserted and deleted by the same txn
+					delete(open, key)
+					continue
+				}
+				if change == nil {
+					change = cs.newSlotChange(txnum, lsn, key.table, key.block, key.slot, CHANGE_DELETE, i)
+				}
+				change.event.Op = CHANGE_DELETE
+				change.event.New = nil
+				for _, fieldName := range layout.Schema().Fields() {
+					if _, ok := change.event.Old[fieldName]; !ok && oldSlot != nil {
+						change.event.Old[fieldName] = slotValue(layout, oldSlot, fieldName)
+					}
+				}
+				done = append(done, change)
+				delete(open, key)
+			}
+			continue
+		}
+
+		fieldName := fieldAt(layout, update.Offset()%layout.SlotSize())
+		if fieldName == "" {
+			continue
+		}
+		if change == nil {
+			change = cs.newSlotChange(txnum, lsn, key.table, key.block, key.slot, CHANGE_UPDATE, i)
+			open[key] = change
+		}
+		if _, ok := change.event.Old[fieldName]; !ok && change.event.Op != CHANGE_INSERT {
+			change.event.Old[fieldName] = update.OldValue()
+		}
+		change.event.New[fieldName] = update.NewValue()
+	}
+
+	for _, change := range open {
+		if change.event.Op == CHANGE_INSERT {
+			change.event.Old = nil
+			// fields the txn never set keep the values of an empty slot
+			sch := cs.layouts[change.event.Table].Schema()
+			for _, fieldName := range sch.Fields() {
+				if _, ok := change.event.New[fieldName]; ok {
+					continue
+				}
+				if sch.FieldType(fieldName) == INTEGER {
+					change.event.New[fieldName] = 0
+				} else {
+					change.event.New[fieldName] = ""
+				}
+			}
+		}
+		done = append(done, change)
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].firstAt < done[j].firstAt })
+
+	events := make([]ChangeEvent, len(done))
+	for i, change := range done {
+		events[i] = change.event
+	}
+	return events
+}
+
+func (cs *ChangeStream) newSlotChange(txnum int, lsn int, table string, block int, slot int, op string, firstAt int) *slotChange {
+	return &slotChange{
+		event: ChangeEvent{
+			LSN:   lsn,
+			TxNum: txnum,
+			Table: table,
+			Op:    op,
+			Block: block,
+			Slot:  slot,
+			New:   make(map[string]any),
+			Old:   make(map[string]any),
+		},
+		firstAt: firstAt,
+	}
+}
+
+// adds the layouts of the tables created by the events, reports whether there were any
+func (cs *ChangeStream) learnLayouts(events []ChangeEvent) bool {
+	sizes := make(map[string]int)
+	fields := make(map[string][]map[string]any)
+	for _, event := range events {
+		if event.Op != CHANGE_INSERT {
+			continue
+		}
+		switch event.Table {
+		case "tblcat":
+			sizes[event.New["tblname"].(string)] = event.New["slotsize"].(int)
+		case "fldcat":
+			tblname := event.New["tblname"].(string)
+			fields[tblname] = append(fields[tblname], event.New)
+		}
+	}
+	for tblname, size := range sizes {
+		sch := NewSchema()
+		offsets := make(map[string]int)
+		for _, field := range fields[tblname] {
+			fldname := field["fldname"].(string)
+			sch.AddField(fldname, field["type"].(int), field["length"].(int))
+			offsets[fldname] = field["offset"].(int)
+		}
+		cs.layouts[tblname] = NewLayoutWithMetadata(sch, offsets, size)
+	}
+	return len(sizes) > 0
+}
+
+// the flag of a slot's bytes
+func slotFlag(slot []byte) int {
+	return file.NewPageWithSlice(slot).GetInt(0)
+}
+
+// the value of the field in a slot's bytes
+func slotValue(layout *Layout, slot []byte, fieldName string) any {
+	page := file.NewPageWithSlice(slot)
+	if layout.Schema().FieldType(fieldName) == INTEGER {
+		return page.GetInt(layout.Offset(fieldName))
+	}
+	return page.GetString(layout.Offset(fieldName))
+}
+
+// returns the field stored at the offset of a slot, "" if none starts there
+func fieldAt(layout *Layout, offset int) string {
+	for _, fieldName := range layout.Schema().Fields() {
+		if layout.Offset(fieldName) == offset {
+			return fieldName
+		}
+	}
+	return ""
+}
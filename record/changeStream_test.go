@@ -0,0 +1,267 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+func TestChangeStream(t *testing.T) {
+	db := NewSimpleDBWithStorage(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	planner := db.Planner()
+
+	tx := db.NewTx()
+	planner.ExecuteUpdate("create table emp(id int, name varchar(10))", tx)
+	tx.Commit()
+
+	stream, err := db.Subscribe(ChangePosition{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	// catch up with the catalog changes
+	if _, err := stream.Poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	tx = db.NewTx()
+	planner.ExecuteUpdate("insert into emp(id, name) values (1, 'ann')", tx)
+	planner.ExecuteUpdate("insert into emp(id, name) values (2, 'bob')", tx)
+	tx.Commit()
+
+	tx = db.NewTx()
+	planner.ExecuteUpdate("insert into emp(id, name) values (3, 'cid')", tx)
+	tx.Rollback()
+
+	// a txn still running is held back
+	running := db.NewTx()
+	planner.ExecuteUpdate("insert into emp(id, name) values (4, 'dan')", running)
+
+	events, err := stream.Poll()
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected %d events, got %d: %v", 2, len(events), events)
+	}
+	for i, name := range []string{"ann", "bob"} {
+		event := events[i]
+		if event.Table != "emp" || event.Op != CHANGE_INSERT {
+			t.Fatalf("expected an insert into emp, got %s into %s", event.Op, event.Table)
+		}
+		if event.New["id"] != i+1 || event.New["name"] != name {
+			t.Fatalf("expected row (%d, %s), got %v", i+1, name, event.New)
+		}
+	}
+	if events[0].TxNum != events[1].TxNum || events[0].LSN != events[1].LSN {
+		t.Fatalf("expected both inserts in one txn, got %v", events)
+	}
+
+	// resume from the saved position while the txn is running, nothing is lost or repeated
+	saved := stream.Position()
+	running.Commit()
+
+	tx = db.NewTx()
+	planner.ExecuteUpdate("update emp set name = 'bea' where id = 2", tx)
+	planner.ExecuteUpdate("delete from emp where id = 1", tx)
+	tx.Commit()
+
+	resumed, err := db.Subscribe(saved)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	var out bytes.Buffer
+	n, err := resumed.PollJSON(&out)
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if n != 3 || len(lines) != 3 {
+		t.Fatalf("expected %d events, got %d: %s", 3, n, out.String())
+	}
+	expected := []struct {
+		op  string
+		new map[string]any
+		old map[string]any
+	}{
+		{CHANGE_INSERT, map[string]any{"id": 4.0, "name": "dan"}, nil},
+		{CHANGE_UPDATE, map[string]any{"name": "bea"}, map[string]any{"name": "bob"}},
+		{CHANGE_DELETE, nil, map[string]any{"id": 1.0, "name": "ann"}},
+	}
+	for i, line := range lines {
+		var event ChangeEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if event.Op != expected[i].op || event.Table != "emp" {
+			t.Fatalf("expected %s into emp, got %s", expected[i].op, line)
+		}
+		if !sameValues(event.New, expected[i].new) || !sameValues(event.Old, expected[i].old) {
+			t.Fatalf("expected new %v old %v, got %s", expected[i].new, expected[i].old, line)
+		}
+	}
+
+	// the first stream sees the same changes
+	events, err = stream.Poll()
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected %d events, got %d: %v", 3, len(events), events)
+	}
+	if events, _ = resumed.Poll(); len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+}
+
+func TestChangeStreamTruncated(t *testing.T) {
+	storage := file.NewMemStorage()
+	opts := []Option{WithLogOptions(log.WithSegmentBlocks(1), log.WithRetention(log.DELETE_SEGMENTS))}
+	db := setupCrashDB(storage, opts...)
+	for i := range 50 {
+		tx := db.NewTx()
+		db.Planner().ExecuteUpdate(fmt.Sprintf("insert into crash(a, b) values (%d, 'row')", i), tx)
+		tx.Commit()
+	}
+	db.Close()
+
+	// recovery checkpoints the log and removes the segments before it
+	db = NewSimpleDBWithStorage(storage, opts...)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if db.LogMgr().FirstBlock() == 0 {
+		t.Fatalf("expected the oldest segments to be removed")
+	}
+	if _, err := db.Subscribe(ChangePosition{ReadFrom: 1}); !errors.Is(err, log.ErrLogTruncated) {
+		t.Fatalf("expected %v, got %v", log.ErrLogTruncated, err)
+	}
+	// the zero position starts at the oldest record kept
+	stream, err := db.Subscribe(ChangePosition{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := stream.Poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+}
+
+func TestChangeStreamAfterCrash(t *testing.T) {
+	storage := file.NewFaultStorage(1)
+	db := setupCrashDB(storage)
+	commit := func(txn *tx.Transaction) error { return txn.Commit() }
+	runCrashTxn(db, 0, 2, commit)
+	// the open txn's records are durable, recovery undoes it without logging a ROLLBACK
+	runCrashTxn(db, -1, 2, func(txn *tx.Transaction) error {
+		db.LogMgr().Flush(db.LogMgr().LatestLSN())
+		storage.Crash(file.DROP_UNSYNCED)
+		txn.Rollback()
+		return nil
+	})
+	storage.Restart()
+	db = NewSimpleDBWithStorage(storage)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	stream, err := db.Subscribe(ChangePosition{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	// a table created after subscribing is decoded too, even when filled by the txn creating it
+	txn := db.NewTx()
+	db.Planner().ExecuteUpdate("create table later(id int, name varchar(10))", txn)
+	db.Planner().ExecuteUpdate("insert into later(id, name) values (1, 'ann')", txn)
+	txn.Commit()
+	runCrashTxn(db, 1, 2, commit)
+
+	events, err := stream.Poll()
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	rows := make(map[string]int)
+	for _, event := range events {
+		if event.Table == "crash" {
+			rows[fmt.Sprintf("crash %v", event.New["a"])]++
+		}
+		if event.Table == "later" {
+			rows[fmt.Sprintf("later %v", event.New["name"])]++
+		}
+	}
+	expected := map[string]int{"crash 0": 2, "crash 1": 2, "later ann": 1}
+	if !sameValues(toAny(rows), toAny(expected)) {
+		t.Fatalf("expected rows %v, got %v", expected, rows)
+	}
+	if pos := stream.Position(); pos.ReadFrom <= events[len(events)-1].LSN {
+		t.Fatalf("expected the stream to move past the crashed txn, it resumes from %d", pos.ReadFrom)
+	}
+}
+
+func toAny(m map[string]int) map[string]any {
+	converted := make(map[string]any)
+	for k, v := range m {
+		converted[k] = v
+	}
+	return converted
+}
+
+func sameValues(got map[string]any, expected map[string]any) bool {
+	if len(got) != len(expected) {
+		return false
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// a delete logs one update however many fields the row has
+func TestDeleteLogsOneUpdate(t *testing.T) {
+	db := NewSimpleDBWithStorage(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	planner := db.Planner()
+	txn := db.NewTx()
+	planner.ExecuteUpdate("create table emp(id int, name varchar(10), dept int)", txn)
+	planner.ExecuteUpdate("insert into emp(id, name, dept) values (1, 'ann', 7)", txn)
+	planner.ExecuteUpdate("insert into emp(id, name, dept) values (2, 'bob', 7)", txn)
+	txn.Commit()
+
+	txn = db.NewTx()
+	planner.ExecuteUpdate("delete from emp where id = 1", txn)
+	txn.Commit()
+
+	iter, err := db.LogMgr().Iterator()
+	if err != nil {
+		t.Fatalf("log iterator: %v", err)
+	}
+	updates := 0
+	for iter.HasNext() {
+		buf, err := iter.Next()
+		if err != nil {
+			t.Fatalf("read log: %v", err)
+		}
+		record, err := tx.CreateLogRecord(buf)
+		if err != nil {
+			t.Fatalf("log record: %v", err)
+		}
+		if update, ok := record.(tx.UpdateRecord); ok && update.TxNumber() == txn.TxNum() && update.Block().FileName() == "emp.tbl" {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Fatalf("expected %d update of emp.tbl, got %d", 1, updates)
+	}
+}
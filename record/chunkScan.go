@@ -34,6 +34,8 @@ func NewChunkScan(tx *tx.Transaction, fileName string, layout *Layout, startBloc
 		buffs:         make([]*RecordPage, 0),
 	}
 
+	// the rest of the chunk is read while the first block is pinned
+	tx.Prefetch(fileName, startBlockNum+1, endBlockNum-startBlockNum)
 	for i := startBlockNum; i <= endBlockNum; i++ {
 		blockId := file.NewBlockID(fileName, i)
 		scan.buffs = append(scan.buffs, NewRecordPage(tx, blockId, layout)) // this pins the blocks to buffer
@@ -0,0 +1,231 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+	"github.com/nitishsharma2825/simpleDB/tx"
+)
+
+// Crash consistency suite
+// The workload runs on a FaultStorage that crashes at every sync in turn,
+// then the database is reopened, which runs recovery, and its contents are checked:
+// every committed txn is there in full, every txn that never committed is gone
+
+const crashTxns = 4
+const crashOpenRows = 150 // enough rows for the open txn to push dirty pages out of the pool
+
+// what the workload got done before the crash
+type crashOutcome struct {
+	committed int  // txns 0..committed-1 committed
+	inDoubt   bool // txn committed failed in Commit, its commit record may or may not be durable
+}
+
+// runs f, turning a panic caused by the simulated crash into an error
+func surviveCrash(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr, ok := r.(error)
+			if !ok || !errors.Is(rerr, file.ErrSimulatedCrash) {
+				panic(r)
+			}
+			err = rerr
+		}
+	}()
+	return f()
+}
+
+func setupCrashDB(storage file.Storage, opts ...Option) *SimpleDB {
+	db := NewSimpleDBWithStorage(storage, opts...)
+	tx := db.NewTx()
+	schema := NewSchema()
+	schema.AddIntField("a")
+	schema.AddStringField("b", 8)
+	db.MdMgr().CreateTable("crash", schema, tx)
+	tx.Commit()
+	return db
+}
+
+// runs a txn inserting the rows, then hands it to finish
+// a txn cut short by the crash is rolled back, which fails but releases its locks
+func runCrashTxn(db *SimpleDB, a int, rows int, finish func(*tx.Transaction) error) error {
+	return surviveCrash(func() error {
+		txn := db.NewTx()
+		defer func() {
+			if r := recover(); r != nil {
+				txn.Rollback()
+				panic(r)
+			}
+		}()
+		scan := NewTableScan(txn, "crash", db.MdMgr().GetLayout("crash", txn))
+		for i := range rows {
+			scan.Insert()
+			scan.SetInt("a", a)
+			scan.SetString("b", fmt.Sprintf("r%d", i))
+		}
+		scan.Close()
+		return finish(txn)
+	})
+}
+
+// commits crashTxns txns of two rows each, then crashes while one big txn is still open
+func runCrashWorkload(db *SimpleDB, storage *file.FaultStorage, mode file.CrashMode) crashOutcome {
+	outcome := crashOutcome{}
+	commit := func(txn *tx.Transaction) error { return txn.Commit() }
+	for i := range crashTxns {
+		if err := runCrashTxn(db, i, 2, commit); err != nil {
+			outcome.inDoubt = true
+			return outcome
+		}
+		outcome.committed++
+	}
+	runCrashTxn(db, -1, crashOpenRows, func(txn *tx.Transaction) error {
+		storage.Crash(mode)
+		txn.Rollback()
+		return nil
+	})
+	return outcome
+}
+
+// reopens the crashed database and returns the number of rows per value of a
+func reopenCrashDB(storage *file.FaultStorage, opts ...Option) (rows map[int]int, err error) {
+	storage.Restart()
+	err = surviveCrash(func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				rerr, ok := r.(error)
+				if !ok || !errors.Is(rerr, file.ErrCorruptBlock) {
+					panic(r)
+				}
+				err = rerr
+			}
+		}()
+		db, err := OpenWithStorage(storage, opts...)
+		if err != nil {
+			return err
+		}
+		tx := db.NewTx()
+		scan := NewTableScan(tx, "crash", db.MdMgr().GetLayout("crash", tx))
+		rows = make(map[int]int)
+		for scan.Next() {
+			rows[scan.GetInt("a")]++
+		}
+		scan.Close()
+		return tx.Commit()
+	})
+	return rows, err
+}
+
+func checkCrashRows(t *testing.T, crashPoint int, outcome crashOutcome, rows map[int]int) {
+	t.Helper()
+	for i := range crashTxns {
+		switch {
+		case i < outcome.committed && rows[i] != 2:
+			t.Fatalf("crash at sync %d: committed txn %d has %d rows, expected %d", crashPoint, i, rows[i], 2)
+		case i == outcome.committed && outcome.inDoubt && rows[i] != 0 && rows[i] != 2:
+			t.Fatalf("crash at sync %d: txn %d crashed in commit and kept %d of its %d rows", crashPoint, i, rows[i], 2)
+		case i > outcome.committed || (i == outcome.committed && !outcome.inDoubt):
+			if rows[i] != 0 {
+				t.Fatalf("crash at sync %d: txn %d never committed but has %d rows", crashPoint, i, rows[i])
+			}
+		}
+	}
+	if rows[-1] != 0 {
+		t.Fatalf("crash at sync %d: open txn left %d rows behind", crashPoint, rows[-1])
+	}
+}
+
+func TestCrashRecovery(t *testing.T) {
+	// count the syncs the workload does when nothing goes wrong
+	storage := file.NewFaultStorage(0)
+	db := setupCrashDB(storage)
+	start := storage.Syncs()
+	runCrashWorkload(db, storage, file.DROP_UNSYNCED)
+	workloadSyncs := storage.Syncs() - start
+
+	for _, mode := range []file.CrashMode{file.DROP_UNSYNCED, file.APPLY_SOME_UNSYNCED} {
+		// the last point crashes after the whole workload ran
+		for point := 1; point <= workloadSyncs+1; point++ {
+			storage := file.NewFaultStorage(int64(point))
+			db := setupCrashDB(storage)
+			storage.CrashAtSync(storage.Syncs()+point, mode)
+			outcome := runCrashWorkload(db, storage, mode)
+
+			rows, err := reopenCrashDB(storage)
+			if err != nil {
+				t.Fatalf("mode %d, crash at sync %d: failed to reopen: %v", mode, point, err)
+			}
+			checkCrashRows(t, point, outcome, rows)
+		}
+	}
+}
+
+// With one block per segment every crash point lands next to a segment switch,
+// and reopening removes the segments before the checkpoint
+func TestCrashRecoveryLogSegments(t *testing.T) {
+	opts := []Option{WithLogOptions(log.WithSegmentBlocks(1), log.WithRetention(log.DELETE_SEGMENTS))}
+	storage := file.NewFaultStorage(0)
+	db := setupCrashDB(storage, opts...)
+	start := storage.Syncs()
+	runCrashWorkload(db, storage, file.DROP_UNSYNCED)
+	workloadSyncs := storage.Syncs() - start
+
+	for point := 1; point <= workloadSyncs+1; point++ {
+		storage := file.NewFaultStorage(int64(point))
+		db := setupCrashDB(storage, opts...)
+		storage.CrashAtSync(storage.Syncs()+point, file.APPLY_SOME_UNSYNCED)
+		outcome := runCrashWorkload(db, storage, file.APPLY_SOME_UNSYNCED)
+
+		storage.Restart()
+		before := countSegments(t, storage)
+		rows, err := reopenCrashDB(storage, opts...)
+		if err != nil {
+			t.Fatalf("crash at sync %d: failed to reopen: %v", point, err)
+		}
+		checkCrashRows(t, point, outcome, rows)
+		if after := countSegments(t, storage); after >= before {
+			t.Fatalf("crash at sync %d: expected fewer than %d segments after recovery, got %d", point, before, after)
+		}
+	}
+}
+
+func countSegments(t *testing.T, storage file.Storage) int {
+	t.Helper()
+	files, err := storage.List()
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+	segments := 0
+	for _, filename := range files {
+		if _, ok := log.IsSegmentFile(LOG_FILE, filename); ok {
+			segments++
+		}
+	}
+	return segments
+}
+
+// A torn page is written back from the image logged before its first change,
+// so reopening always finds consistent data
+func TestCrashTornWrites(t *testing.T) {
+	storage := file.NewFaultStorage(0)
+	db := setupCrashDB(storage)
+	start := storage.Syncs()
+	runCrashWorkload(db, storage, file.DROP_UNSYNCED)
+	workloadSyncs := storage.Syncs() - start
+
+	for point := 1; point <= workloadSyncs+1; point++ {
+		storage := file.NewFaultStorage(int64(point))
+		db := setupCrashDB(storage)
+		storage.CrashAtSync(storage.Syncs()+point, file.TEAR_UNSYNCED)
+		outcome := runCrashWorkload(db, storage, file.TEAR_UNSYNCED)
+
+		rows, err := reopenCrashDB(storage)
+		if err != nil {
+			t.Fatalf("crash at sync %d: failed to reopen: %v", point, err)
+		}
+		checkCrashRows(t, point, outcome, rows)
+	}
+}
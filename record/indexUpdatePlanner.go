@@ -17,6 +17,7 @@ func NewIndexUpdatePlanner(mdm *MetadataManager) *IndexUpdatePlanner {
 }
 
 func (iup *IndexUpdatePlanner) ExecuteInsert(data *InsertData, tx *tx.Transaction) int {
+	iup.mdm.checkWritable(data.TblName)
 	tableName := data.TblName
 	tablePlan := NewTablePlan(tx, tableName, iup.mdm)
 
@@ -42,6 +43,7 @@ func (iup *IndexUpdatePlanner) ExecuteInsert(data *InsertData, tx *tx.Transactio
 }
 
 func (iup *IndexUpdatePlanner) ExecuteDelete(data *DeleteData, tx *tx.Transaction) int {
+	iup.mdm.checkWritable(data.TblName)
 	tableName := data.TblName
 	tablePlan := NewTablePlan(tx, tableName, iup.mdm)
 	selectPlan := NewSelectPlan(tablePlan, data.Pred)
@@ -67,6 +69,7 @@ func (iup *IndexUpdatePlanner) ExecuteDelete(data *DeleteData, tx *tx.Transactio
 }
 
 func (iup *IndexUpdatePlanner) ExecuteModify(data *ModifyData, tx *tx.Transaction) int {
+	iup.mdm.checkWritable(data.TblName)
 	tableName := data.TblName
 	fieldName := data.FldName
 	tablePlan := NewTablePlan(tx, tableName, iup.mdm)
@@ -104,6 +107,7 @@ func (iup *IndexUpdatePlanner) ExecuteModify(data *ModifyData, tx *tx.Transactio
 }
 
 func (iup *IndexUpdatePlanner) ExecuteCreateTable(data *CreateTableData, tx *tx.Transaction) int {
+	iup.mdm.checkWritable(data.TblName)
 	iup.mdm.CreateTable(data.TblName, data.Schema, tx)
 	return 0
 }
@@ -2,6 +2,7 @@ package record
 
 /*
 Scan class for the merge join operator
+Its sorted inputs read ahead through the TableScans of their runs, it gives no hints of its own
 */
 type MergeJoinScan struct {
 	scan1              Scan
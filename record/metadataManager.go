@@ -9,6 +9,7 @@ type MetadataManager struct {
 	viewManager  *ViewManager
 	statManager  *StatManager
 	indexManager *IndexManager
+	systemTables systemTables
 }
 
 func NewMetadataManager(isNew bool, tx *tx.Transaction) *MetadataManager {
@@ -33,6 +34,10 @@ func (mm *MetadataManager) GetLayout(tblname string, tx *tx.Transaction) *Layout
 	return mm.tableManager.GetLayout(tblname, tx)
 }
 
+func (mm *MetadataManager) GetLayouts(tx *tx.Transaction) map[string]*Layout {
+	return mm.tableManager.GetLayouts(tx)
+}
+
 func (mm *MetadataManager) CreateView(viewname string, viewdef string, tx *tx.Transaction) {
 	mm.viewManager.CreateView(viewname, viewdef, tx)
 }
@@ -27,10 +27,16 @@ func TestMetadataManager(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	tx := tx.NewTransaction(fm, lm, bm)
+	tx, err := tx.NewTransaction(fm, lm, bm)
+	if err != nil {
+		t.Fatalf("failed to start txn: %v", err)
+	}
 	mdm := NewMetadataManager(true, tx)
 
 	schema1 := NewSchema()
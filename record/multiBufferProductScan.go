@@ -27,7 +27,11 @@ func NewMultiBufferProductScan(tx *tx.Transaction, lhsScan Scan, tableName strin
 	}
 
 	// this file is of temp table from rhs table
-	s.fileSize = tx.Size(s.fileName)
+	fileSize, err := tx.Size(s.fileName)
+	if err != nil {
+		panic(err)
+	}
+	s.fileSize = fileSize
 	available := tx.AvailableBuffs()
 	s.chunkSize = BestFactor(available, s.fileSize)
 	s.BeforeFirst()
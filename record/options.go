@@ -0,0 +1,92 @@
+package record
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/nitishsharma2825/simpleDB/buffer"
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+)
+
+/*
+Options that can be passed when opening a database
+*/
+type Option func(*config)
+
+type config struct {
+	fileOptions   []file.Option
+	logOptions    []log.Option
+	bufferOptions []buffer.Option
+	// background work, off while the interval is zero
+	writerInterval     time.Duration
+	writerBatch        int
+	checkpointInterval time.Duration
+	checkpointWait     time.Duration
+	messages           io.Writer
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{messages: os.Stdout}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+/*
+Encrypts every data, log and temp table block at rest with the key
+The key must be 16, 24 or 32 bytes long, and the same key must be used to reopen the database
+*/
+func WithEncryptionKey(key []byte) Option {
+	return func(cfg *config) {
+		cfg.fileOptions = append(cfg.fileOptions, file.WithEncryptionKey(key))
+	}
+}
+
+/*
+Configures the log, e.g. its segment size and retention
+*/
+func WithLogOptions(opts ...log.Option) Option {
+	return func(cfg *config) {
+		cfg.logOptions = append(cfg.logOptions, opts...)
+	}
+}
+
+/*
+Configures the buffer pool, e.g. the policy choosing the buffers to replace
+*/
+func WithBufferOptions(opts ...buffer.Option) Option {
+	return func(cfg *config) {
+		cfg.bufferOptions = append(cfg.bufferOptions, opts...)
+	}
+}
+
+/*
+Runs a background writer every interval, writing up to batch modified buffers
+*/
+func WithBackgroundWriter(interval time.Duration, batch int) Option {
+	return func(cfg *config) {
+		cfg.writerInterval = interval
+		cfg.writerBatch = batch
+	}
+}
+
+/*
+Takes a checkpoint every interval, which bounds the log read by recovery
+A checkpoint waits up to maxWait for the running txns to finish, and is skipped if they don't
+*/
+func WithCheckpoints(interval time.Duration, maxWait time.Duration) Option {
+	return func(cfg *config) {
+		cfg.checkpointInterval = interval
+		cfg.checkpointWait = maxWait
+	}
+}
+
+// Writes what the database does when it is opened, like creating or recovering it, to w instead of stdout
+func WithMessages(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.messages = w
+	}
+}
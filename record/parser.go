@@ -118,7 +118,8 @@ func (p *Parser) Query() (*QueryData, error) {
 	if err != nil {
 		return nil, err
 	}
-	var pred *Predicate
+	// without a where clause every record is selected
+	pred := NewPredicate()
 	if p.lexer.MatchKeyword("where") {
 		p.lexer.EatKeyword("where")
 		pred, err = p.Predicate()
@@ -108,6 +108,25 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestQueryWithoutWhere(t *testing.T) {
+	const src = "SELECT first FROM atable"
+	p := NewParser(src)
+
+	qd, err := p.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(qd.Tables(), []string{"atable"}) {
+		t.Fatalf("expected tables %v, got %v\n", []string{"atable"}, qd.Tables())
+	}
+
+	pred := qd.Pred()
+	if len(pred.Terms()) != 0 {
+		t.Fatalf("expected no terms, got %d\n", len(pred.Terms()))
+	}
+}
+
 func TestUpdateCommandSimple(t *testing.T) {
 	const src = "UPDATE atable SET col = 5 WHERE anothercol = 3"
 
@@ -0,0 +1,51 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nitishsharma2825/simpleDB/buffer"
+)
+
+var ErrPinLeak = errors.New("pins left behind")
+
+/*
+Runs the query in a txn of its own, reading every record, then rolls it back
+Returns an error matching ErrPinLeak naming every block left pinned, nil if none was
+*/
+func (s *SimpleDB) CheckPinLeaks(query string) (err error) {
+	tx := s.NewTx()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+		if rerr := tx.Rollback(); err == nil {
+			err = rerr
+		}
+	}()
+
+	scan := s.planner.CreateQueryPlan(query, tx).Open()
+	for scan.Next() {
+	}
+	scan.Close()
+	if leaked := tx.OutstandingPins(); len(leaked) > 0 {
+		return fmt.Errorf("%w by %q: %s", ErrPinLeak, query, describePins(leaked))
+	}
+	return nil
+}
+
+func describePins(pins []buffer.PinRecord) string {
+	var description strings.Builder
+	for i, pin := range pins {
+		if i > 0 {
+			description.WriteString(", ")
+		}
+		description.WriteString(pin.Block.String())
+		if pin.Stack != "" {
+			fmt.Fprintf(&description, " pinned at\n%s", pin.Stack)
+		}
+	}
+	return description.String()
+}
@@ -25,10 +25,16 @@ func TestProductScan(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	tx := tx.NewTransaction(fm, lm, bm)
+	tx, err := tx.NewTransaction(fm, lm, bm)
+	if err != nil {
+		t.Fatalf("failed to start txn: %v", err)
+	}
 
 	sch1 := NewSchema()
 	sch1.AddIntField("A")
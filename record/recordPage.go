@@ -12,6 +12,7 @@ Store a record at a given location in a block
 const (
 	EMPTY = 0
 	USED  = 1
+	FREED = 2 // the block is free, neither scans nor inserts use it until it is allocated again
 )
 
 type RecordPage struct {
@@ -26,7 +27,9 @@ func NewRecordPage(tx *tx.Transaction, blockId file.BlockID, layout *Layout) *Re
 		layout:  layout,
 		tx:      tx,
 	}
-	tx.Pin(blockId)
+	if err := tx.Pin(blockId); err != nil {
+		panic(err)
+	}
 	return recPage
 }
 
@@ -35,7 +38,11 @@ Return the integer stored for the specified field of a specified slot
 */
 func (rp *RecordPage) GetInt(slot int, fieldName string) int {
 	fieldPos := rp.offset(slot) + rp.layout.Offset(fieldName)
-	return rp.tx.GetInt(rp.blockId, fieldPos)
+	val, err := rp.tx.GetInt(rp.blockId, fieldPos)
+	if err != nil {
+		panic(err)
+	}
+	return val
 }
 
 /*
@@ -43,7 +50,11 @@ Return the string value stored for the specified field of a specified slot
 */
 func (rp *RecordPage) GetString(slot int, fieldName string) string {
 	fieldPos := rp.offset(slot) + rp.layout.Offset(fieldName)
-	return rp.tx.GetString(rp.blockId, fieldPos)
+	val, err := rp.tx.GetString(rp.blockId, fieldPos)
+	if err != nil {
+		panic(err)
+	}
+	return val
 }
 
 /*
@@ -62,8 +73,12 @@ func (rp *RecordPage) SetString(slot int, fieldName string, val string) {
 	rp.tx.SetString(rp.blockId, fieldPos, val, true)
 }
 
+/*
+Clear the slot, which marks it empty, in one logged update keeping the deleted values for the change stream
+*/
 func (rp *RecordPage) Delete(slot int) {
-	rp.SetFlag(slot, EMPTY)
+	// an all zero slot is EMPTY
+	rp.tx.SetBytes(rp.blockId, rp.offset(slot), make([]byte, rp.layout.SlotSize()), true)
 }
 
 /*
@@ -87,6 +102,24 @@ func (rp *RecordPage) Format() {
 	}
 }
 
+// Marks every slot of a block holding no record freed
+func (rp *RecordPage) MarkFreed() {
+	for slot := 0; rp.IsValidSlot(slot); slot++ {
+		rp.SetFlag(slot, FREED)
+	}
+}
+
+// Marks the slots of a block allocated again empty, logged like the free was
+func (rp *RecordPage) Reuse() {
+	for slot := 0; rp.IsValidSlot(slot); slot++ {
+		rp.SetFlag(slot, EMPTY)
+	}
+}
+
+func (rp *RecordPage) IsEmpty() bool {
+	return rp.NextAfter(-1) < 0
+}
+
 func (rp *RecordPage) NextAfter(slot int) int {
 	return rp.searchAfter(slot, USED)
 }
@@ -106,7 +139,11 @@ func (rp *RecordPage) Block() file.BlockID {
 func (rp *RecordPage) searchAfter(slot int, flag int) int {
 	slot++
 	for rp.IsValidSlot(slot) {
-		if rp.tx.GetInt(rp.blockId, rp.offset(slot)) == flag {
+		val, err := rp.tx.GetInt(rp.blockId, rp.offset(slot))
+		if err != nil {
+			panic(err)
+		}
+		if val == flag {
 			return slot
 		}
 		slot++
@@ -26,10 +26,16 @@ func TestRecord(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	tx := tx.NewTransaction(fm, lm, bm)
+	tx, err := tx.NewTransaction(fm, lm, bm)
+	if err != nil {
+		t.Fatalf("failed to start txn: %v", err)
+	}
 
 	sch := NewSchema()
 	sch.AddIntField("A")
@@ -41,7 +47,10 @@ func TestRecord(t *testing.T) {
 		t.Logf("%q has offset %d\n", fieldName, offset)
 	}
 
-	blockId := tx.Append("testfile")
+	blockId, err := tx.Append("testfile")
+	if err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
 	tx.Pin(blockId)
 	rp := NewRecordPage(tx, blockId, layout)
 	rp.Format()
@@ -2,6 +2,7 @@ package record
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/nitishsharma2825/simpleDB/buffer"
 	"github.com/nitishsharma2825/simpleDB/file"
@@ -26,36 +27,135 @@ type SimpleDB struct {
 	lm      *log.Manager
 	mdm     *MetadataManager
 	planner *Planner
+	// kept so backups are written with the same key
+	fileOptions []file.Option
+	cfg         *config
+
+	gate         txnGate
+	checkpointMu sync.Mutex
+	background   background
+}
+
+// panics if the database cannot be opened, see Open
+func NewSimpleDBWithBlockSize(dirname string, blockSize int, buffSize int, opts ...Option) *SimpleDB {
+	cfg := newConfig(opts)
+	simpleDB, err := newSimpleDB(file.NewFileManager(dirname, blockSize, cfg.fileOptions...), buffSize, cfg)
+	if err != nil {
+		panic(err)
+	}
+	return simpleDB
+}
+
+// panics if the database cannot be opened, Open returns the error instead
+func NewSimpleDB(dirname string, opts ...Option) *SimpleDB {
+	simpleDB, err := Open(dirname, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return simpleDB
 }
 
-func NewSimpleDBWithBlockSize(dirname string, blockSize int, buffSize int) *SimpleDB {
-	simpleDB := &SimpleDB{}
-	simpleDB.fm = file.NewFileManager(dirname, blockSize)
-	simpleDB.lm = log.NewLogManager(simpleDB.fm, LOG_FILE)
-	simpleDB.bm = buffer.NewBufferManager(simpleDB.fm, simpleDB.lm, buffSize)
+// Creates a fully initialized database over any storage backend, e.g. file.NewMemStorage()
+// panics if the database cannot be opened, OpenWithStorage returns the error instead
+func NewSimpleDBWithStorage(storage file.Storage, opts ...Option) *SimpleDB {
+	simpleDB, err := OpenWithStorage(storage, opts...)
+	if err != nil {
+		panic(err)
+	}
 	return simpleDB
 }
 
-func NewSimpleDB(dirname string) *SimpleDB {
-	simpleDB := NewSimpleDBWithBlockSize(dirname, BLOCK_SIZE, BUFFER_SIZE)
-	tx := simpleDB.NewTx()
-	isNew := simpleDB.fm.IsNew()
+/*
+Opens the database in the directory, creating it if it does not exist, and recovers it
+Returns file.ErrDatabaseLocked if it is in use, a *file.SuperblockError or *file.KeyMismatchError
+if it was created with other settings, or the error recovery failed with
+*/
+func Open(dirname string, opts ...Option) (*SimpleDB, error) {
+	storage, err := file.NewOSStorage(dirname)
+	if err != nil {
+		return nil, err
+	}
+	return OpenWithStorage(storage, opts...)
+}
+
+// Opens the database like Open, over any storage backend
+func OpenWithStorage(storage file.Storage, opts ...Option) (*SimpleDB, error) {
+	cfg := newConfig(opts)
+	fm, err := file.NewFileManagerWithStorage(storage, BLOCK_SIZE, cfg.fileOptions...)
+	if err != nil {
+		return nil, err
+	}
+	simpleDB, err := newSimpleDB(fm, BUFFER_SIZE, cfg)
+	if err == nil {
+		err = simpleDB.init()
+	}
+	if err != nil {
+		fm.Close()
+		return nil, err
+	}
+	simpleDB.StartBackground()
+	return simpleDB, nil
+}
+
+func newSimpleDB(fm *file.Manager, buffSize int, cfg *config) (*SimpleDB, error) {
+	lm, err := log.OpenLogManager(fm, LOG_FILE, cfg.logOptions...)
+	if err != nil {
+		return nil, err
+	}
+	simpleDB := &SimpleDB{fileOptions: cfg.fileOptions, cfg: cfg}
+	simpleDB.fm = fm
+	simpleDB.lm = lm
+	simpleDB.bm = buffer.NewBufferManager(simpleDB.fm, simpleDB.lm, buffSize, cfg.bufferOptions...)
+	return simpleDB, nil
+}
+
+// recovers an existing database or creates the catalog of a new one
+func (s *SimpleDB) init() error {
+	tx, err := s.newTx()
+	if err != nil {
+		return err
+	}
+	isNew := s.fm.IsNew()
 	if isNew {
-		fmt.Println("Creating new database")
+		fmt.Fprintln(s.cfg.messages, "Creating new database")
 	} else {
-		fmt.Println("recovering existing database")
-		tx.Recover()
+		fmt.Fprintln(s.cfg.messages, "recovering existing database")
+		if err := tx.Recover(); err != nil {
+			return err
+		}
 	}
-	simpleDB.mdm = NewMetadataManager(isNew, tx)
-	qp := NewBasicQueryPlanner(simpleDB.mdm)
-	up := NewBasicUpdatePlanner(simpleDB.mdm)
-	simpleDB.planner = NewPlanner(qp, up)
-	tx.Commit()
-	return simpleDB
+	s.mdm = NewMetadataManager(isNew, tx)
+	registerBufferTables(s.mdm, s.bm)
+	qp := NewBasicQueryPlanner(s.mdm)
+	up := NewBasicUpdatePlanner(s.mdm)
+	s.planner = NewPlanner(qp, up)
+	return tx.Commit()
+}
+
+// releases the database directory so it can be opened again
+func (s *SimpleDB) Close() error {
+	s.StopBackground()
+	return s.fm.Close()
 }
 
+// waits while a checkpoint runs, panics if no txn number can be reserved
 func (s *SimpleDB) NewTx() *tx.Transaction {
-	return tx.NewTransaction(s.fm, s.lm, s.bm)
+	txn, err := s.newTx()
+	if err != nil {
+		panic(err)
+	}
+	return txn
+}
+
+func (s *SimpleDB) newTx() (*tx.Transaction, error) {
+	s.gate.enter()
+	txn, err := tx.NewTransaction(s.fm, s.lm, s.bm)
+	if err != nil {
+		s.gate.leave()
+		return nil, err
+	}
+	txn.OnEnd(s.gate.leave)
+	return txn, nil
 }
 
 func (s *SimpleDB) MdMgr() *MetadataManager {
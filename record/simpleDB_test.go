@@ -0,0 +1,196 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/nitishsharma2825/simpleDB/buffer"
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+func TestEncryptedSimpleDB(t *testing.T) {
+	key := bytes.Repeat([]byte{42}, 32)
+	storage := file.NewMemStorage()
+
+	db := NewSimpleDBWithStorage(storage, WithEncryptionKey(key))
+	tx := db.NewTx()
+	planner := db.Planner()
+	planner.ExecuteUpdate("create table secrets(A int, B varchar(12))", tx)
+	for i := range 20 {
+		cmd := fmt.Sprintf("insert into secrets(A, B) values (%d, 'classified%d')", i, i)
+		planner.ExecuteUpdate(cmd, tx)
+	}
+	tx.Commit()
+
+	// neither the data, the catalog nor the log may contain plaintext
+	names, _ := storage.List()
+	for _, name := range names {
+		device, _ := storage.Open(name)
+		size, _ := device.Size()
+		raw := make([]byte, size)
+		device.ReadAt(raw, 0)
+		for _, plaintext := range []string{"classified", "secrets", "tblcat"} {
+			if bytes.Contains(raw, []byte(plaintext)) {
+				t.Fatalf("found plaintext %q in %s", plaintext, name)
+			}
+		}
+	}
+
+	// reopening with the same key sees the rows
+	db = NewSimpleDBWithStorage(storage, WithEncryptionKey(key))
+	tx = db.NewTx()
+	plan := db.Planner().CreateQueryPlan("select B from secrets where A=7", tx)
+	scan := plan.Open()
+	if !scan.Next() || scan.GetString("b") != "classified7" {
+		t.Fatalf("expected to read back the encrypted row")
+	}
+	scan.Close()
+	tx.Commit()
+
+	// reopening with another key fails before touching any data
+	if _, err := OpenWithStorage(storage, WithEncryptionKey(bytes.Repeat([]byte{43}, 32))); !errors.Is(err, file.ErrKeyMismatch) {
+		t.Fatalf("expected %v, got %v", file.ErrKeyMismatch, err)
+	}
+}
+
+func TestOpenLocked(t *testing.T) {
+	dir := path.Join(t.TempDir(), "db")
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := Open(dir); !errors.Is(err, file.ErrDatabaseLocked) {
+		t.Fatalf("expected %v, got %v", file.ErrDatabaseLocked, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	db.Close()
+}
+
+func TestBufferSystemTables(t *testing.T) {
+	db := NewSimpleDBWithStorage(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	planner := db.Planner()
+	tx := db.NewTx()
+	planner.ExecuteUpdate("create table emp(id int, name varchar(10))", tx)
+	planner.ExecuteUpdate("insert into emp(id, name) values (1, 'ann')", tx)
+
+	// the txn's modified block is in the pool, dirty
+	plan := planner.CreateQueryPlan("select frame, block, pins, txnum from sys_buffers where filename = 'emp.tbl'", tx)
+	scan := plan.Open()
+	if !scan.Next() {
+		t.Fatalf("expected a frame holding emp.tbl")
+	}
+	if block, txnum := scan.GetInt("block"), scan.GetInt("txnum"); block != 0 || txnum < 0 {
+		t.Fatalf("expected block 0 modified by a txn, got block %d txnum %d", block, txnum)
+	}
+	scan.Close()
+	tx.Commit()
+
+	stats := db.BufferMgr().Stats()
+	tx = db.NewTx()
+	scan = planner.CreateQueryPlan("select name, value from sys_buffer_stats", tx).Open()
+	counters := make(map[string]int)
+	for scan.Next() {
+		counters[scan.GetString("name")] = scan.GetInt("value")
+	}
+	scan.Close()
+	tx.Commit()
+	if counters["misses"] != stats.Misses || counters["hits"] < stats.Hits || counters["hits"] == 0 {
+		t.Fatalf("expected the counters of %+v, got %v", stats, counters)
+	}
+	if len(counters) != 11 {
+		t.Fatalf("expected %d counters, got %d", 11, len(counters))
+	}
+
+	// system tables are never updated
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrSystemTable) {
+			t.Fatalf("expected %v, got %v", ErrSystemTable, r)
+		}
+	}()
+	tx = db.NewTx()
+	defer tx.Rollback()
+	planner.ExecuteUpdate("delete from sys_buffers", tx)
+}
+
+// a stored table would be hidden behind the system table of the same name
+func TestCreateSystemTable(t *testing.T) {
+	db := NewSimpleDBWithStorage(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	for _, uplanner := range []UpdatePlanner{NewBasicUpdatePlanner(db.MdMgr()), NewIndexUpdatePlanner(db.MdMgr())} {
+		planner := NewPlanner(NewBasicQueryPlanner(db.MdMgr()), uplanner)
+		func() {
+			tx := db.NewTx()
+			defer tx.Rollback()
+			defer func() {
+				r := recover()
+				err, ok := r.(error)
+				if !ok || !errors.Is(err, ErrSystemTable) {
+					t.Fatalf("%T: expected %v, got %v", uplanner, ErrSystemTable, r)
+				}
+			}()
+			planner.ExecuteUpdate("create table sys_buffers(frame int)", tx)
+		}()
+	}
+}
+
+func TestCheckPinLeaks(t *testing.T) {
+	var reports strings.Builder
+	db := setupCrashDB(file.NewMemStorage(), WithBufferOptions(buffer.WithPinTracking(&reports)))
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	db.Planner().ExecuteUpdate("create table other(c int, d varchar(8))", tx)
+	for i := range 100 {
+		db.Planner().ExecuteUpdate(fmt.Sprintf("insert into crash(a, b) values (%d, 'row')", i), tx)
+		db.Planner().ExecuteUpdate(fmt.Sprintf("insert into other(c, d) values (%d, 'row')", i), tx)
+	}
+	if pins := tx.OutstandingPins(); len(pins) != 0 {
+		t.Fatalf("expected the updates to release their pins, got %v", pins)
+	}
+	tx.Commit()
+
+	for _, query := range []string{
+		"select a, b from crash",
+		"select b from crash where a = 7",
+		"select b, d from crash, other where a = c",
+		"select frame, pins from sys_buffers",
+	} {
+		if err := db.CheckPinLeaks(query); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if reports.Len() != 0 {
+		t.Fatalf("expected no pins reported, got %s", reports.String())
+	}
+	if available := db.BufferMgr().Available(); available != BUFFER_SIZE {
+		t.Fatalf("expected %d buffers available, got %d", BUFFER_SIZE, available)
+	}
+}
+
+func TestOpenMessages(t *testing.T) {
+	storage := file.NewMemStorage()
+	var messages bytes.Buffer
+	NewSimpleDBWithStorage(storage, WithMessages(&messages)).Close()
+	NewSimpleDBWithStorage(storage, WithMessages(&messages)).Close()
+	if messages.String() != "Creating new database\nrecovering existing database\n" {
+		t.Fatalf("unexpected messages %q", messages.String())
+	}
+}
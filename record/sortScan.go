@@ -2,6 +2,7 @@ package record
 
 /*
 Scan class for the Sort operator
+The runs are read through the TableScans of their temp tables, which read the blocks ahead
 */
 type SortScan struct {
 	s1, s2, currentScan UpdateScan
@@ -0,0 +1,171 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/nitishsharma2825/simpleDB/buffer"
+)
+
+var ErrSystemTable = errors.New("system tables are read-only")
+
+/*
+A read-only table whose rows are computed from the running system every time it is scanned
+*/
+type SystemTable struct {
+	schema *Schema
+	rows   func() []map[string]Constant
+}
+
+// registered system tables by name
+type systemTables struct {
+	mu     sync.Mutex
+	tables map[string]*SystemTable
+}
+
+func (st *systemTables) get(tableName string) *SystemTable {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.tables[tableName]
+}
+
+func (st *systemTables) register(tableName string, table *SystemTable) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.tables == nil {
+		st.tables = make(map[string]*SystemTable)
+	}
+	st.tables[tableName] = table
+}
+
+/*
+Registers a system table with the schema, every row maps each field to its value
+*/
+func (mm *MetadataManager) RegisterSystemTable(tableName string, schema *Schema, rows func() []map[string]Constant) {
+	mm.systemTables.register(tableName, &SystemTable{schema: schema, rows: rows})
+}
+
+// returns the system table, nil if there is none with the name
+func (mm *MetadataManager) SystemTable(tableName string) *SystemTable {
+	return mm.systemTables.get(tableName)
+}
+
+// panics with ErrSystemTable if the table cannot be updated or created
+func (mm *MetadataManager) checkWritable(tableName string) {
+	if mm.SystemTable(tableName) != nil {
+		panic(fmt.Errorf("%w: %s", ErrSystemTable, tableName))
+	}
+}
+
+/*
+Scans a snapshot of the rows of a system table
+*/
+type SystemTableScan struct {
+	schema  *Schema
+	rows    []map[string]Constant
+	current int
+}
+
+func NewSystemTableScan(table *SystemTable) *SystemTableScan {
+	return &SystemTableScan{
+		schema:  table.schema,
+		rows:    table.rows(),
+		current: -1,
+	}
+}
+
+func (sts *SystemTableScan) BeforeFirst() {
+	sts.current = -1
+}
+
+func (sts *SystemTableScan) Next() bool {
+	sts.current++
+	return sts.current < len(sts.rows)
+}
+
+func (sts *SystemTableScan) GetInt(fieldName string) int {
+	return sts.GetVal(fieldName).AsInt()
+}
+
+func (sts *SystemTableScan) GetString(fieldName string) string {
+	return sts.GetVal(fieldName).AsString()
+}
+
+func (sts *SystemTableScan) GetVal(fieldName string) Constant {
+	return sts.rows[sts.current][fieldName]
+}
+
+func (sts *SystemTableScan) HasField(fieldName string) bool {
+	return sts.schema.HasField(fieldName)
+}
+
+func (sts *SystemTableScan) Close() {}
+
+// the buffer pool's frames and counters
+
+const (
+	BUFFERS_TABLE      = "sys_buffers"
+	BUFFER_STATS_TABLE = "sys_buffer_stats"
+)
+
+// registers the system tables describing the buffer pool
+func registerBufferTables(mdm *MetadataManager, bm *buffer.Manager) {
+	frames := NewSchema()
+	frames.AddIntField("frame")
+	frames.AddStringField("filename", MAX_NAME)
+	frames.AddIntField("block")
+	frames.AddIntField("pins")
+	frames.AddIntField("dirty")
+	frames.AddIntField("txnum")
+	mdm.RegisterSystemTable(BUFFERS_TABLE, frames, func() []map[string]Constant {
+		rows := make([]map[string]Constant, 0)
+		for _, frame := range bm.Frames() {
+			dirty := 0
+			if frame.Dirty {
+				dirty = 1
+			}
+			rows = append(rows, map[string]Constant{
+				"frame":    NewIntConstant(frame.Index),
+				"filename": NewStringConstant(frame.Block.FileName()),
+				"block":    NewIntConstant(frame.Block.BlockNumber()),
+				"pins":     NewIntConstant(frame.Pins),
+				"dirty":    NewIntConstant(dirty),
+				"txnum":    NewIntConstant(frame.ModifyingTxn),
+			})
+		}
+		return rows
+	})
+
+	stats := NewSchema()
+	stats.AddStringField("name", MAX_NAME)
+	stats.AddIntField("value")
+	mdm.RegisterSystemTable(BUFFER_STATS_TABLE, stats, func() []map[string]Constant {
+		s := bm.Stats()
+		rows := make([]map[string]Constant, 0)
+		for _, counter := range []struct {
+			name  string
+			value int
+		}{
+			{"hits", s.Hits},
+			{"misses", s.Misses},
+			{"evictions", s.Evictions},
+			{"dirty_flushes", s.DirtyFlushes},
+			{"pin_waits", s.PinWaits},
+			{"pin_wait_ms", int(s.PinWaitTime.Milliseconds())},
+			{"timeouts", s.Timeouts},
+			{"prefetched", s.Prefetched},
+			{"prefetch_hits", s.PrefetchHits},
+			{"ring_reuses", s.RingReuses},
+			{"available", bm.Available()},
+		} {
+			rows = append(rows, map[string]Constant{
+				"name":  NewStringConstant(counter.name),
+				"value": NewIntConstant(counter.value),
+			})
+		}
+		return rows
+	})
+}
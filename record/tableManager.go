@@ -98,3 +98,36 @@ func (tm *TableManager) GetLayout(tblname string, tx *tx.Transaction) *Layout {
 	fcat.Close()
 	return NewLayoutWithMetadata(sch, offsets, size)
 }
+
+// Returns the layout of every table in the catalog, by table name
+func (tm *TableManager) GetLayouts(tx *tx.Transaction) map[string]*Layout {
+	sizes := make(map[string]int)
+	tcat := NewTableScan(tx, "tblcat", tm.tcatLayout)
+	for tcat.Next() {
+		sizes[tcat.GetString("tblname")] = tcat.GetInt("slotsize")
+	}
+	tcat.Close()
+
+	schemas := make(map[string]*Schema)
+	offsets := make(map[string]map[string]int)
+	fcat := NewTableScan(tx, "fldcat", tm.fcatLayout)
+	for fcat.Next() {
+		tblname := fcat.GetString("tblname")
+		if schemas[tblname] == nil {
+			schemas[tblname] = NewSchema()
+			offsets[tblname] = make(map[string]int)
+		}
+		fldname := fcat.GetString("fldname")
+		offsets[tblname][fldname] = fcat.GetInt("offset")
+		schemas[tblname].AddField(fldname, fcat.GetInt("type"), fcat.GetInt("length"))
+	}
+	fcat.Close()
+
+	layouts := make(map[string]*Layout)
+	for tblname, size := range sizes {
+		if schemas[tblname] != nil {
+			layouts[tblname] = NewLayoutWithMetadata(schemas[tblname], offsets[tblname], size)
+		}
+	}
+	return layouts
+}
@@ -13,12 +13,23 @@ type TablePlan struct {
 	tx        *tx.Transaction
 	layout    *Layout
 	si        StatInfo
+	system    *SystemTable // nil unless the table is a system table
 }
 
 /*
 Creates a leaf node in the query tree corresponding to the specified table
 */
 func NewTablePlan(tx *tx.Transaction, tableName string, md *MetadataManager) *TablePlan {
+	if system := md.SystemTable(tableName); system != nil {
+		// small and in memory, one block is close enough
+		return &TablePlan{
+			tableName: tableName,
+			tx:        tx,
+			layout:    NewLayout(system.schema),
+			si:        NewStatInfo(1, len(system.rows())),
+			system:    system,
+		}
+	}
 	layout := md.GetLayout(tableName, tx)
 	return &TablePlan{
 		tableName: tableName,
@@ -32,6 +43,9 @@ func NewTablePlan(tx *tx.Transaction, tableName string, md *MetadataManager) *Ta
 Creates a table scan for this query
 */
 func (tp *TablePlan) Open() Scan {
+	if tp.system != nil {
+		return NewSystemTableScan(tp.system)
+	}
 	return NewTableScan(tp.tx, tp.tableName, tp.layout)
 }
 
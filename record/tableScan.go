@@ -8,6 +8,24 @@ import (
 /*
 Provides abstraction of large array of records
 */
+
+const (
+	// blocks read ahead of a scan moving through the file in order
+	READ_AHEAD = 4
+	// a scan of a file larger than this fraction of the pool recycles a ring of buffers as large
+	RING_FRACTION = 4
+	// a file no larger than this never uses a ring, however small the pool
+	RING_MIN_BLOCKS = 16
+)
+
+// the catalog is what a ring keeps in the pool, its own scans never use one
+var catalogFiles = map[string]bool{
+	"tblcat.tbl":  true,
+	"fldcat.tbl":  true,
+	"idxcat.tbl":  true,
+	"viewcat.tbl": true,
+}
+
 type TableScan struct {
 	tx          *tx.Transaction
 	layout      *Layout
@@ -23,7 +41,12 @@ func NewTableScan(tx *tx.Transaction, tableName string, layout *Layout) *TableSc
 		fileName: tableName + ".tbl",
 	}
 
-	if tx.Size(ts.fileName) == 0 {
+	size, err := tx.Size(ts.fileName)
+	if err != nil {
+		panic(err)
+	}
+	ts.chooseRing(size)
+	if size == 0 {
 		ts.moveToNewBlock()
 	} else {
 		ts.moveToBlock(0)
@@ -107,8 +130,15 @@ func (ts *TableScan) Insert() {
 	}
 }
 
+// A block left holding no record is freed, the trailing free blocks are cut off at commit
 func (ts *TableScan) Delete() {
 	ts.rp.Delete(ts.currentSlot)
+	if ts.rp.IsEmpty() {
+		ts.rp.MarkFreed()
+		if err := ts.tx.Free(ts.rp.Block()); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func (ts *TableScan) MoveToRID(rid RID) {
@@ -127,16 +157,46 @@ func (ts *TableScan) moveToBlock(blockNum int) {
 	blockId := file.NewBlockID(ts.fileName, blockNum)
 	ts.rp = NewRecordPage(ts.tx, blockId, ts.layout)
 	ts.currentSlot = -1
+	// blocks in the pool or already being read are skipped
+	ts.tx.Prefetch(ts.fileName, blockNum+1, READ_AHEAD)
 }
 
+// moves to a freed block if the table has one, to a new block appended to it otherwise
 func (ts *TableScan) moveToNewBlock() {
 	ts.Close()
-	blockId := ts.tx.Append(ts.fileName)
+	size, err := ts.tx.Size(ts.fileName)
+	if err != nil {
+		panic(err)
+	}
+	blockId, err := ts.tx.Allocate(ts.fileName)
+	if err != nil {
+		panic(err)
+	}
+	// a table being filled, like a sort's temp tables, switches to a ring once it is large
+	ts.chooseRing(max(size, blockId.BlockNumber()+1))
 	ts.rp = NewRecordPage(ts.tx, blockId, ts.layout)
-	ts.rp.Format()
+	if blockId.BlockNumber() < size {
+		ts.rp.Reuse()
+	} else {
+		ts.rp.Format()
+	}
 	ts.currentSlot = -1
 }
 
+func (ts *TableScan) chooseRing(size int) {
+	if catalogFiles[ts.fileName] {
+		return
+	}
+	ringSize := ts.tx.PoolSize() / RING_FRACTION
+	if size > max(ringSize, RING_MIN_BLOCKS) {
+		ts.tx.UseRing(ts.fileName, max(ringSize, 2))
+	}
+}
+
 func (ts *TableScan) atLastBlock() bool {
-	return ts.rp.Block().BlockNumber() == ts.tx.Size(ts.fileName)-1
+	size, err := ts.tx.Size(ts.fileName)
+	if err != nil {
+		panic(err)
+	}
+	return ts.rp.Block().BlockNumber() == size-1
 }
@@ -26,10 +26,16 @@ func TestTableScan(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	tx := tx.NewTransaction(fm, lm, bm)
+	tx, err := tx.NewTransaction(fm, lm, bm)
+	if err != nil {
+		t.Fatalf("failed to start txn: %v", err)
+	}
 
 	sch := NewSchema()
 	sch.AddIntField("A")
@@ -75,3 +81,229 @@ func TestTableScan(t *testing.T) {
 	ts.Close()
 	tx.Commit()
 }
+
+func TestTableScanReadAhead(t *testing.T) {
+	storage := file.NewMemStorage()
+	db := setupCrashDB(storage)
+	tx := db.NewTx()
+	for i := range 1000 {
+		db.Planner().ExecuteUpdate("insert into crash(a, b) values ("+strconv.Itoa(i)+", 'row')", tx)
+	}
+	tx.Commit()
+	db.Close()
+
+	// reopened, few blocks of the table are in the pool
+	db = NewSimpleDBWithStorage(storage)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx = db.NewTx()
+	size, _ := tx.Size("crash.tbl")
+	before := db.BufferMgr().Stats()
+	scan := NewTableScan(tx, "crash", db.MdMgr().GetLayout("crash", tx))
+	rows := 0
+	for scan.Next() {
+		rows++
+	}
+	scan.Close()
+	tx.Commit()
+	after := db.BufferMgr().Stats()
+
+	if rows != 1000 {
+		t.Fatalf("expected %d rows, got %d", 1000, rows)
+	}
+	hits := after.PrefetchHits - before.PrefetchHits
+	t.Logf("%d blocks read ahead out of %d, %d misses", hits, size, after.Misses-before.Misses)
+	if hits < size/2 {
+		t.Fatalf("expected at least %d blocks read ahead, got %d", size/2, hits)
+	}
+}
+
+// the runs of a sort are temp tables read by table scans, which read ahead their blocks
+func TestSortScanReadAhead(t *testing.T) {
+	db := setupCrashDB(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	// two ascending halves split into two runs, merged by the sort scan
+	for i := range 1000 {
+		db.Planner().ExecuteUpdate("insert into crash(a, b) values ("+strconv.Itoa(i%500)+", 'row')", tx)
+	}
+	tx.Commit()
+
+	tx = db.NewTx()
+	size, _ := tx.Size("crash.tbl")
+	plan := NewSortPlan(tx, NewTablePlan(tx, "crash", db.MdMgr()), []string{"a"})
+	scan := plan.Open()
+	before := db.BufferMgr().Stats()
+	rows, last := 0, -1
+	for scan.Next() {
+		a := scan.GetInt("a")
+		if a < last {
+			t.Fatalf("expected sorted rows, got %d after %d", a, last)
+		}
+		rows, last = rows+1, a
+	}
+	scan.Close()
+	tx.Commit()
+	after := db.BufferMgr().Stats()
+
+	if rows != 1000 {
+		t.Fatalf("expected %d rows, got %d", 1000, rows)
+	}
+	// the runs hold as many blocks as the table, read by two scans sharing the pool
+	hits := after.PrefetchHits - before.PrefetchHits
+	t.Logf("%d blocks read ahead out of %d, %d misses", hits, size, after.Misses-before.Misses)
+	if hits < size/4 {
+		t.Fatalf("expected at least %d blocks read ahead, got %d", size/4, hits)
+	}
+}
+
+func TestTableScanRing(t *testing.T) {
+	db := setupCrashDB(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	for i := range 1000 {
+		db.Planner().ExecuteUpdate("insert into crash(a, b) values ("+strconv.Itoa(i)+", 'row')", tx)
+	}
+	tx.Commit()
+
+	// the blocks of other files stay in the pool through a large select,
+	// but for those the ring's buffers replaced when the ring was filled
+	others := func() map[file.BlockID]bool {
+		blocks := make(map[file.BlockID]bool)
+		for _, frame := range db.BufferMgr().Frames() {
+			if frame.Block.FileName() != "crash.tbl" {
+				blocks[frame.Block] = true
+			}
+		}
+		return blocks
+	}
+	before := others()
+	if !before[file.NewBlockID("tblcat.tbl", 0)] {
+		t.Fatalf("expected the catalog in the pool")
+	}
+	tx = db.NewTx()
+	scan := db.Planner().CreateQueryPlan("select a, b from crash", tx).Open()
+	rows := 0
+	for scan.Next() {
+		rows++
+	}
+	scan.Close()
+	tx.Commit()
+	if rows != 1000 {
+		t.Fatalf("expected %d rows, got %d", 1000, rows)
+	}
+	after := others()
+	replaced := 0
+	for blk := range before {
+		if !after[blk] {
+			replaced++
+		}
+	}
+	if ringSize := BUFFER_SIZE / RING_FRACTION; replaced > ringSize {
+		t.Fatalf("expected at most %d blocks replaced, got %d", ringSize, replaced)
+	}
+	if stats := db.BufferMgr().Stats(); stats.RingReuses == 0 {
+		t.Fatalf("expected the scan to recycle a ring")
+	}
+}
+
+// a catalog larger than a ring's threshold is still scanned through the main pool
+func TestCatalogScanNoRing(t *testing.T) {
+	db := NewSimpleDBWithStorage(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	schema := NewSchema()
+	schema.AddIntField("a")
+	schema.AddStringField("b", 8)
+	for i := range 60 {
+		db.MdMgr().CreateTable("t"+strconv.Itoa(i), schema, tx)
+	}
+	tx.Commit()
+
+	tx = db.NewTx()
+	if size, _ := tx.Size("fldcat.tbl"); size <= RING_MIN_BLOCKS {
+		t.Fatalf("expected fldcat to have more than %d blocks, got %d", RING_MIN_BLOCKS, size)
+	}
+	before := db.BufferMgr().Stats()
+	for _, catalog := range []string{"tblcat", "fldcat"} {
+		scan := NewTableScan(tx, catalog, db.MdMgr().GetLayout(catalog, tx))
+		for scan.Next() {
+		}
+		scan.Close()
+	}
+	tx.Commit()
+	if reuses := db.BufferMgr().Stats().RingReuses - before.RingReuses; reuses != 0 {
+		t.Fatalf("expected the catalog scans to use no ring, got %d ring reuses", reuses)
+	}
+}
+
+func TestTableScanFreesBlocks(t *testing.T) {
+	db := setupCrashDB(file.NewMemStorage())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	tx := db.NewTx()
+	for i := range 1000 {
+		db.Planner().ExecuteUpdate("insert into crash(a, b) values ("+strconv.Itoa(i)+", 'row')", tx)
+	}
+	tx.Commit()
+
+	size := func() int {
+		size, _ := db.FileMgr().Length("crash.tbl")
+		return size
+	}
+	deleteRows := func(where func(a int) bool) {
+		tx := db.NewTx()
+		scan := NewTableScan(tx, "crash", db.MdMgr().GetLayout("crash", tx))
+		for scan.Next() {
+			if where(scan.GetInt("a")) {
+				scan.Delete()
+			}
+		}
+		scan.Close()
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+	}
+	full := size()
+
+	// the emptied blocks at the end of the table are cut off
+	deleteRows(func(a int) bool { return a >= 500 })
+	half := size()
+	if half > full/2+1 {
+		t.Fatalf("expected the table to shrink to about %d blocks, got %d", full/2, half)
+	}
+
+	// the emptied blocks in the middle are kept and filled again by inserts
+	deleteRows(func(a int) bool { return a < 100 })
+	if size() != half {
+		t.Fatalf("expected the table to keep %d blocks, got %d", half, size())
+	}
+	tx = db.NewTx()
+	for i := range 100 {
+		db.Planner().ExecuteUpdate("insert into crash(a, b) values ("+strconv.Itoa(i)+", 'new')", tx)
+	}
+	tx.Commit()
+	if size() != half {
+		t.Fatalf("expected the inserts to reuse the freed blocks, the table grew from %d to %d blocks", half, size())
+	}
+
+	tx = db.NewTx()
+	scan := db.Planner().CreateQueryPlan("select a from crash", tx).Open()
+	rows := 0
+	for scan.Next() {
+		rows++
+	}
+	scan.Close()
+	tx.Commit()
+	if rows != 500 {
+		t.Fatalf("expected %d rows, got %d", 500, rows)
+	}
+}
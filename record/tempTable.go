@@ -10,24 +10,26 @@ import (
 /*
 A class that creates temporary tables
 A temp table is not registered in the catalog
+Its files start with tmp, the file manager removes them when the database is opened
 */
 type TempTable struct {
-	mu sync.Mutex
+	tableName string
+	layout    *Layout
+	tx        *tx.Transaction
+}
 
-	tableName    string
-	layout       *Layout
-	tx           *tx.Transaction
+// numbers the temp tables of every database in the process, so no two share a file
+var (
+	tempMu       sync.Mutex
 	nextTableNum int
-}
+)
 
 func NewTempTable(tx *tx.Transaction, schema *Schema) *TempTable {
-	table := &TempTable{
-		tx:           tx,
-		layout:       NewLayout(schema),
-		nextTableNum: 0,
+	return &TempTable{
+		tableName: nextTableName(),
+		layout:    NewLayout(schema),
+		tx:        tx,
 	}
-	table.tableName = table.nextTableName()
-	return table
 }
 
 func (tt *TempTable) Open() UpdateScan {
@@ -43,9 +45,9 @@ func (tt *TempTable) GetLayout() *Layout {
 	return tt.layout
 }
 
-func (tt *TempTable) nextTableName() string {
-	tt.mu.Lock()
-	defer tt.mu.Unlock()
-	tt.nextTableNum++
-	return fmt.Sprintf("test%d", tt.nextTableNum)
+func nextTableName() string {
+	tempMu.Lock()
+	defer tempMu.Unlock()
+	nextTableNum++
+	return fmt.Sprintf("tmp%d", nextTableNum)
 }
@@ -1,25 +1,34 @@
 package tx
 
 import (
+	"context"
+	"fmt"
+	"sort"
+
 	"github.com/nitishsharma2825/simpleDB/buffer"
 	"github.com/nitishsharma2825/simpleDB/file"
 )
 
 /*
 Manages the transaction's currently pinned buffers
+A block pinned several times stays pinned until it is unpinned as many times
 */
 
 type BufferList struct {
 	buffers map[file.BlockID]*buffer.Buffer
-	pins    map[file.BlockID]bool
+	pins    map[file.BlockID]int    // times each block is pinned
+	rings   map[string]*buffer.Ring // files whose blocks are pinned through a ring
 	bm      *buffer.Manager
+	txnum   int
 }
 
-func NewBufferList(bm *buffer.Manager) *BufferList {
+func NewBufferList(bm *buffer.Manager, txnum int) *BufferList {
 	return &BufferList{
 		bm:      bm,
-		pins:    make(map[file.BlockID]bool),
+		pins:    make(map[file.BlockID]int),
 		buffers: make(map[file.BlockID]*buffer.Buffer),
+		rings:   make(map[string]*buffer.Ring),
+		txnum:   txnum,
 	}
 }
 
@@ -34,17 +43,31 @@ func (bl *BufferList) GetBuffer(blockId file.BlockID) *buffer.Buffer {
 	return nil
 }
 
+// Returns how many times the txn pinned the block
+func (bl *BufferList) PinCount(blockId file.BlockID) int {
+	return bl.pins[blockId]
+}
+
 /*
 Pin the block and keep track of the buffer internally
 */
 func (bl *BufferList) Pin(blockId file.BlockID) error {
-	buff, err := bl.bm.Pin(blockId)
+	ctx, cancel := context.WithTimeout(buffer.WithPinOwner(context.Background(), bl.txnum), buffer.MAX_TIME)
+	defer cancel()
+
+	var buff *buffer.Buffer
+	var err error
+	if ring := bl.rings[blockId.FileName()]; ring != nil {
+		buff, err = bl.bm.PinRingContext(ctx, ring, blockId)
+	} else {
+		buff, err = bl.bm.PinContext(ctx, blockId)
+	}
 	if err != nil {
 		return err
 	}
 
 	bl.buffers[blockId] = buff
-	bl.pins[blockId] = true
+	bl.pins[blockId]++
 	return nil
 }
 
@@ -53,20 +76,27 @@ Unpin the specified block
 */
 func (bl *BufferList) UnPin(blockId file.BlockID) {
 	buff := bl.buffers[blockId]
-	bl.bm.UnPin(buff)
-	delete(bl.pins, blockId)
-	if !bl.pins[blockId] {
+	bl.bm.UnPinFor(buff, bl.txnum)
+	bl.pins[blockId]--
+	if bl.pins[blockId] <= 0 {
+		delete(bl.pins, blockId)
 		delete(bl.buffers, blockId)
 	}
 }
 
 /*
 Unpin any buffers still pinned by this transaction
+The pins left are reported as leaked if pin tracking is on, the txn is ending
 */
 func (bl *BufferList) UnPinAll() {
-	for blockId := range bl.pins {
+	if leaked := bl.Outstanding(); len(leaked) > 0 {
+		bl.bm.ReportPins(fmt.Sprintf("transaction %d ended holding %d pins:", bl.txnum, len(leaked)), leaked)
+	}
+	for blockId, count := range bl.pins {
 		buff := bl.buffers[blockId]
-		bl.bm.UnPin(buff)
+		for range count {
+			bl.bm.UnPinFor(buff, bl.txnum)
+		}
 	}
 
 	for bi := range bl.buffers {
@@ -77,3 +107,28 @@ func (bl *BufferList) UnPinAll() {
 		delete(bl.pins, bi)
 	}
 }
+
+// Returns a record of every pin held, ordered by block, the buffer manager has their stacks if pin tracking is on
+func (bl *BufferList) Outstanding() []buffer.PinRecord {
+	pins := make([]buffer.PinRecord, 0)
+	if bl.bm.PinTracking() {
+		for _, pin := range bl.bm.OutstandingPins() {
+			if pin.TxNum == bl.txnum {
+				pins = append(pins, pin)
+			}
+		}
+	} else {
+		for blockId, count := range bl.pins {
+			for range count {
+				pins = append(pins, buffer.PinRecord{Block: blockId, TxNum: bl.txnum})
+			}
+		}
+	}
+	sort.SliceStable(pins, func(i, j int) bool {
+		if pins[i].Block.FileName() != pins[j].Block.FileName() {
+			return pins[i].Block.FileName() < pins[j].Block.FileName()
+		}
+		return pins[i].Block.BlockNumber() < pins[j].Block.BlockNumber()
+	})
+	return pins
+}
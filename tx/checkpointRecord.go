@@ -21,7 +21,9 @@ func (cpr *CheckpointRecord) TxNumber() int {
 	return -1
 }
 
-func (cpr *CheckpointRecord) Undo(*Transaction) {}
+func (cpr *CheckpointRecord) Undo(*Transaction) error {
+	return nil
+}
 
 func (cpr *CheckpointRecord) ToString() string {
 	return "<CHECKPOINT>"
@@ -30,7 +32,7 @@ func (cpr *CheckpointRecord) ToString() string {
 // write the CHECKPOINT record to the log
 // contains the CHECKPOINT operator
 // returns the LSN of the last log value
-func WriteCheckpointRecordToLog(lm *log.Manager) int {
+func WriteCheckpointRecordToLog(lm *log.Manager) (int, error) {
 	record := make([]byte, file.IntBytes)
 	page := file.NewPageWithSlice(record)
 	page.SetInt(0, CHECKPOINT)
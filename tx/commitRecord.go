@@ -27,7 +27,9 @@ func (cr *CommitRecord) TxNumber() int {
 	return cr.txnum
 }
 
-func (cr *CommitRecord) Undo(*Transaction) {}
+func (cr *CommitRecord) Undo(*Transaction) error {
+	return nil
+}
 
 func (cr *CommitRecord) ToString() string {
 	return fmt.Sprintf("<COMMIT %d>", cr.txnum)
@@ -36,7 +38,7 @@ func (cr *CommitRecord) ToString() string {
 // write the commit record to the log
 // contains the COMMIT operator, followed by txn id
 // returns the LSN of the last log value
-func WriteCommitRecordToLog(lm *log.Manager, txnum int) int {
+func WriteCommitRecordToLog(lm *log.Manager, txnum int) (int, error) {
 	record := make([]byte, 2*file.IntBytes)
 	page := file.NewPageWithSlice(record)
 	page.SetInt(0, COMMIT)
@@ -49,6 +49,22 @@ func (cm *ConcurrencyManager) Xlock(blockId file.BlockID) {
 	}
 }
 
+/*
+Obtain an XLock on the block if it can be had without waiting
+Returns false, holding no new lock, if another txn has the block locked
+*/
+func (cm *ConcurrencyManager) TryXlock(blockId file.BlockID) bool {
+	if cm.HasXlock(blockId) {
+		return true
+	}
+	_, held := cm.locks[blockId]
+	if !cm.lt.TryXlock(blockId, held) {
+		return false
+	}
+	cm.locks[blockId] = "X"
+	return true
+}
+
 /*
 Release all locks by asking the lock table
 */
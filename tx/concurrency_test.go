@@ -3,6 +3,7 @@ package tx
 import (
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,16 +25,25 @@ func TestConcurrency(t *testing.T) {
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	go txA(t, fm, lm, bm, blockFile)
-	go txB(t, fm, lm, bm, blockFile)
-	go txC(t, fm, lm, bm, blockFile)
+	var wg sync.WaitGroup
+	for _, txFn := range []func(*testing.T, *file.Manager, *log.Manager, *buffer.Manager, string){txA, txB, txC} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			txFn(t, fm, lm, bm, blockFile)
+		}()
+	}
+	wg.Wait()
 }
 
 func txA(t *testing.T, fm *file.Manager, lm *log.Manager, bm *buffer.Manager, blockFile string) {
-	tx := NewTransaction(fm, lm, bm)
+	tx := newTxn(t, fm, lm, bm)
 	blockId1 := file.NewBlockID(blockFile, 1)
 	blockId2 := file.NewBlockID(blockFile, 2)
 	var err error
@@ -58,7 +68,7 @@ func txA(t *testing.T, fm *file.Manager, lm *log.Manager, bm *buffer.Manager, bl
 }
 
 func txB(t *testing.T, fm *file.Manager, lm *log.Manager, bm *buffer.Manager, blockFile string) {
-	tx := NewTransaction(fm, lm, bm)
+	tx := newTxn(t, fm, lm, bm)
 	blockId1 := file.NewBlockID(blockFile, 1)
 	blockId2 := file.NewBlockID(blockFile, 2)
 	var err error
@@ -83,7 +93,7 @@ func txB(t *testing.T, fm *file.Manager, lm *log.Manager, bm *buffer.Manager, bl
 }
 
 func txC(t *testing.T, fm *file.Manager, lm *log.Manager, bm *buffer.Manager, blockFile string) {
-	tx := NewTransaction(fm, lm, bm)
+	tx := newTxn(t, fm, lm, bm)
 	blockId1 := file.NewBlockID(blockFile, 1)
 	blockId2 := file.NewBlockID(blockFile, 2)
 	var err error
@@ -3,3 +3,6 @@ package tx
 import "errors"
 
 var ErrLockAbort = errors.New("transaction needs to abort because a lock could not be obtained")
+var ErrBlockNotAllocated = errors.New("block is not allocated")
+var ErrFreeMapBlock = errors.New("free space map blocks cannot be freed")
+var ErrUnknownLogRecord = errors.New("log record has an unknown type")
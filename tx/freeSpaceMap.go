@@ -0,0 +1,249 @@
+package tx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+)
+
+/*
+Keeps track of the free blocks of every file in a <filename>.fsm bitmap, a set bit marks a freed block
+The bitmap is changed through SetInt, so it is locked and logged like any other page
+*/
+
+const FREE_MAP_SUFFIX = ".fsm"
+
+const wordBits = file.IntBytes * 8
+
+func freeMapFile(filename string) string {
+	return filename + FREE_MAP_SUFFIX
+}
+
+// returns how many blocks of the file one bitmap block covers
+func (txn *Transaction) blocksPerMapBlock() int {
+	return (txn.BlockSize() / file.IntBytes) * wordBits
+}
+
+// returns the bitmap block, the offset of the word and the mask of the bit for the block
+func (txn *Transaction) freeMapPosition(blockId file.BlockID) (file.BlockID, int, uint32) {
+	perBlock := txn.blocksPerMapBlock()
+	mapBlock := file.NewBlockID(freeMapFile(blockId.FileName()), blockId.BlockNumber()/perBlock)
+	bit := blockId.BlockNumber() % perBlock
+	return mapBlock, (bit / wordBits) * file.IntBytes, 1 << (bit % wordBits)
+}
+
+// pins the block unless the txn already has it pinned
+// the returned function undoes only the pin taken here
+func (txn *Transaction) pinOnce(blockId file.BlockID) (func(), error) {
+	if txn.myBuffers.GetBuffer(blockId) != nil {
+		return func() {}, nil
+	}
+	if err := txn.Pin(blockId); err != nil {
+		return nil, err
+	}
+	return func() { txn.UnPin(blockId) }, nil
+}
+
+/*
+Marks the block as free for a later Allocate, under an XLock on the block
+Trailing free blocks are cut off the file once the txn commits
+*/
+func (txn *Transaction) Free(blockId file.BlockID) error {
+	if strings.HasSuffix(blockId.FileName(), FREE_MAP_SUFFIX) {
+		return fmt.Errorf("free %s: %w", blockId, ErrFreeMapBlock)
+	}
+	size, err := txn.Size(blockId.FileName())
+	if err != nil {
+		return err
+	}
+	if blockId.BlockNumber() < 0 || blockId.BlockNumber() >= size {
+		return fmt.Errorf("free %s: %w", blockId, ErrBlockNotAllocated)
+	}
+	txn.cm.Xlock(blockId)
+
+	mapBlock, offset, mask := txn.freeMapPosition(blockId)
+	txn.cm.Xlock(mapBlock)
+	unpin, err := txn.pinOnce(mapBlock)
+	if err != nil {
+		return err
+	}
+	defer unpin()
+
+	val, err := txn.GetInt(mapBlock, offset)
+	if err != nil {
+		return err
+	}
+	word := uint32(val)
+	if word&mask != 0 {
+		return fmt.Errorf("free %s: %w", blockId, ErrBlockNotAllocated)
+	}
+	if err := txn.SetInt(mapBlock, offset, int(word|mask), true); err != nil {
+		return err
+	}
+	txn.freed[blockId.FileName()] = true
+	return nil
+}
+
+/*
+Returns a freed block of the file, or a new one appended to it, holding an XLock on it
+A reused block keeps its old contents and must be formatted
+*/
+func (txn *Transaction) Allocate(filename string) (file.BlockID, error) {
+	size, err := txn.Size(filename)
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	perBlock := txn.blocksPerMapBlock()
+	for mapNum := 0; mapNum*perBlock < size; mapNum++ {
+		mapBlock := file.NewBlockID(freeMapFile(filename), mapNum)
+		blockNum, err := txn.takeFreeBit(mapBlock, size)
+		if err != nil {
+			return file.BlockID{}, err
+		}
+		if blockNum >= 0 {
+			blockId := file.NewBlockID(filename, blockNum)
+			txn.cm.Xlock(blockId)
+			return blockId, nil
+		}
+	}
+	blockId, err := txn.Append(filename)
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	return blockId, txn.clearStaleBit(blockId)
+}
+
+// a backup can replay the free of a block truncated later, the block is not handed out twice
+func (txn *Transaction) clearStaleBit(blockId file.BlockID) error {
+	mapBlock, offset, mask := txn.freeMapPosition(blockId)
+	txn.cm.Xlock(mapBlock)
+	unpin, err := txn.pinOnce(mapBlock)
+	if err != nil {
+		return err
+	}
+	defer unpin()
+
+	val, err := txn.GetInt(mapBlock, offset)
+	if err != nil {
+		return err
+	}
+	word := uint32(val)
+	if word&mask == 0 {
+		return nil
+	}
+	return txn.SetInt(mapBlock, offset, int(word&^mask), true)
+}
+
+// clears the first set bit in the bitmap block and returns its block number, or -1 if there is none
+// bits past the end of the file are left alone, a backup can replay a free of a block cut off later
+func (txn *Transaction) takeFreeBit(mapBlock file.BlockID, size int) (int, error) {
+	txn.cm.Xlock(mapBlock)
+	unpin, err := txn.pinOnce(mapBlock)
+	if err != nil {
+		return -1, err
+	}
+	defer unpin()
+
+	first := mapBlock.BlockNumber() * txn.blocksPerMapBlock()
+	for offset := 0; offset+file.IntBytes <= txn.BlockSize(); offset += file.IntBytes {
+		val, err := txn.GetInt(mapBlock, offset)
+		if err != nil {
+			return -1, err
+		}
+		word := uint32(val)
+		for bit := 0; word != 0 && bit < wordBits; bit++ {
+			mask := uint32(1) << bit
+			if word&mask == 0 {
+				continue
+			}
+			blockNum := first + (offset/file.IntBytes)*wordBits + bit
+			if blockNum >= size {
+				return -1, nil
+			}
+			if err := txn.SetInt(mapBlock, offset, int(word&^mask), true); err != nil {
+				return -1, err
+			}
+			return blockNum, nil
+		}
+	}
+	return -1, nil
+}
+
+/*
+Clears the bits of the trailing free blocks of the files this txn freed blocks in, logged before its commit record,
+so the bitmap never outlives the commit marking the blocks free, the blocks are cut off once the txn commits
+It never waits for a lock, a file locked by another txn is cut by a later commit
+A crash before the cut leaves the blocks in the file with their slots freed, out of Allocate's reach
+*/
+func (txn *Transaction) clearTrailingFree() error {
+	for filename := range txn.freed {
+		if err := txn.clearTrailingBits(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clears the bits from the end of the file back to its last block in use, which is where the file is cut
+func (txn *Transaction) clearTrailingBits(filename string) error {
+	if !txn.cm.TryXlock(file.NewBlockID(filename, END_OF_FILE)) {
+		return nil
+	}
+	size, err := txn.fm.Length(filename)
+	if err != nil {
+		return err
+	}
+
+	newSize := size
+	for newSize > 0 {
+		var cleared bool
+		if cleared, err = txn.clearIfFree(file.NewBlockID(filename, newSize-1)); err != nil || !cleared {
+			break
+		}
+		newSize--
+	}
+	// the bits cleared before an error are cut off all the same
+	if newSize < size {
+		txn.cuts[filename] = newSize
+	}
+	return err
+}
+
+// clears the block's bit if it is set, false if the block is pinned or its bitmap block locked by another txn
+func (txn *Transaction) clearIfFree(blockId file.BlockID) (bool, error) {
+	if txn.bm.PinCount(blockId) > txn.myBuffers.PinCount(blockId) {
+		return false, nil
+	}
+	mapBlock, offset, mask := txn.freeMapPosition(blockId)
+	if !txn.cm.TryXlock(mapBlock) {
+		return false, nil
+	}
+	unpin, err := txn.pinOnce(mapBlock)
+	if err != nil {
+		return false, err
+	}
+	defer unpin()
+	val, err := txn.GetInt(mapBlock, offset)
+	if err != nil {
+		return false, err
+	}
+	word := uint32(val)
+	if word&mask == 0 {
+		return false, nil
+	}
+	if err := txn.SetInt(mapBlock, offset, int(word&^mask), true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// cuts the blocks whose bits the commit cleared off the files, a block pinned since is kept as a crash would keep it
+func (txn *Transaction) truncateFreeBlocks() error {
+	for filename, newSize := range txn.cuts {
+		if _, err := txn.bm.Truncate(filename, newSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
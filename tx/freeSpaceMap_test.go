@@ -0,0 +1,189 @@
+package tx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nitishsharma2825/simpleDB/buffer"
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+)
+
+func TestFreeSpaceMap(t *testing.T) {
+	const blockFile = "testfile"
+	const logFile = "logfile"
+	const blockSize = 400
+	const bufferPoolSize = 8
+
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, logFile)
+	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
+
+	allocate := func(txn *Transaction, expected int) {
+		t.Helper()
+		blockId, err := txn.Allocate(blockFile)
+		if err != nil {
+			t.Fatalf("failed to allocate: %v", err)
+		}
+		if blockId.BlockNumber() != expected {
+			t.Fatalf("expected to allocate block %d, got %d", expected, blockId.BlockNumber())
+		}
+	}
+	free := func(txn *Transaction, blockNum int) {
+		t.Helper()
+		if err := txn.Free(file.NewBlockID(blockFile, blockNum)); err != nil {
+			t.Fatalf("failed to free block %d: %v", blockNum, err)
+		}
+	}
+	checkLength := func(expected int) {
+		t.Helper()
+		if got, _ := fm.Length(blockFile); got != expected {
+			t.Fatalf("expected file length %d, got %d", expected, got)
+		}
+	}
+
+	tx1 := newTxn(t, fm, lm, bm)
+	for i := range 4 {
+		allocate(tx1, i)
+	}
+	tx1.Commit()
+	checkLength(4)
+
+	// a free block in the middle is reused, not truncated
+	tx2 := newTxn(t, fm, lm, bm)
+	free(tx2, 1)
+	if err := tx2.Free(file.NewBlockID(blockFile, 1)); !errors.Is(err, ErrBlockNotAllocated) {
+		t.Fatalf("expected ErrBlockNotAllocated on double free, got %v", err)
+	}
+	tx2.Commit()
+	checkLength(4)
+
+	tx3 := newTxn(t, fm, lm, bm)
+	allocate(tx3, 1)
+	tx3.Commit()
+
+	// a rolled back free is undone
+	tx4 := newTxn(t, fm, lm, bm)
+	free(tx4, 3)
+	tx4.Rollback()
+	checkLength(4)
+
+	// trailing free blocks are truncated at commit
+	tx5 := newTxn(t, fm, lm, bm)
+	free(tx5, 3)
+	free(tx5, 2)
+	tx5.Commit()
+	checkLength(2)
+
+	tx6 := newTxn(t, fm, lm, bm)
+	allocate(tx6, 2)
+	tx6.Commit()
+
+	// a free that never commits is undone by recovery
+	tx7 := newTxn(t, fm, lm, bm)
+	free(tx7, 0)
+	bm.FlushAll(tx7.txnum)
+	tx7.myBuffers.UnPinAll()
+	tx7.cm.Release()
+
+	tx8 := newTxn(t, fm, lm, bm)
+	if err := tx8.Recover(); err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+	tx8.Commit()
+
+	tx9 := newTxn(t, fm, lm, bm)
+	allocate(tx9, 3)
+	tx9.Commit()
+	checkLength(4)
+
+	// a file another txn is reading keeps its free blocks, a later commit cuts them off
+	reader := newTxn(t, fm, lm, bm)
+	reader.Size(blockFile)
+	tx10 := newTxn(t, fm, lm, bm)
+	free(tx10, 3)
+	if err := tx10.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	checkLength(4)
+	reader.Commit()
+
+	tx11 := newTxn(t, fm, lm, bm)
+	free(tx11, 2)
+	tx11.Commit()
+	checkLength(2)
+
+	// a block pinned elsewhere is not cut off and stays free
+	pinned, _ := bm.Pin(file.NewBlockID(blockFile, 1))
+	tx12 := newTxn(t, fm, lm, bm)
+	free(tx12, 1)
+	tx12.Commit()
+	checkLength(2)
+	bm.UnPin(pinned)
+
+	tx13 := newTxn(t, fm, lm, bm)
+	allocate(tx13, 1)
+	tx13.Commit()
+	checkLength(2)
+}
+
+// a crash after the file is cut recovers a bitmap with no free block past the end of the file
+func TestFreeSpaceMapCrashAfterTruncate(t *testing.T) {
+	const blockFile = "testfile"
+	storage := file.NewFaultStorage(1)
+	fm, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8)
+
+	tx1 := newTxn(t, fm, lm, bm)
+	for range 4 {
+		if _, err := tx1.Allocate(blockFile); err != nil {
+			t.Fatalf("failed to allocate: %v", err)
+		}
+	}
+	tx1.Commit()
+	tx2 := newTxn(t, fm, lm, bm)
+	for _, blockNum := range []int{3, 2} {
+		if err := tx2.Free(file.NewBlockID(blockFile, blockNum)); err != nil {
+			t.Fatalf("failed to free block %d: %v", blockNum, err)
+		}
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	// the cut file reaches the disk, the bitmap stays in the pool
+	if err := fm.SyncAll(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	storage.Crash(file.DROP_UNSYNCED)
+
+	storage.Restart()
+	fm, err = file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to reopen file manager: %v", err)
+	}
+	lm = log.NewLogManager(fm, "logfile")
+	bm = buffer.NewBufferManager(fm, lm, 8)
+	tx3 := newTxn(t, fm, lm, bm)
+	if err := tx3.Recover(); err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+	size, err := tx3.Size(blockFile)
+	if err != nil || size != 2 {
+		t.Fatalf("expected file length %d, got %d (%v)", 2, size, err)
+	}
+	mapBlock, offset, _ := tx3.freeMapPosition(file.NewBlockID(blockFile, 0))
+	if err := tx3.Pin(mapBlock); err != nil {
+		t.Fatalf("failed to pin bitmap: %v", err)
+	}
+	if word, err := tx3.GetInt(mapBlock, offset); err != nil || word != 0 {
+		t.Fatalf("expected no free block, got bitmap word %b (%v)", word, err)
+	}
+	tx3.Commit()
+}
@@ -114,6 +114,25 @@ func (lt *LockTable) Xlock(blockId file.BlockID) error {
 	}
 }
 
+/*
+Grant an XLock on the block only if no other txn holds a lock on it, never waits
+holdsSlock tells whether the caller's own SLock is among the locks held
+*/
+func (lt *LockTable) TryXlock(blockId file.BlockID, holdsSlock bool) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	own := 0
+	if holdsSlock {
+		own = 1
+	}
+	if lt.GetLockVal(blockId) != own {
+		return false
+	}
+	lt.locks[blockId] = -1
+	return true
+}
+
 /*
 Release a lock on the specified block
 */
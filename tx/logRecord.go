@@ -1,6 +1,9 @@
 package tx
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/nitishsharma2825/simpleDB/file"
 )
 
@@ -11,8 +14,39 @@ const (
 	ROLLBACK   = 3
 	SETINT     = 4
 	SETSTRING  = 5
+	PAGEIMAGE  = 6
+	SETBYTES   = 7
 )
 
+var opNames = []string{
+	CHECKPOINT: "CHECKPOINT",
+	START:      "START",
+	COMMIT:     "COMMIT",
+	ROLLBACK:   "ROLLBACK",
+	SETINT:     "SETINT",
+	SETSTRING:  "SETSTRING",
+	PAGEIMAGE:  "PAGEIMAGE",
+	SETBYTES:   "SETBYTES",
+}
+
+// Returns the name of a log record type, e.g. "SETINT"
+func OpName(op int) string {
+	if op < 0 || op >= len(opNames) {
+		return fmt.Sprintf("UNKNOWN(%d)", op)
+	}
+	return opNames[op]
+}
+
+// Returns the log record type with the name, ignoring case
+func ParseOp(name string) (int, bool) {
+	for op, opName := range opNames {
+		if strings.EqualFold(name, opName) {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
 type LogRecord interface {
 	// the log record's type
 	Op() int
@@ -21,27 +55,53 @@ type LogRecord interface {
 	// Undoes the operation encoded by this log record
 	// only applicable for SETINT and SETSTRING record type
 	// takes id of the transaction performing the undo
-	Undo(*Transaction)
+	Undo(*Transaction) error
 
 	ToString() string
 }
 
-func CreateLogRecord(record []byte) LogRecord {
+// implemented by the SETINT, SETSTRING, SETBYTES and PAGEIMAGE records, which also carry the new contents
+type RedoRecord interface {
+	LogRecord
+	// writes the new value again, takes the transaction performing the recovery
+	Redo(*Transaction) error
+}
+
+// implemented by the SETINT, SETSTRING and SETBYTES records, exposes the change they describe
+type UpdateRecord interface {
+	LogRecord
+	Block() file.BlockID
+	Offset() int
+	// value before the change, an int, a string or a []byte
+	OldValue() any
+	// value after the change, an int, a string or a []byte
+	NewValue() any
+}
+
+// returns ErrUnknownLogRecord if the record's type is not one of the above
+func CreateLogRecord(record []byte) (LogRecord, error) {
+	if len(record) < file.IntBytes {
+		return nil, fmt.Errorf("%w: %d bytes", ErrUnknownLogRecord, len(record))
+	}
 	page := file.NewPageWithSlice(record)
-	switch page.GetInt(0) {
+	switch op := page.GetInt(0); op {
 	case CHECKPOINT:
-		return NewCheckpointRecord()
+		return NewCheckpointRecord(), nil
 	case START:
-		return NewStartRecord(page)
+		return NewStartRecord(page), nil
 	case COMMIT:
-		return NewCommitRecord(page)
+		return NewCommitRecord(page), nil
 	case ROLLBACK:
-		return NewRollbackRecord(page)
+		return NewRollbackRecord(page), nil
 	case SETINT:
-		return NewSetIntRecord(page)
+		return NewSetIntRecord(page), nil
 	case SETSTRING:
-		return NewSetStringRecord(page)
+		return NewSetStringRecord(page), nil
+	case PAGEIMAGE:
+		return NewPageImageRecord(page), nil
+	case SETBYTES:
+		return NewSetBytesRecord(page), nil
 	default:
-		return nil
+		return nil, fmt.Errorf("%w: %d", ErrUnknownLogRecord, op)
 	}
 }
@@ -0,0 +1,89 @@
+package tx
+
+import (
+	"fmt"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+)
+
+// a page does not fit in one log record, its image is logged in this many slices
+const PAGE_IMAGE_SLICES = 4
+
+// A slice of a page as it was before its first change since the last checkpoint, recovery writes it over a torn block
+type PageImageRecord struct {
+	txnum   int
+	blockId file.BlockID
+	offset  int
+	data    []byte
+}
+
+func NewPageImageRecord(p *file.Page) *PageImageRecord {
+	tpos := file.IntBytes
+	txnum := p.GetInt(tpos)
+
+	fpos := tpos + file.IntBytes
+	filename := p.GetString(fpos)
+	bpos := fpos + file.MaxLength(len(filename))
+	blockNum := p.GetInt(bpos)
+
+	opos := bpos + file.IntBytes
+	offset := p.GetInt(opos)
+
+	dpos := opos + file.IntBytes
+	return &PageImageRecord{
+		txnum:   txnum,
+		blockId: file.NewBlockID(filename, blockNum),
+		offset:  offset,
+		data:    p.GetBytes(dpos),
+	}
+}
+
+func (pir *PageImageRecord) Op() int {
+	return PAGEIMAGE
+}
+
+func (pir *PageImageRecord) TxNumber() int {
+	return pir.txnum
+}
+
+func (pir *PageImageRecord) Block() file.BlockID {
+	return pir.blockId
+}
+
+func (pir *PageImageRecord) Offset() int {
+	return pir.offset
+}
+
+// the page holds no change of the txn yet
+func (pir *PageImageRecord) Undo(*Transaction) error {
+	return nil
+}
+
+func (pir *PageImageRecord) Redo(txn *Transaction) error {
+	return txn.rm.restoreImage(pir.blockId, pir.offset, pir.data)
+}
+
+func (pir *PageImageRecord) ToString() string {
+	return fmt.Sprintf("<PAGEIMAGE %d %v %d %d bytes>", pir.txnum, pir.blockId.String(), pir.offset, len(pir.data))
+}
+
+func WritePageImageRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, offset int, data []byte) (int, error) {
+	tpos := file.IntBytes
+	fpos := tpos + file.IntBytes
+	bpos := fpos + file.MaxLength(len(blockId.FileName()))
+	opos := bpos + file.IntBytes
+	dpos := opos + file.IntBytes
+
+	record := make([]byte, dpos+file.IntBytes+len(data))
+	page := file.NewPageWithSlice(record)
+
+	page.SetInt(0, PAGEIMAGE)
+	page.SetInt(tpos, txnum)
+	page.SetString(fpos, blockId.FileName())
+	page.SetInt(bpos, blockId.BlockNumber())
+	page.SetInt(opos, offset)
+	page.SetBytes(dpos, data)
+
+	return lm.Append(record)
+}
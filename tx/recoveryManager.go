@@ -1,7 +1,10 @@
 package tx
 
 import (
+	"fmt"
+
 	"github.com/nitishsharma2825/simpleDB/buffer"
+	"github.com/nitishsharma2825/simpleDB/file"
 	"github.com/nitishsharma2825/simpleDB/log"
 )
 
@@ -13,65 +16,148 @@ type RecoveryManager struct {
 	bm    *buffer.Manager
 	tx    *Transaction
 	txnum int
+	// page images being redone, until their last slice is read
+	images map[file.BlockID]*file.Page
 }
 
 func NewRecoveryManager(tx *Transaction, txnum int, lm *log.Manager, bm *buffer.Manager) *RecoveryManager {
+	// a missing START record only makes rollback scan further back in the log,
+	// a failing log surfaces again on the transaction's first update
 	WriteStartRecordToLog(lm, txnum)
 	return &RecoveryManager{
-		lm:    lm,
-		bm:    bm,
-		tx:    tx,
-		txnum: txnum,
+		lm:     lm,
+		bm:     bm,
+		tx:     tx,
+		txnum:  txnum,
+		images: make(map[file.BlockID]*file.Page),
 	}
 }
 
 /*
 Write a commit record to the log, and flushes it to disk
-Since we will implement only undo-log recovery, no redo-log recovery, we are flushing all buffers too
+The modified buffers are not flushed, recovery redoes the logged changes instead
 */
-func (rm *RecoveryManager) Commit() {
-	rm.bm.FlushAll(rm.txnum)
-	lsn := WriteCommitRecordToLog(rm.lm, rm.txnum)
-	rm.lm.Flush(lsn)
+func (rm *RecoveryManager) Commit() error {
+	lsn, err := WriteCommitRecordToLog(rm.lm, rm.txnum)
+	if err != nil {
+		return err
+	}
+	return rm.lm.Flush(lsn)
 }
 
 /*
 Write a rollback record to the log and flush it to disk
 */
-func (rm *RecoveryManager) Rollback() {
-	rm.doRollback()
-	rm.bm.FlushAll(rm.txnum)
-	lsn := WriteRollbackRecordToLog(rm.lm, rm.txnum)
-	rm.lm.Flush(lsn)
+func (rm *RecoveryManager) Rollback() error {
+	if err := rm.doRollback(); err != nil {
+		return err
+	}
+	lsn, err := WriteRollbackRecordToLog(rm.lm, rm.txnum)
+	if err != nil {
+		return err
+	}
+	return rm.lm.Flush(lsn)
+}
+
+/*
+Recover the database from the log
+then make every data file durable and write a quiescent checkpoint record to the log and flush it
+Finally the log segments before the checkpoint are removed, as the log's retention policy says
+*/
+func (rm *RecoveryManager) Recover() error {
+	if err := rm.doRecover(); err != nil {
+		return err
+	}
+	return Checkpoint(rm.tx.fm, rm.lm, rm.bm)
 }
 
 /*
-Recover uncompleted transactions from the log
-and then write a quiescent checkpoint record to the log and flush it
+Writes every modified buffer, syncs the data files and logs a quiescent checkpoint record
+No txn may be running
 */
-func (rm *RecoveryManager) Recover() {
-	rm.doRecover()
-	rm.bm.FlushAll(rm.txnum)
-	lsn := WriteCheckpointRecordToLog(rm.lm)
-	rm.lm.Flush(lsn)
+func Checkpoint(fm *file.Manager, lm *log.Manager, bm *buffer.Manager) error {
+	if err := bm.FlushDirty(); err != nil {
+		return err
+	}
+	// the checkpoint ends the log recovery reads, everything before it must be on disk
+	if err := fm.SyncAll(); err != nil {
+		return err
+	}
+	lsn, err := WriteCheckpointRecordToLog(lm)
+	if err != nil {
+		return err
+	}
+	if err := lm.Flush(lsn); err != nil {
+		return err
+	}
+	// no txn is running, nothing before the checkpoint is needed any more
+	return lm.Truncate(lsn)
 }
 
 /*
 Write a setint record to the log and return its lsn
 */
-func (rm *RecoveryManager) SetInt(buff *buffer.Buffer, offset int, newVal int) int {
+func (rm *RecoveryManager) SetInt(buff *buffer.Buffer, offset int, newVal int) (int, error) {
 	oldVal := buff.Contents().GetInt(offset)
 	blockId := buff.Block()
-	return WriteSetIntRecordToLog(rm.lm, rm.txnum, blockId, offset, oldVal)
+	return WriteSetIntRecordToLog(rm.lm, rm.txnum, blockId, offset, oldVal, newVal)
 }
 
 /*
 Write a setstring record to the log and return its lsn
 */
-func (rm *RecoveryManager) SetString(buff *buffer.Buffer, offset int, newVal string) int {
+func (rm *RecoveryManager) SetString(buff *buffer.Buffer, offset int, newVal string) (int, error) {
 	oldVal := buff.Contents().GetString(offset)
 	blockId := buff.Block()
-	return WriteSetStringRecordToLog(rm.lm, rm.txnum, blockId, offset, oldVal)
+	return WriteSetStringRecordToLog(rm.lm, rm.txnum, blockId, offset, oldVal, newVal)
+}
+
+/*
+Write a setbytes record to the log and return its lsn
+*/
+func (rm *RecoveryManager) SetBytes(buff *buffer.Buffer, offset int, newVal []byte) (int, error) {
+	oldVal := make([]byte, len(newVal))
+	copy(oldVal, buff.Contents().Contents()[offset:])
+	blockId := buff.Block()
+	return WriteSetBytesRecordToLog(rm.lm, rm.txnum, blockId, offset, oldVal, newVal)
+}
+
+/*
+Write the page of the buffer to the log in slices and return the lsn of the last one
+*/
+func (rm *RecoveryManager) PageImage(buff *buffer.Buffer) (int, error) {
+	contents := buff.Contents().Contents()
+	size := len(contents) / PAGE_IMAGE_SLICES
+	lsn := -1
+	for offset := 0; offset < len(contents); offset += size {
+		var err error
+		end := min(offset+size, len(contents))
+		if lsn, err = WritePageImageRecordToLog(rm.lm, rm.txnum, buff.Block(), offset, contents[offset:end]); err != nil {
+			return -1, err
+		}
+	}
+	return lsn, nil
+}
+
+// restores the page once all slices of its image are read, an image cut off by a crash is ignored
+func (rm *RecoveryManager) restoreImage(blockId file.BlockID, offset int, data []byte) error {
+	page := rm.images[blockId]
+	if offset == 0 {
+		page = file.NewPageWithSize(rm.tx.fm.BlockSize())
+		rm.images[blockId] = page
+	}
+	if page == nil {
+		return nil
+	}
+	if err := page.CheckWrite(offset, len(data)); err != nil {
+		return err
+	}
+	copy(page.Contents()[offset:], data)
+	if offset+len(data) < len(page.Contents()) {
+		return nil
+	}
+	delete(rm.images, blockId)
+	return rm.bm.Restore(blockId, page)
 }
 
 /*
@@ -79,41 +165,101 @@ Rollback the transaction by iterating through the log records
 until it finds the transaction's START record,
 calling undo() for each of the transaction's log records
 */
-func (rm *RecoveryManager) doRollback() {
-	iter := rm.lm.Iterator()
+func (rm *RecoveryManager) doRollback() error {
+	iter, err := rm.lm.Iterator()
+	if err != nil {
+		return err
+	}
 	for iter.HasNext() {
-		buf := iter.Next()
-		record := CreateLogRecord(buf)
+		buf, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		record, err := CreateLogRecord(buf)
+		if err != nil {
+			return err
+		}
 		if record.TxNumber() == rm.txnum {
 			if record.Op() == START {
-				return
+				return nil
+			}
+			if err := record.Undo(rm.tx); err != nil {
+				return err
 			}
-			record.Undo(rm.tx)
 		}
 	}
+	return nil
 }
 
 /*
 Do a complete database recovery
-Iterate through the log records
-Whenever it finds a log record for an unfinished transaction, calls undo() on that record
-The method stops when it encounters a CHECKPOINT record or end of the log
+Read the log back to the last CHECKPOINT, redo it in the order it was written,
+undoing a rolled back txn at its ROLLBACK record, then undo the unfinished transactions
 */
-func (rm *RecoveryManager) doRecover() {
+func (rm *RecoveryManager) doRecover() error {
 	finishedTxns := make(map[int]bool)
+	records := make([]LogRecord, 0)
+	lsns := make([]int, 0)
 
-	iter := rm.lm.Iterator()
+	iter, err := rm.lm.Iterator()
+	if err != nil {
+		return err
+	}
 	for iter.HasNext() {
-		buf := iter.Next()
-		record := CreateLogRecord(buf)
+		buf, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		record, err := CreateLogRecord(buf)
+		if err != nil {
+			return err
+		}
 		if record.Op() == CHECKPOINT {
-			return
+			break
 		}
-
 		if record.Op() == COMMIT || record.Op() == ROLLBACK {
 			finishedTxns[record.TxNumber()] = true
-		} else if !finishedTxns[record.TxNumber()] { // record type is SETINT or SETSTRING
-			record.Undo(rm.tx)
+		}
+		records = append(records, record)
+		lsns = append(lsns, iter.LSN())
+	}
+
+	// the log was read backwards, redo it in the order it was written
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if record.Op() == ROLLBACK {
+			if err := rm.undoTxn(records[i+1:], lsns[i+1:], record.TxNumber()); err != nil {
+				return err
+			}
+		} else if update, ok := record.(RedoRecord); ok {
+			if err := update.Redo(rm.tx); err != nil {
+				return fmt.Errorf("redo %s at lsn %d: %w", record.ToString(), lsns[i], err)
+			}
+		}
+	}
+
+	for i, record := range records {
+		if !finishedTxns[record.TxNumber()] { // record type is SETINT, SETSTRING, SETBYTES or PAGEIMAGE
+			if err := record.Undo(rm.tx); err != nil {
+				return fmt.Errorf("undo %s at lsn %d: %w", record.ToString(), lsns[i], err)
+			}
+		}
+	}
+	return nil
+}
+
+// undoes the txn's updates found in records, which are newest first and have the lsns
+func (rm *RecoveryManager) undoTxn(records []LogRecord, lsns []int, txnum int) error {
+	for i, record := range records {
+		if record.TxNumber() != txnum {
+			continue
+		}
+		if record.Op() == START {
+			return nil
+		}
+		if err := record.Undo(rm.tx); err != nil {
+			return fmt.Errorf("undo %s at lsn %d: %w", record.ToString(), lsns[i], err)
 		}
 	}
+	return nil
 }
@@ -1,8 +1,11 @@
 package tx
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/nitishsharma2825/simpleDB/buffer"
@@ -29,16 +32,28 @@ func TestRecovery(t *testing.T) {
 	t.Cleanup(func() {
 		p1 := path.Join(dbFolder, blockFile)
 		os.RemoveAll(path.Dir(p1))
+		// tx4 never finishes, drop the locks it still holds
+		lt := GetLockTable()
+		lt.mu.Lock()
+		clear(lt.locks)
+		lt.mu.Unlock()
 	})
 
 	fm = file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm = log.NewLogManager(fm, logFile)
 	bm = buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
 	blockId0 = file.NewBlockID(blockFile, 0)
 	blockId1 = file.NewBlockID(blockFile, 1)
 
-	if fm.Length(blockFile) == 0 {
+	length, err := fm.Length(blockFile)
+	if err != nil {
+		t.Fatalf("failed to read file length: %v", err)
+	}
+	if length == 0 {
 		initialize(t)
 		modify(t)
 	} else {
@@ -47,8 +62,8 @@ func TestRecovery(t *testing.T) {
 }
 
 func initialize(t *testing.T) {
-	tx1 := NewTransaction(fm, lm, bm)
-	tx2 := NewTransaction(fm, lm, bm)
+	tx1 := newTxn(t, fm, lm, bm)
+	tx2 := newTxn(t, fm, lm, bm)
 
 	tx1.Pin(blockId0)
 	tx2.Pin(blockId1)
@@ -67,8 +82,8 @@ func initialize(t *testing.T) {
 }
 
 func modify(t *testing.T) {
-	tx3 := NewTransaction(fm, lm, bm)
-	tx4 := NewTransaction(fm, lm, bm)
+	tx3 := newTxn(t, fm, lm, bm)
+	tx4 := newTxn(t, fm, lm, bm)
 
 	tx3.Pin(blockId0)
 	tx4.Pin(blockId1)
@@ -91,7 +106,7 @@ func modify(t *testing.T) {
 }
 
 func recover(t *testing.T) {
-	tx := NewTransaction(fm, lm, bm)
+	tx := newTxn(t, fm, lm, bm)
 	tx.Recover()
 	printValues(t, "After recovery:")
 }
@@ -112,3 +127,36 @@ func printValues(t *testing.T, msg string) {
 	t.Logf("%q ", page1.GetString(30))
 	t.Log("\n")
 }
+
+// a record recovery cannot apply is named in the error
+func TestRecoverUnappliableRecord(t *testing.T) {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, logFile)
+	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
+
+	txn := newTxn(t, fm, lm, bm)
+	blockId, err := txn.Append(blockFile)
+	if err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
+	lsn, err := WriteSetStringRecordToLog(lm, txn.TxNum(), blockId, blockSize-8, "", "does not fit")
+	if err != nil {
+		t.Fatalf("failed to write record: %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	lm = log.NewLogManager(fm, logFile)
+	bm = buffer.NewBufferManager(fm, lm, bufferPoolSize)
+	err = newTxn(t, fm, lm, bm).Recover()
+	if !errors.Is(err, file.ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", file.ErrPageOutOfBounds, err)
+	}
+	if !strings.Contains(err.Error(), "SETSTRING") || !strings.Contains(err.Error(), fmt.Sprintf("lsn %d", lsn)) {
+		t.Fatalf("expected the error to name the record at lsn %d, got %v", lsn, err)
+	}
+}
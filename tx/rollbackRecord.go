@@ -27,7 +27,9 @@ func (rr *RollbackRecord) TxNumber() int {
 	return rr.txnum
 }
 
-func (rr *RollbackRecord) Undo(*Transaction) {}
+func (rr *RollbackRecord) Undo(*Transaction) error {
+	return nil
+}
 
 func (rr *RollbackRecord) ToString() string {
 	return fmt.Sprintf("<Rollback %d>", rr.txnum)
@@ -36,7 +38,7 @@ func (rr *RollbackRecord) ToString() string {
 // write the Rollback record to the log
 // contains the Rollback operator, followed by txn id
 // returns the LSN of the last log value
-func WriteRollbackRecordToLog(lm *log.Manager, txnum int) int {
+func WriteRollbackRecordToLog(lm *log.Manager, txnum int) (int, error) {
 	record := make([]byte, 2*file.IntBytes)
 	page := file.NewPageWithSlice(record)
 	page.SetInt(0, ROLLBACK)
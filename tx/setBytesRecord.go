@@ -0,0 +1,111 @@
+package tx
+
+import (
+	"fmt"
+
+	"github.com/nitishsharma2825/simpleDB/file"
+	"github.com/nitishsharma2825/simpleDB/log"
+)
+
+// Replaces a run of bytes in a block, e.g. a whole record slot cleared by a delete
+type SetBytesRecord struct {
+	txnum   int
+	blockId file.BlockID
+	offset  int
+	val     []byte
+	newVal  []byte
+}
+
+func NewSetBytesRecord(p *file.Page) *SetBytesRecord {
+	tpos := file.IntBytes
+	txnum := p.GetInt(tpos)
+
+	fpos := tpos + file.IntBytes
+	filename := p.GetString(fpos)
+	bpos := fpos + file.MaxLength(len(filename))
+	blockNum := p.GetInt(bpos)
+	blockId := file.NewBlockID(filename, blockNum)
+
+	opos := bpos + file.IntBytes
+	offset := p.GetInt(opos)
+
+	vpos := opos + file.IntBytes
+	val := p.GetBytes(vpos)
+
+	npos := vpos + file.MaxLength(len(val))
+	newVal := p.GetBytes(npos)
+
+	return &SetBytesRecord{
+		txnum:   txnum,
+		blockId: blockId,
+		offset:  offset,
+		val:     val,
+		newVal:  newVal,
+	}
+}
+
+func (sbr *SetBytesRecord) Op() int {
+	return SETBYTES
+}
+
+func (sbr *SetBytesRecord) TxNumber() int {
+	return sbr.txnum
+}
+
+func (sbr *SetBytesRecord) Block() file.BlockID {
+	return sbr.blockId
+}
+
+func (sbr *SetBytesRecord) Offset() int {
+	return sbr.offset
+}
+
+func (sbr *SetBytesRecord) OldValue() any {
+	return sbr.val
+}
+
+func (sbr *SetBytesRecord) NewValue() any {
+	return sbr.newVal
+}
+
+func (sbr *SetBytesRecord) Undo(txn *Transaction) error {
+	if err := txn.Pin(sbr.blockId); err != nil {
+		return err
+	}
+	defer txn.UnPin(sbr.blockId)
+	return txn.SetBytes(sbr.blockId, sbr.offset, sbr.val, false) // don't log the undo
+}
+
+func (sbr *SetBytesRecord) Redo(txn *Transaction) error {
+	if err := txn.Pin(sbr.blockId); err != nil {
+		return err
+	}
+	defer txn.UnPin(sbr.blockId)
+	return txn.SetBytes(sbr.blockId, sbr.offset, sbr.newVal, false) // don't log the redo
+}
+
+func (sbr *SetBytesRecord) ToString() string {
+	return fmt.Sprintf("<SETBYTES %d %v %d %x %x>", sbr.txnum, sbr.blockId.String(), sbr.offset, sbr.val, sbr.newVal)
+}
+
+func WriteSetBytesRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, offset int, val []byte, newVal []byte) (int, error) {
+	tpos := file.IntBytes
+	fpos := tpos + file.IntBytes
+	bpos := fpos + file.MaxLength(len(blockId.FileName()))
+	opos := bpos + file.IntBytes
+	vpos := opos + file.IntBytes
+	npos := vpos + file.MaxLength(len(val))
+
+	record := make([]byte, npos+file.MaxLength(len(newVal)))
+	page := file.NewPageWithSlice(record)
+
+	page.SetInt(0, SETBYTES)
+	page.SetInt(tpos, txnum)
+	page.SetString(fpos, blockId.FileName())
+	page.SetInt(bpos, blockId.BlockNumber())
+	page.SetInt(opos, offset)
+	page.SetBytes(vpos, val)
+	page.SetBytes(npos, newVal)
+
+	return lm.Append(record)
+}
@@ -12,6 +12,7 @@ type SetIntRecord struct {
 	blockId file.BlockID
 	offset  int
 	val     int
+	newVal  int
 }
 
 func NewSetIntRecord(p *file.Page) *SetIntRecord {
@@ -30,11 +31,15 @@ func NewSetIntRecord(p *file.Page) *SetIntRecord {
 	vpos := opos + file.IntBytes
 	val := p.GetInt(vpos)
 
+	npos := vpos + file.IntBytes
+	newVal := p.GetInt(npos)
+
 	return &SetIntRecord{
 		txnum:   txnum,
 		blockId: blockId,
 		offset:  offset,
 		val:     val,
+		newVal:  newVal,
 	}
 }
 
@@ -46,24 +51,51 @@ func (sir *SetIntRecord) TxNumber() int {
 	return sir.txnum
 }
 
-func (sir *SetIntRecord) Undo(txn *Transaction) {
-	txn.Pin(sir.blockId)
-	txn.SetInt(sir.blockId, sir.offset, sir.val, false) // don't log the undo
-	txn.UnPin(sir.blockId)
+func (sir *SetIntRecord) Block() file.BlockID {
+	return sir.blockId
+}
+
+func (sir *SetIntRecord) Offset() int {
+	return sir.offset
+}
+
+func (sir *SetIntRecord) OldValue() any {
+	return sir.val
+}
+
+func (sir *SetIntRecord) NewValue() any {
+	return sir.newVal
+}
+
+func (sir *SetIntRecord) Undo(txn *Transaction) error {
+	if err := txn.Pin(sir.blockId); err != nil {
+		return err
+	}
+	defer txn.UnPin(sir.blockId)
+	return txn.SetInt(sir.blockId, sir.offset, sir.val, false) // don't log the undo
+}
+
+func (sir *SetIntRecord) Redo(txn *Transaction) error {
+	if err := txn.Pin(sir.blockId); err != nil {
+		return err
+	}
+	defer txn.UnPin(sir.blockId)
+	return txn.SetInt(sir.blockId, sir.offset, sir.newVal, false) // don't log the redo
 }
 
 func (sir *SetIntRecord) ToString() string {
-	return fmt.Sprintf("<SETINT %d %v %d %d>", sir.txnum, sir.blockId.String(), sir.offset, sir.val)
+	return fmt.Sprintf("<SETINT %d %v %d %d %d>", sir.txnum, sir.blockId.String(), sir.offset, sir.val, sir.newVal)
 }
 
-func WriteSetIntRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, offset int, val int) int {
+func WriteSetIntRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, offset int, val int, newVal int) (int, error) {
 	tpos := file.IntBytes
 	fpos := tpos + file.IntBytes
 	bpos := fpos + file.MaxLength(len(blockId.FileName()))
 	opos := bpos + file.IntBytes
 	vpos := opos + file.IntBytes
+	npos := vpos + file.IntBytes
 
-	record := make([]byte, vpos+file.IntBytes)
+	record := make([]byte, npos+file.IntBytes)
 	page := file.NewPageWithSlice(record)
 
 	page.SetInt(0, SETINT)
@@ -72,6 +104,7 @@ func WriteSetIntRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, of
 	page.SetInt(bpos, blockId.BlockNumber())
 	page.SetInt(opos, offset)
 	page.SetInt(vpos, val)
+	page.SetInt(npos, newVal)
 
 	return lm.Append(record)
 }
@@ -12,6 +12,7 @@ type SetStringRecord struct {
 	blockId file.BlockID
 	offset  int
 	val     string
+	newVal  string
 }
 
 func NewSetStringRecord(p *file.Page) *SetStringRecord {
@@ -30,11 +31,15 @@ func NewSetStringRecord(p *file.Page) *SetStringRecord {
 	vpos := opos + file.IntBytes
 	val := p.GetString(vpos)
 
+	npos := vpos + file.MaxLength(len(val))
+	newVal := p.GetString(npos)
+
 	return &SetStringRecord{
 		txnum:   txnum,
 		blockId: blockId,
 		offset:  offset,
 		val:     val,
+		newVal:  newVal,
 	}
 }
 
@@ -46,24 +51,51 @@ func (ssr *SetStringRecord) TxNumber() int {
 	return ssr.txnum
 }
 
-func (ssr *SetStringRecord) Undo(txn *Transaction) {
-	txn.Pin(ssr.blockId)
-	txn.SetString(ssr.blockId, ssr.offset, ssr.val, false) // don't log the undo
-	txn.UnPin(ssr.blockId)
+func (ssr *SetStringRecord) Block() file.BlockID {
+	return ssr.blockId
+}
+
+func (ssr *SetStringRecord) Offset() int {
+	return ssr.offset
+}
+
+func (ssr *SetStringRecord) OldValue() any {
+	return ssr.val
+}
+
+func (ssr *SetStringRecord) NewValue() any {
+	return ssr.newVal
+}
+
+func (ssr *SetStringRecord) Undo(txn *Transaction) error {
+	if err := txn.Pin(ssr.blockId); err != nil {
+		return err
+	}
+	defer txn.UnPin(ssr.blockId)
+	return txn.SetString(ssr.blockId, ssr.offset, ssr.val, false) // don't log the undo
+}
+
+func (ssr *SetStringRecord) Redo(txn *Transaction) error {
+	if err := txn.Pin(ssr.blockId); err != nil {
+		return err
+	}
+	defer txn.UnPin(ssr.blockId)
+	return txn.SetString(ssr.blockId, ssr.offset, ssr.newVal, false) // don't log the redo
 }
 
 func (ssr *SetStringRecord) ToString() string {
-	return fmt.Sprintf("<SETSTRING %d %v %d %q>", ssr.txnum, ssr.blockId.String(), ssr.offset, ssr.val)
+	return fmt.Sprintf("<SETSTRING %d %v %d %q %q>", ssr.txnum, ssr.blockId.String(), ssr.offset, ssr.val, ssr.newVal)
 }
 
-func WriteSetStringRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, offset int, val string) int {
+func WriteSetStringRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID, offset int, val string, newVal string) (int, error) {
 	tpos := file.IntBytes
 	fpos := tpos + file.IntBytes
 	bpos := fpos + file.MaxLength(len(blockId.FileName()))
 	opos := bpos + file.IntBytes
 	vpos := opos + file.IntBytes
+	npos := vpos + file.MaxLength(len(val))
 
-	record := make([]byte, vpos+file.MaxLength(len(val)))
+	record := make([]byte, npos+file.MaxLength(len(newVal)))
 	page := file.NewPageWithSlice(record)
 
 	page.SetInt(0, SETSTRING)
@@ -72,6 +104,7 @@ func WriteSetStringRecordToLog(lm *log.Manager, txnum int, blockId file.BlockID,
 	page.SetInt(bpos, blockId.BlockNumber())
 	page.SetInt(opos, offset)
 	page.SetString(vpos, val)
+	page.SetString(npos, newVal)
 
 	return lm.Append(record)
 }
@@ -27,7 +27,9 @@ func (sr *StartRecord) TxNumber() int {
 	return sr.txnum
 }
 
-func (sr *StartRecord) Undo(*Transaction) {}
+func (sr *StartRecord) Undo(*Transaction) error {
+	return nil
+}
 
 func (sr *StartRecord) ToString() string {
 	return fmt.Sprintf("<START %d>", sr.txnum)
@@ -36,7 +38,7 @@ func (sr *StartRecord) ToString() string {
 // write the start record to the log
 // contains the START operator, followed by txn id
 // returns the LSN of the last log value
-func WriteStartRecordToLog(lm *log.Manager, txnum int) int {
+func WriteStartRecordToLog(lm *log.Manager, txnum int) (int, error) {
 	record := make([]byte, 2*file.IntBytes)
 	page := file.NewPageWithSlice(record)
 	page.SetInt(0, START)
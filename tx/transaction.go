@@ -14,7 +14,6 @@ ensuring all txns are serializable, recoverable
 and in general satisfy the ACID properties
 */
 
-var nextTxNum = 0
 var END_OF_FILE = -1
 
 type Transaction struct {
@@ -24,60 +23,105 @@ type Transaction struct {
 	fm        *file.Manager
 	txnum     int
 	myBuffers *BufferList
+	freed     map[string]bool
+	cuts      map[string]int // the size each file is cut to once the txn commits
+	onEnd     []func()       // run once the txn commits or rolls back
+	// recovery logs no page images
+	recovering bool
 }
 
 /*
 Creates a new txn and associated recovery and concurrency managers
+The txn number comes from the database superblock, so it is never reused after a restart
+An error if the superblock cannot reserve more txn numbers
 */
-func NewTransaction(fm *file.Manager, lm *log.Manager, bm *buffer.Manager) *Transaction {
+func NewTransaction(fm *file.Manager, lm *log.Manager, bm *buffer.Manager) (*Transaction, error) {
+	txnum, err := fm.NextTxNum()
+	if err != nil {
+		return nil, err
+	}
 	txn := &Transaction{
 		fm:        fm,
 		bm:        bm,
-		txnum:     NextTxNumber(),
-		myBuffers: NewBufferList(bm),
+		txnum:     txnum,
+		myBuffers: NewBufferList(bm, txnum),
+		freed:     make(map[string]bool),
+		cuts:      make(map[string]int),
 	}
 
 	txn.rm = NewRecoveryManager(txn, txn.txnum, lm, bm)
 	txn.cm = NewConcurrencyManager()
-	return txn
+	return txn, nil
 }
 
 /*
 Commit the current transaction
-Flush all modified buffers (and their log records)
-Write and flush a commit record to the log
-release all locks and unpin any pinned buffers
+Write and flush a commit record to the log, modified buffers stay in the pool
+unpin any pinned buffers, truncate trailing free blocks and release all locks
+The bits of the truncated blocks are cleared before the commit record
+A truncation error is returned, but the txn stays committed
+If the commit itself fails the log is failed before the buffers and locks are released,
+nothing can build on the changes and recovery decides whether the txn committed
 */
-func (txn *Transaction) Commit() {
-	txn.rm.Commit()
+func (txn *Transaction) Commit() error {
+	defer txn.end()
+	clearErr := txn.clearTrailingFree()
+	if err := txn.rm.Commit(); err != nil {
+		txn.rm.lm.Fail(err)
+		txn.myBuffers.UnPinAll()
+		txn.cm.Release()
+		return err
+	}
 	fmt.Printf("transaction %d committed\n", txn.txnum)
-	txn.cm.Release()
 	txn.myBuffers.UnPinAll()
+	err := txn.truncateFreeBlocks()
+	txn.cm.Release()
+	if err == nil {
+		err = clearErr
+	}
+	return err
 }
 
 /*
 Rollback the current transaction
 Undo any modified values
-flush those buffers
 write and flush a rollback record to the log
 release all locks and unpin any pinned buffers
+If the rollback fails the log is failed before the locks and buffers are released,
+the changes left behind are undone by recovery when the database is reopened
 */
-func (txn *Transaction) Rollback() {
-	txn.rm.Rollback()
-	fmt.Printf("transaction %d rolled back\n", txn.txnum)
+func (txn *Transaction) Rollback() error {
+	defer txn.end()
+	err := txn.rm.Rollback()
+	if err == nil {
+		fmt.Printf("transaction %d rolled back\n", txn.txnum)
+	} else {
+		txn.rm.lm.Fail(err)
+	}
 	txn.cm.Release()
 	txn.myBuffers.UnPinAll()
+	return err
 }
 
 /*
 Flush all modified buffers
-then go through log, rolling back all uncommitted txns.
-Finally, write a quiescent checkpoint record to the log.
+then go through log, redoing the logged changes and rolling back all uncommitted txns.
+Finally, sync the data files and write a quiescent checkpoint record to the log.
 This method is called during system startup, before user transactions begin
+If recovery fails the txn is over: its buffers and locks are released
 */
-func (txn *Transaction) Recover() {
-	txn.bm.FlushAll(txn.txnum)
-	txn.rm.Recover()
+func (txn *Transaction) Recover() error {
+	txn.recovering = true
+	defer func() { txn.recovering = false }()
+	err := txn.bm.FlushAll(txn.txnum)
+	if err == nil {
+		err = txn.rm.Recover()
+	}
+	if err != nil {
+		txn.myBuffers.UnPinAll()
+		txn.cm.Release()
+	}
+	return err
 }
 
 /*
@@ -92,6 +136,26 @@ func (txn *Transaction) Pin(blockId file.BlockID) error {
 	return nil
 }
 
+/*
+Hints that n blocks of the file from startBlock onwards are about to be read
+*/
+func (txn *Transaction) Prefetch(filename string, startBlock int, n int) {
+	if ring := txn.myBuffers.rings[filename]; ring != nil {
+		txn.bm.PrefetchRing(ring, filename, startBlock, n)
+		return
+	}
+	txn.bm.Prefetch(filename, startBlock, n)
+}
+
+/*
+Reads the file's blocks missing from the pool into a private ring of size buffers until the txn ends
+*/
+func (txn *Transaction) UseRing(filename string, size int) {
+	if txn.myBuffers.rings[filename] == nil {
+		txn.myBuffers.rings[filename] = buffer.NewRing(size)
+	}
+}
+
 /*
 Unpin the specified block
 the transaction looks up the buffer pinned to this block and unpins it
@@ -104,28 +168,32 @@ func (txn *Transaction) UnPin(blockId file.BlockID) {
 Return the integer value stored at offset of the block
 First Obtain an SLock on the block, then call its buffer to retrieve the value
 */
-func (txn *Transaction) GetInt(blockId file.BlockID, offset int) int {
+func (txn *Transaction) GetInt(blockId file.BlockID, offset int) (int, error) {
 	txn.cm.Slock(blockId)
 	buff := txn.myBuffers.GetBuffer(blockId)
 	if buff == nil {
-		txn.Pin(blockId)
+		if err := txn.Pin(blockId); err != nil {
+			return 0, err
+		}
 		buff = txn.myBuffers.GetBuffer(blockId)
 	}
-	return buff.Contents().GetInt(offset)
+	return buff.Contents().GetInt(offset), nil
 }
 
 /*
 Return the string value stored at offset of the block
 First Obtain an SLock on the block, then call its buffer to retrieve the value
 */
-func (txn *Transaction) GetString(blockId file.BlockID, offset int) string {
+func (txn *Transaction) GetString(blockId file.BlockID, offset int) (string, error) {
 	txn.cm.Slock(blockId)
 	buff := txn.myBuffers.GetBuffer(blockId)
 	if buff == nil {
-		txn.Pin(blockId)
+		if err := txn.Pin(blockId); err != nil {
+			return "", err
+		}
 		buff = txn.myBuffers.GetBuffer(blockId)
 	}
-	return buff.Contents().GetString(offset)
+	return buff.Contents().GetString(offset), nil
 }
 
 /*
@@ -134,16 +202,27 @@ First obtain an XLock on the block
 Read the current value at that offset, puts it into an update log record and write that record to the log
 Call the buffer to store the new value passing in the LSN of the log record and txn's id
 */
-func (txn *Transaction) SetInt(blockId file.BlockID, offset int, val int, okToLog bool) {
+func (txn *Transaction) SetInt(blockId file.BlockID, offset int, val int, okToLog bool) error {
 	txn.cm.Xlock(blockId)
 	buff := txn.myBuffers.GetBuffer(blockId)
+	// a write that cannot be applied must not reach the log
+	if err := buff.Contents().CheckWrite(offset, file.IntBytes); err != nil {
+		return err
+	}
+	if err := txn.logImage(buff); err != nil {
+		return err
+	}
 	lsn := -1
 	if okToLog {
-		lsn = txn.rm.SetInt(buff, offset, val)
+		var err error
+		if lsn, err = txn.rm.SetInt(buff, offset, val); err != nil {
+			return err
+		}
 	}
 	page := buff.Contents()
 	page.SetInt(offset, val)
 	buff.SetModified(txn.txnum, lsn)
+	return nil
 }
 
 /*
@@ -152,23 +231,75 @@ First obtain an XLock on the block
 Read the current value at that offset, puts it into an update log record and write that record to the log
 Call the buffer to store the new value passing in the LSN of the log record and txn's id
 */
-func (txn *Transaction) SetString(blockId file.BlockID, offset int, val string, okToLog bool) {
+func (txn *Transaction) SetString(blockId file.BlockID, offset int, val string, okToLog bool) error {
 	txn.cm.Xlock(blockId)
 	buff := txn.myBuffers.GetBuffer(blockId)
+	if err := buff.Contents().CheckWrite(offset, file.MaxLength(len(val))); err != nil {
+		return err
+	}
+	if err := txn.logImage(buff); err != nil {
+		return err
+	}
 	lsn := -1
 	if okToLog {
-		lsn = txn.rm.SetString(buff, offset, val)
+		var err error
+		if lsn, err = txn.rm.SetString(buff, offset, val); err != nil {
+			return err
+		}
 	}
 	page := buff.Contents()
-	page.SetString(offset, val)
+	if err := page.SetString(offset, val); err != nil {
+		return err
+	}
 	buff.SetModified(txn.txnum, lsn)
+	return nil
+}
+
+/*
+Store the bytes at offset of the block, replacing as many bytes
+First obtain an XLock on the block, then log the bytes replaced like SetInt
+*/
+func (txn *Transaction) SetBytes(blockId file.BlockID, offset int, val []byte, okToLog bool) error {
+	txn.cm.Xlock(blockId)
+	buff := txn.myBuffers.GetBuffer(blockId)
+	if err := buff.Contents().CheckWrite(offset, len(val)); err != nil {
+		return err
+	}
+	if err := txn.logImage(buff); err != nil {
+		return err
+	}
+	lsn := -1
+	if okToLog {
+		var err error
+		if lsn, err = txn.rm.SetBytes(buff, offset, val); err != nil {
+			return err
+		}
+	}
+	copy(buff.Contents().Contents()[offset:], val)
+	buff.SetModified(txn.txnum, lsn)
+	return nil
+}
+
+// logs the page before its first change since it was read or checkpointed
+func (txn *Transaction) logImage(buff *buffer.Buffer) error {
+	if txn.recovering || buff.Imaged() {
+		return nil
+	}
+	lsn, err := txn.rm.PageImage(buff)
+	if err != nil {
+		return err
+	}
+	// the block may only be written once its image is durable
+	buff.SetModified(txn.txnum, lsn)
+	buff.SetImaged()
+	return nil
 }
 
 /*
 returns the number of blocks in the specified file
 First obtain an SLock on the "end of the file", before asking the file manager to return the file size
 */
-func (txn *Transaction) Size(filename string) int {
+func (txn *Transaction) Size(filename string) (int, error) {
 	dummyId := file.NewBlockID(filename, END_OF_FILE)
 	txn.cm.Slock(dummyId)
 	return txn.fm.Length(filename)
@@ -178,7 +309,7 @@ func (txn *Transaction) Size(filename string) int {
 Append a new block to the end of the specified file and returns a reference to it
 First obtain an XLock on the "end of the file" before performing the append
 */
-func (txn *Transaction) Append(filename string) file.BlockID {
+func (txn *Transaction) Append(filename string) (file.BlockID, error) {
 	dummyId := file.NewBlockID(filename, END_OF_FILE)
 	txn.cm.Xlock(dummyId)
 	return txn.fm.Append(filename)
@@ -192,7 +323,30 @@ func (txn *Transaction) AvailableBuffs() int {
 	return txn.bm.Available()
 }
 
-func NextTxNumber() int {
-	nextTxNum++
-	return nextTxNum
+// Returns the number of buffers in the pool, pinned or not
+func (txn *Transaction) PoolSize() int {
+	return txn.bm.Size()
+}
+
+// Returns a record of every pin the txn holds, ordered by block
+func (txn *Transaction) OutstandingPins() []buffer.PinRecord {
+	return txn.myBuffers.Outstanding()
+}
+
+// Returns the number the transaction's log records carry
+func (txn *Transaction) TxNum() int {
+	return txn.txnum
+}
+
+// Registers a function run once the txn has committed or rolled back, whether or not that succeeded
+func (txn *Transaction) OnEnd(f func()) {
+	txn.onEnd = append(txn.onEnd, f)
+}
+
+func (txn *Transaction) end() {
+	onEnd := txn.onEnd
+	txn.onEnd = nil
+	for _, f := range onEnd {
+		f()
+	}
 }
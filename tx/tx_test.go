@@ -1,8 +1,12 @@
 package tx
 
 import (
+	"errors"
+	"io"
 	"os"
 	"path"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/nitishsharma2825/simpleDB/buffer"
@@ -10,6 +14,15 @@ import (
 	"github.com/nitishsharma2825/simpleDB/log"
 )
 
+func newTxn(t *testing.T, fm *file.Manager, lm *log.Manager, bm *buffer.Manager) *Transaction {
+	t.Helper()
+	txn, err := NewTransaction(fm, lm, bm)
+	if err != nil {
+		t.Fatalf("failed to start txn: %v", err)
+	}
+	return txn
+}
+
 func TestTransaction(t *testing.T) {
 	const dbFolder = "../test_data"
 	const blockFile = "testfile"
@@ -19,17 +32,17 @@ func TestTransaction(t *testing.T) {
 
 	t.Cleanup(func() {
 		p1 := path.Join(dbFolder, blockFile)
-		p2 := path.Join(dbFolder, logFile)
-		os.Remove(p1)
-		os.Remove(p2)
-		os.Remove(path.Dir(p1))
+		os.RemoveAll(path.Dir(p1))
 	})
 
 	fm := file.NewFileManager(dbFolder, blockSize)
+	t.Cleanup(func() {
+		fm.Close()
+	})
 	lm := log.NewLogManager(fm, logFile)
 	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
 
-	tx1 := NewTransaction(fm, lm, bm)
+	tx1 := newTxn(t, fm, lm, bm)
 	blockId := file.NewBlockID(blockFile, 1)
 	tx1.Pin(blockId)
 	// The block initially contains unknown bytes,
@@ -38,10 +51,16 @@ func TestTransaction(t *testing.T) {
 	tx1.SetString(blockId, 40, "one", false)
 	tx1.Commit()
 
-	tx2 := NewTransaction(fm, lm, bm)
+	tx2 := newTxn(t, fm, lm, bm)
 	tx2.Pin(blockId)
-	ival := tx2.GetInt(blockId, 80)
-	sval := tx2.GetString(blockId, 40)
+	ival, err := tx2.GetInt(blockId, 80)
+	if err != nil {
+		t.Fatalf("failed to get int: %v", err)
+	}
+	sval, err := tx2.GetString(blockId, 40)
+	if err != nil {
+		t.Fatalf("failed to get string: %v", err)
+	}
 	t.Logf("Initial value at location 80 = %d\n", ival)
 	t.Logf("Initial value at location 40 = %q\n", sval)
 	newival := ival + 1
@@ -50,16 +69,251 @@ func TestTransaction(t *testing.T) {
 	tx2.SetString(blockId, 40, newsval, true)
 	tx2.Commit()
 
-	tx3 := NewTransaction(fm, lm, bm)
+	tx3 := newTxn(t, fm, lm, bm)
 	tx3.Pin(blockId)
-	t.Logf("new value at location 80 = %d", tx3.GetInt(blockId, 80))
-	t.Logf("new value at location 40 = %q", tx3.GetString(blockId, 40))
+	ival, _ = tx3.GetInt(blockId, 80)
+	sval, _ = tx3.GetString(blockId, 40)
+	t.Logf("new value at location 80 = %d", ival)
+	t.Logf("new value at location 40 = %q", sval)
 	tx3.SetInt(blockId, 80, 9999, true)
-	t.Logf("pre-rollback value at location 80 = %d\n", tx3.GetInt(blockId, 80))
+	ival, _ = tx3.GetInt(blockId, 80)
+	t.Logf("pre-rollback value at location 80 = %d\n", ival)
 	tx3.Rollback()
 
-	tx4 := NewTransaction(fm, lm, bm)
+	tx4 := newTxn(t, fm, lm, bm)
 	tx4.Pin(blockId)
-	t.Logf("post-rollback at location 80 = %d\n", tx4.GetInt(blockId, 80))
+	ival, _ = tx4.GetInt(blockId, 80)
+	t.Logf("post-rollback at location 80 = %d\n", ival)
 	tx4.Commit()
 }
+
+func TestTransactionSetStringOutOfBounds(t *testing.T) {
+	const blockFile = "testfile"
+	const logFile = "logfile"
+	const blockSize = 400
+	const bufferPoolSize = 8
+
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, logFile)
+	bm := buffer.NewBufferManager(fm, lm, bufferPoolSize)
+
+	tx := newTxn(t, fm, lm, bm)
+	blockId, err := tx.Append(blockFile)
+	if err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
+	if err := tx.Pin(blockId); err != nil {
+		t.Fatalf("failed to pin block: %v", err)
+	}
+
+	if err := tx.SetString(blockId, blockSize-8, "does not fit", false); !errors.Is(err, file.ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", file.ErrPageOutOfBounds, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestPinTracking(t *testing.T) {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	t.Cleanup(func() {
+		fm.Close()
+	})
+	var reports strings.Builder
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8, buffer.WithPinTracking(&reports))
+
+	// a block pinned twice and unpinned once stays pinned
+	txn := newTxn(t, fm, lm, bm)
+	blockId := file.NewBlockID("testfile", 0)
+	txn.Pin(blockId)
+	txn.Pin(blockId)
+	txn.UnPin(blockId)
+	pins := txn.OutstandingPins()
+	if len(pins) != 1 || pins[0].TxNum != txn.TxNum() || !strings.Contains(pins[0].Stack, "TestPinTracking") {
+		t.Fatalf("expected one pin taken by the test, got %+v", pins)
+	}
+
+	// the txn ends reporting the pin, and releases it
+	txn.Commit()
+	if report := reports.String(); !strings.Contains(report, "ended holding 1 pins") || !strings.Contains(report, "TestPinTracking") {
+		t.Fatalf("expected a report of the pin left, got %q", report)
+	}
+	if bm.Available() != 8 {
+		t.Fatalf("expected %d buffers available, got %d", 8, bm.Available())
+	}
+}
+
+// a txn unpinning a block another txn pinned after it leaves the other txn's pin
+func TestPinTrackingOwners(t *testing.T) {
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8, buffer.WithPinTracking(io.Discard))
+
+	blockId := file.NewBlockID("testfile", 0)
+	tx1 := newTxn(t, fm, lm, bm)
+	tx2 := newTxn(t, fm, lm, bm)
+	tx1.Pin(blockId)
+	tx2.Pin(blockId)
+	tx1.UnPin(blockId)
+	if pins := bm.OutstandingPins(); len(pins) != 1 || pins[0].TxNum != tx2.TxNum() {
+		t.Fatalf("expected the pin of txn %d left, got %+v", tx2.TxNum(), pins)
+	}
+	if pins := tx2.OutstandingPins(); len(pins) != 1 {
+		t.Fatalf("expected the pin of txn %d left, got %+v", tx2.TxNum(), pins)
+	}
+	tx1.Commit()
+	tx2.Commit()
+}
+
+// storage whose syncs fail while failing is set
+type failingSyncStorage struct {
+	file.Storage
+	failing atomic.Bool
+}
+
+type failingSyncDevice struct {
+	file.BlockDevice
+	storage *failingSyncStorage
+}
+
+func (s *failingSyncStorage) Open(filename string) (file.BlockDevice, error) {
+	dev, err := s.Storage.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &failingSyncDevice{BlockDevice: dev, storage: s}, nil
+}
+
+func (d *failingSyncDevice) Sync() error {
+	if d.storage.failing.Load() {
+		return errors.New("sync failed")
+	}
+	return d.BlockDevice.Sync()
+}
+
+// the changes of a txn whose commit failed are never built on or written
+func TestFailedCommitFailsLog(t *testing.T) {
+	storage := &failingSyncStorage{Storage: file.NewMemStorage()}
+	fm, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8)
+
+	txn := newTxn(t, fm, lm, bm)
+	blockId, err := txn.Append("failfile")
+	if err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
+	txn.Pin(blockId)
+	if err := txn.SetInt(blockId, 80, 42, true); err != nil {
+		t.Fatalf("failed to set int: %v", err)
+	}
+	storage.failing.Store(true)
+	if err := txn.Commit(); err == nil {
+		t.Fatalf("expected the commit to fail")
+	}
+	storage.failing.Store(false)
+
+	// the storage works again, but the log stays failed
+	other := newTxn(t, fm, lm, bm)
+	if err := other.Commit(); !errors.Is(err, log.ErrLogFailed) {
+		t.Fatalf("expected %v, got %v", log.ErrLogFailed, err)
+	}
+	if err := bm.FlushDirty(); !errors.Is(err, log.ErrLogFailed) {
+		t.Fatalf("expected %v, got %v", log.ErrLogFailed, err)
+	}
+	page := file.NewPageWithSize(400)
+	if err := fm.Read(blockId, page); err != nil {
+		t.Fatalf("failed to read block: %v", err)
+	}
+	if page.GetInt(80) != 0 {
+		t.Fatalf("expected the uncommitted value to stay off disk, got %d", page.GetInt(80))
+	}
+}
+
+// a logged write that does not fit in the page leaves nothing for recovery to replay
+func TestOutOfBoundsWriteNotLogged(t *testing.T) {
+	const blockSize = 400
+
+	fm, err := file.NewFileManagerWithStorage(file.NewMemStorage(), blockSize)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8)
+
+	txn := newTxn(t, fm, lm, bm)
+	blockId, err := txn.Append("testfile")
+	if err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
+	txn.Pin(blockId)
+	if err := txn.SetString(blockId, blockSize-8, "does not fit", true); !errors.Is(err, file.ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", file.ErrPageOutOfBounds, err)
+	}
+	if err := txn.SetInt(blockId, blockSize-2, 1, true); !errors.Is(err, file.ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", file.ErrPageOutOfBounds, err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+
+	// reopen and recover
+	lm = log.NewLogManager(fm, "logfile")
+	bm = buffer.NewBufferManager(fm, lm, 8)
+	if err := newTxn(t, fm, lm, bm).Recover(); err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+}
+
+// a read of a block the txn cannot pin returns the pin's error
+func TestGetIntPinError(t *testing.T) {
+	storage := file.NewFaultStorage(1)
+	fm, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8)
+
+	txn := newTxn(t, fm, lm, bm)
+	blockId, err := txn.Append("testfile")
+	if err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
+	storage.Crash(file.DROP_UNSYNCED)
+	if _, err := txn.GetInt(blockId, 0); !errors.Is(err, file.ErrSimulatedCrash) {
+		t.Fatalf("expected %v, got %v", file.ErrSimulatedCrash, err)
+	}
+	if _, err := txn.GetString(blockId, 0); !errors.Is(err, file.ErrSimulatedCrash) {
+		t.Fatalf("expected %v, got %v", file.ErrSimulatedCrash, err)
+	}
+}
+
+// a txn that cannot reserve its number in the superblock is not started
+func TestNewTransactionError(t *testing.T) {
+	storage := file.NewFaultStorage(1)
+	fm, err := file.NewFileManagerWithStorage(storage, 400)
+	if err != nil {
+		t.Fatalf("failed to create file manager: %v", err)
+	}
+	lm := log.NewLogManager(fm, "logfile")
+	bm := buffer.NewBufferManager(fm, lm, 8)
+
+	storage.Crash(file.DROP_UNSYNCED)
+	if _, err := NewTransaction(fm, lm, bm); !errors.Is(err, file.ErrSimulatedCrash) {
+		t.Fatalf("expected %v, got %v", file.ErrSimulatedCrash, err)
+	}
+}